@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"errors"
+	contracts "exchange/Contracts"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OrderBook is a local book kept from a depth stream , every message is a diff :
+// a level with quantity 0 is removed , any other quantity replaces the level
+// diffs chain by update id , a message whose U is not the previous u+1 means something was missed (usually a reconnect)
+//
+// the gateway has no snapshot endpoint , without a Snapshot func the book starts empty on the first diff
+// and after a gap , so it only holds levels that changed since , pass one when the engine can serve snapshots
+type OrderBook struct {
+	mu     sync.RWMutex
+	bids   map[float64]Level // by price value , "100.0" and "100.00" are one level
+	asks   map[float64]Level
+	lastID int64
+	synced bool // lastID is meaningful
+}
+
+type Level struct {
+	Price string
+	Qty   string
+	price float64 // for ordering only , the strings are what the engine sent
+}
+
+// Snapshot returns the full book of a depth stream , its LastID is where the diffs continue
+type Snapshot func(ctx context.Context, stream string) (contracts.DepthData, error)
+
+var ErrBookGap = errors.New("depth diff does not follow the last update")
+
+func NewOrderBook() *OrderBook {
+	return &OrderBook{bids: make(map[float64]Level), asks: make(map[float64]Level)}
+}
+
+// Book subscribes to a depth stream and keeps an OrderBook from it , snapshot may be nil , see OrderBook
+// onGap , when set , is called after the book was rebuilt because diffs were missed
+func (md *MarketData) Book(stream string, snapshot Snapshot, onGap func(err error)) (*OrderBook, error) {
+	b := NewOrderBook()
+	err := md.Depth(stream, func(d contracts.DepthData) {
+		err := b.Apply(d)
+		if err == nil {
+			return
+		}
+		if snapshot != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			snap, serr := snapshot(ctx, stream)
+			cancel()
+			if serr != nil {
+				err = errors.Join(err, fmt.Errorf("snapshot: %w", serr), b.Reset(d))
+			} else if rerr := b.Reset(snap); rerr != nil {
+				err = errors.Join(err, fmt.Errorf("snapshot: %w", rerr), b.Reset(d))
+			} else if d.LastID > snap.LastID {
+				// the diff that showed the gap may be newer than the snapshot
+				if aerr := b.Apply(d); aerr != nil {
+					err = errors.Join(err, b.Reset(d))
+				}
+			}
+		} else {
+			err = errors.Join(err, b.Reset(d))
+		}
+		if onGap != nil {
+			onGap(err)
+		}
+	})
+	return b, err
+}
+
+// Apply adds one diff , any error leaves the book as it was , Reset is the way back from ErrBookGap
+// the first diff of an empty book is taken as is
+func (b *OrderBook) Apply(d contracts.DepthData) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.synced {
+		if d.LastID <= b.lastID {
+			return nil // already in the book , a snapshot can be newer than diffs still in flight
+		}
+		if d.FirstID > b.lastID+1 {
+			return fmt.Errorf("%w : have %d , got %d..%d", ErrBookGap, b.lastID, d.FirstID, d.LastID)
+		}
+	}
+	bids, asks, err := parseDepth(d)
+	if err != nil {
+		return err
+	}
+	apply(b.bids, bids)
+	apply(b.asks, asks)
+	b.lastID, b.synced = d.LastID, true
+	return nil
+}
+
+// Reset replaces the whole book with d , a snapshot or the first diff after a gap
+// a level that does not parse leaves the book as it was
+func (b *OrderBook) Reset(d contracts.DepthData) error {
+	bids, asks, err := parseDepth(d)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.bids = make(map[float64]Level, len(bids))
+	b.asks = make(map[float64]Level, len(asks))
+	apply(b.bids, bids)
+	apply(b.asks, asks)
+	b.lastID, b.synced = d.LastID, true
+	return nil
+}
+
+// a parsed level , qty 0 removes it
+type change struct {
+	level Level
+	qty   float64
+}
+
+// parseDepth parses both sides before anything touches the book , a bad ask must not leave the bids applied
+func parseDepth(d contracts.DepthData) (bids, asks []change, err error) {
+	if bids, err = parseSide(d.Bids); err != nil {
+		return nil, nil, err
+	}
+	if asks, err = parseSide(d.Asks); err != nil {
+		return nil, nil, err
+	}
+	return bids, asks, nil
+}
+
+func parseSide(levels [][]string) ([]change, error) {
+	changes := make([]change, 0, len(levels))
+	for _, l := range levels {
+		if len(l) != 2 {
+			return nil, fmt.Errorf("depth level with %d values", len(l))
+		}
+		price, err := strconv.ParseFloat(l[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("depth price %q: %w", l[0], err)
+		}
+		qty, err := strconv.ParseFloat(l[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("depth quantity %q: %w", l[1], err)
+		}
+		changes = append(changes, change{level: Level{Price: l[0], Qty: l[1], price: price}, qty: qty})
+	}
+	return changes, nil
+}
+
+func apply(side map[float64]Level, changes []change) {
+	for _, c := range changes {
+		if c.qty == 0 {
+			delete(side, c.level.price)
+			continue
+		}
+		side[c.level.price] = c.level
+	}
+}
+
+// Bids returns up to n levels best first , n <= 0 returns all of them
+func (b *OrderBook) Bids(n int) []Level {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return top(b.bids, n, func(x, y Level) int { return compareFloat(y.price, x.price) })
+}
+
+// Asks returns up to n levels best first , n <= 0 returns all of them
+func (b *OrderBook) Asks(n int) []Level {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return top(b.asks, n, func(x, y Level) int { return compareFloat(x.price, y.price) })
+}
+
+// Best is the top of the book , ok is false while either side is empty
+func (b *OrderBook) Best() (bid, ask Level, ok bool) {
+	bids, asks := b.Bids(1), b.Asks(1)
+	if len(bids) == 0 || len(asks) == 0 {
+		return Level{}, Level{}, false
+	}
+	return bids[0], asks[0], true
+}
+
+// LastUpdateID is the u of the last diff applied , 0 before the first
+func (b *OrderBook) LastUpdateID() int64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.lastID
+}
+
+func top(side map[float64]Level, n int, cmp func(x, y Level) int) []Level {
+	levels := make([]Level, 0, len(side))
+	for _, l := range side {
+		levels = append(levels, l)
+	}
+	slices.SortFunc(levels, cmp)
+	if n > 0 && len(levels) > n {
+		levels = levels[:n]
+	}
+	return levels
+}
+
+func compareFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"errors"
+	"testing"
+
+	contracts "exchange/Contracts"
+)
+
+func TestBookBadLevelLeavesBookAsItWas(t *testing.T) {
+	b := NewOrderBook()
+	if err := b.Apply(contracts.DepthData{FirstID: 1, LastID: 1,
+		Bids: [][]string{{"99", "1"}},
+		Asks: [][]string{{"101", "1"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err := b.Apply(contracts.DepthData{FirstID: 2, LastID: 2,
+		Bids: [][]string{{"99", "0"}, {"98", "5"}},
+		Asks: [][]string{{"102", "x"}},
+	})
+	if err == nil {
+		t.Fatal("diff with a bad ask quantity was applied")
+	}
+	if errors.Is(err, ErrBookGap) {
+		t.Fatalf("bad level reported as a gap: %v", err)
+	}
+	bid, ask, ok := b.Best()
+	if !ok || bid.Price != "99" || ask.Price != "101" || len(b.Bids(0)) != 1 {
+		t.Fatalf("book changed by a refused diff: bids %v asks %v", b.Bids(0), b.Asks(0))
+	}
+	if id := b.LastUpdateID(); id != 1 {
+		t.Fatalf("last update id %d , want 1", id)
+	}
+	if err := b.Reset(contracts.DepthData{LastID: 5, Bids: [][]string{{"oops", "1"}}}); err == nil {
+		t.Fatal("snapshot with a bad price was taken")
+	}
+	if id := b.LastUpdateID(); id != 1 {
+		t.Fatalf("refused reset moved the last update id to %d", id)
+	}
+}
+
+func TestBookLevelsByPriceValue(t *testing.T) {
+	b := NewOrderBook()
+	steps := []contracts.DepthData{
+		{FirstID: 1, LastID: 1, Bids: [][]string{{"100.0", "1"}, {"99.5", "2"}}},
+		{FirstID: 2, LastID: 2, Bids: [][]string{{"100.00", "3"}}}, // same level , new quantity
+		{FirstID: 3, LastID: 3, Bids: [][]string{{"99.50", "0"}}},  // removes 99.5
+	}
+	for _, d := range steps {
+		if err := b.Apply(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bids := b.Bids(0)
+	if len(bids) != 1 || bids[0].Qty != "3" || bids[0].Price != "100.00" {
+		t.Fatalf("bids %v , want one level 100.00 x 3", bids)
+	}
+}
@@ -0,0 +1,378 @@
+// Package client is the Go SDK for the gateway websocket endpoints
+//
+//	md := client.NewMarketData("wss://gateway.example:8443", client.WithHeader(hdr))
+//	md.Trades("trade.1", func(t contracts.TradeData) { ... })
+//	book, _ := md.Book("depth.1", nil, nil)
+//	go md.Run(ctx)
+//
+//	oe := client.NewOrderEvents("wss://gateway.example:8443", client.WithTLS(tlsCfg))
+//	oe.OnEvent(func(ev contracts.SequencedOrderEvent) { ... })
+//	oe.OnGap(func(s contracts.OrderEventsSessionData) { ... resync from the engine ... })
+//	go oe.Run(ctx)
+//
+// both reconnect with exponential backoff until ctx is done , market data subscriptions are sent again
+// and order events resume after the last seq they delivered , see Hub/resume.go for the server side
+// callbacks run on the read goroutine one at a time , a slow callback backs the connection up
+//
+// the SDK speaks json only , Run refuses ?encoding=msgpack , protobuf and sbe with ErrUnsupportedEncoding ,
+// a client that wants the binary frames dials itself and decodes them by Wire/gateway.proto or Wire/sbe.xml
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	contracts "exchange/Contracts"
+
+	"github.com/gorilla/websocket"
+)
+
+type Option func(*options)
+
+type options struct {
+	header      http.Header
+	tls         *tls.Config
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+	readTimeout time.Duration
+	reqRate     int
+	reqBurst    int
+	log         *slog.Logger
+	onConnect   func()
+	onDrop      func(err error)
+	encoding    contracts.Encoding
+}
+
+func defaultOptions() options {
+	return options{
+		minBackoff:  100 * time.Millisecond,
+		maxBackoff:  30 * time.Second,
+		readTimeout: 90 * time.Second,
+		reqRate:     8, // a little under the gateway default tier , 10 per second with a burst of 20
+		reqBurst:    16,
+		log:         slog.Default(),
+	}
+}
+
+// WithHeader is sent on every dial , for api keys (X-API-Key) or whatever the gateway authenticates with
+func WithHeader(h http.Header) Option {
+	return func(o *options) { o.header = h.Clone() }
+}
+
+// WithTLS sets the tls config for wss urls , client certificates authenticate order events connections
+func WithTLS(cfg *tls.Config) Option {
+	return func(o *options) { o.tls = cfg }
+}
+
+// WithBackoff bounds the wait between reconnects , it doubles from min up to max with jitter
+func WithBackoff(first, limit time.Duration) Option {
+	return func(o *options) { o.minBackoff, o.maxBackoff = first, limit }
+}
+
+// WithRequestRate paces subscribe , unsubscribe and ping requests to stay under the tier's messages_per_second ,
+// a resubscribe after a reconnect sends one request per stream , 0 sends without waiting
+func WithRequestRate(perSecond, burst int) Option {
+	return func(o *options) { o.reqRate, o.reqBurst = perSecond, burst }
+}
+
+// WithReadTimeout drops a connection that went quiet , server pings count , 0 never times out
+// the default is a bit longer than the gateway's pong_timeout
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) { o.readTimeout = d }
+}
+
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) { o.log = l }
+}
+
+// WithConnectHooks are called after every successful dial and after every dropped connection
+func WithConnectHooks(onConnect func(), onDrop func(err error)) Option {
+	return func(o *options) { o.onConnect, o.onDrop = onConnect, onDrop }
+}
+
+// WithEncoding picks the frame encoding , only contracts.EncodingJSON is supported , the default ,
+// Run returns ErrUnsupportedEncoding for the others instead of handing binary frames to the json callbacks
+func WithEncoding(enc contracts.Encoding) Option {
+	return func(o *options) { o.encoding = enc }
+}
+
+var errClosed = errors.New("client closed")
+
+// conn is the reconnect loop both endpoints share , the endpoint says what to do on every new connection and frame
+type conn struct {
+	o    options
+	base string // ws(s)://host:port
+	path string
+
+	query   func() url.Values                // extra query per dial , order events put their resume point here
+	ready   func(send func(any) error) error // runs after every dial before frames are read
+	onFrame func(data []byte)
+
+	pace   *pacer
+	mu     sync.Mutex // guards ws and writes on it
+	ws     *websocket.Conn
+	closed bool
+	stop   chan struct{}
+}
+
+func newConn(base, path string, opts []Option) *conn {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &conn{o: o, base: strings.TrimSuffix(base, "/"), path: path, pace: newPacer(o.reqRate, o.reqBurst), stop: make(chan struct{})}
+}
+
+// run dials and reads until ctx is done or Close is called , every failure is followed by a backoff and a redial
+func (c *conn) run(ctx context.Context) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	backoff := c.o.minBackoff
+	for {
+		started := time.Now()
+		err := c.session(ctx)
+		if ctx.Err() != nil {
+			if c.isClosed() {
+				return nil
+			}
+			return ctx.Err()
+		}
+		if c.o.onDrop != nil {
+			c.o.onDrop(err)
+		}
+		// a connection that held for a while starts the backoff over
+		if time.Since(started) > c.o.maxBackoff {
+			backoff = c.o.minBackoff
+		}
+		wait := max(jitter(backoff), goAwayHint(err))
+		c.o.log.Warn("gateway connection lost , reconnecting", "path", c.path, "err", err, "in", wait)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			if c.isClosed() {
+				return nil
+			}
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, c.o.maxBackoff)
+	}
+}
+
+// validate refuses what no redial can fix , a binary encoding from WithEncoding or smuggled into the url
+func (c *conn) validate() error {
+	if c.o.encoding != contracts.EncodingJSON {
+		return fmt.Errorf("%w: %s", ErrUnsupportedEncoding, c.o.encoding)
+	}
+	u, err := url.Parse(c.base)
+	if err != nil {
+		return err
+	}
+	if u.RawQuery != "" {
+		if enc := u.Query().Get("encoding"); enc != "" && enc != contracts.EncodingJSON.String() {
+			return fmt.Errorf("%w: %s in %s", ErrUnsupportedEncoding, enc, c.base)
+		}
+		return fmt.Errorf("gateway url %s has a query , pass scheme and host only", c.base)
+	}
+	return nil
+}
+
+func (c *conn) session(ctx context.Context) error {
+	u := c.base + c.path
+	if c.query != nil {
+		if q := c.query(); len(q) > 0 {
+			u += "?" + q.Encode()
+		}
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second, TLSClientConfig: c.o.tls, Proxy: http.ProxyFromEnvironment}
+	ws, resp, err := dialer.DialContext(ctx, u, c.o.header)
+	if err != nil {
+		if resp != nil {
+			return &DialError{Status: resp.StatusCode, Err: err}
+		}
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		ws.Close()
+		return errClosed
+	}
+	c.ws = ws
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.ws = nil
+		c.mu.Unlock()
+		ws.Close()
+	}()
+	// ctx ends the blocking read below
+	stopRead := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stopRead()
+
+	c.armDeadline(ws)
+	ws.SetPingHandler(func(data string) error {
+		c.armDeadline(ws)
+		err := ws.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(5*time.Second))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+	if c.ready != nil {
+		if err := c.ready(c.send); err != nil {
+			return err
+		}
+	}
+	if c.o.onConnect != nil {
+		c.o.onConnect()
+	}
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+		c.armDeadline(ws)
+		c.onFrame(data)
+	}
+}
+
+func (c *conn) armDeadline(ws *websocket.Conn) {
+	if c.o.readTimeout > 0 {
+		ws.SetReadDeadline(time.Now().Add(c.o.readTimeout))
+	}
+}
+
+// send writes a json request on the current connection , ErrNotConnected between connections
+func (c *conn) send(v any) error {
+	if !c.pace.wait(c.stop) {
+		return errClosed
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ws == nil {
+		return ErrNotConnected
+	}
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.ws.WriteJSON(v)
+}
+
+func (c *conn) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// close stops run , safe to call more than once
+func (c *conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	close(c.stop)
+	if c.ws != nil {
+		c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		c.ws.Close()
+	}
+}
+
+// ErrNotConnected is returned by requests made while the client is between connections ,
+// subscriptions are still recorded and sent on the next connection
+var ErrNotConnected = errors.New("not connected")
+
+// ErrUnsupportedEncoding is returned by Run for anything but json , see WithEncoding
+var ErrUnsupportedEncoding = errors.New("encoding not supported by the sdk , it parses json frames only")
+
+// DialError is a refused upgrade , 401/403 from authentication , 429 from connection limits
+type DialError struct {
+	Status int
+	Err    error
+}
+
+func (e *DialError) Error() string {
+	return e.Err.Error() + " (http " + http.StatusText(e.Status) + ")"
+}
+func (e *DialError) Unwrap() error { return e.Err }
+
+// 50% to 100% of d so a restarted gateway is not hit by every client at once
+func jitter(d time.Duration) time.Duration {
+	return d/2 + rand.N(d/2+1)
+}
+
+// goAwayHint reads the reconnect hint of a 1001 close , "server shutting down, reconnect after 1s"
+func goAwayHint(err error) time.Duration {
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.CloseGoingAway {
+		return 0
+	}
+	_, after, ok := strings.Cut(ce.Text, "reconnect after ")
+	if !ok {
+		return 0
+	}
+	d, err := time.ParseDuration(after)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// pacer is a token bucket that waits instead of refusing , kept as the time the next request is due (gcra)
+type pacer struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	tolerance time.Duration // burst-1 intervals
+	due       time.Time
+}
+
+func newPacer(perSecond, burst int) *pacer {
+	if perSecond <= 0 {
+		return nil
+	}
+	interval := time.Second / time.Duration(perSecond)
+	return &pacer{interval: interval, tolerance: time.Duration(max(burst-1, 0)) * interval}
+}
+
+// wait returns false when stop closed first
+func (p *pacer) wait(stop <-chan struct{}) bool {
+	if p == nil {
+		return true
+	}
+	p.mu.Lock()
+	now := time.Now()
+	due := p.due
+	if due.Before(now) {
+		due = now
+	}
+	at := due.Add(-p.tolerance)
+	p.due = due.Add(p.interval)
+	p.mu.Unlock()
+	if d := time.Until(at); d > 0 {
+		select {
+		case <-time.After(d):
+		case <-stop:
+			return false
+		}
+	}
+	return true
+}
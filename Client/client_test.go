@@ -0,0 +1,41 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	contracts "exchange/Contracts"
+)
+
+// nothing listens on the url , Run has to refuse before it dials or it would redial until the timeout
+func TestRunRefusesBinaryEncodings(t *testing.T) {
+	const base = "ws://127.0.0.1:1"
+	for _, tc := range []struct {
+		name string
+		run  func(ctx context.Context) error
+	}{
+		{"market data msgpack", NewMarketData(base, WithEncoding(contracts.EncodingMsgPack)).Run},
+		{"market data protobuf", NewMarketData(base, WithEncoding(contracts.EncodingProtobuf)).Run},
+		{"order events sbe", NewOrderEvents(base, WithEncoding(contracts.EncodingSBE)).Run},
+		{"encoding in the url", NewMarketData(base + "?encoding=sbe").Run},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := tc.run(ctx); !errors.Is(err, ErrUnsupportedEncoding) {
+				t.Fatalf("Run returned %v , want %v", err, ErrUnsupportedEncoding)
+			}
+		})
+	}
+}
+
+func TestRunRefusesUrlWithQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := NewOrderEvents("ws://127.0.0.1:1?tier=pro").Run(ctx)
+	if err == nil || errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run returned %v , want the url refused", err)
+	}
+}
@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	contracts "exchange/Contracts"
+	"sync"
+)
+
+// MarketData is a /ws/marketData connection that survives disconnects , subscriptions are kept here
+// and sent again on every new connection , messages published while it was down are not replayed
+type MarketData struct {
+	c *conn
+
+	mu       sync.Mutex
+	subs     map[string]func(json.RawMessage) error // stream -> decode and call back
+	nextID   int
+	onStatus func(contracts.SystemStatusData)
+	onError  func(contracts.ErrorMessage)
+	onDecode func(stream string, err error)
+}
+
+func NewMarketData(base string, opts ...Option) *MarketData {
+	md := &MarketData{subs: make(map[string]func(json.RawMessage) error)}
+	md.c = newConn(base, "/ws/marketData", opts)
+	md.c.ready = md.resubscribe
+	md.c.onFrame = md.frame
+	return md
+}
+
+// Run connects and reconnects until ctx is done or Close is called , it returns nil after Close
+func (md *MarketData) Run(ctx context.Context) error {
+	return md.c.run(ctx)
+}
+
+func (md *MarketData) Close() {
+	md.c.close()
+}
+
+func (md *MarketData) Depth(stream string, fn func(contracts.DepthData)) error {
+	return md.subscribe(stream, decoder(fn))
+}
+
+func (md *MarketData) BookTicker(stream string, fn func(contracts.BookTickerData)) error {
+	return md.subscribe(stream, decoder(fn))
+}
+
+func (md *MarketData) Trades(stream string, fn func(contracts.TradeData)) error {
+	return md.subscribe(stream, decoder(fn))
+}
+
+func (md *MarketData) Ticker(stream string, fn func(contracts.TickerData)) error {
+	return md.subscribe(stream, decoder(fn))
+}
+
+// Unsubscribe forgets the stream , it is not sent again after a reconnect
+func (md *MarketData) Unsubscribe(stream string) error {
+	md.mu.Lock()
+	delete(md.subs, stream)
+	md.nextID++
+	id := md.nextID
+	md.mu.Unlock()
+	return notConnectedIsFine(md.c.send(contracts.MessageFromUser{Method: contracts.UNSUBSCRIBE, Params: []string{stream}, ID: id}))
+}
+
+// OnSystemStatus receives the notices every market data connection gets , halts , maintenance and restarts
+func (md *MarketData) OnSystemStatus(fn func(contracts.SystemStatusData)) {
+	md.mu.Lock()
+	md.onStatus = fn
+	md.mu.Unlock()
+}
+
+// OnError receives refused requests , rate_limited or too_many_streams
+func (md *MarketData) OnError(fn func(contracts.ErrorMessage)) {
+	md.mu.Lock()
+	md.onError = fn
+	md.mu.Unlock()
+}
+
+// OnDecodeError is called for stream messages that do not fit the type their callback expects
+func (md *MarketData) OnDecodeError(fn func(stream string, err error)) {
+	md.mu.Lock()
+	md.onDecode = fn
+	md.mu.Unlock()
+}
+
+// subscribe replaces the handler of a stream , the request is sent now or with the next connection
+func (md *MarketData) subscribe(stream string, h func(json.RawMessage) error) error {
+	md.mu.Lock()
+	_, had := md.subs[stream]
+	md.subs[stream] = h
+	md.nextID++
+	id := md.nextID
+	md.mu.Unlock()
+	if had {
+		return nil
+	}
+	return notConnectedIsFine(md.c.send(contracts.MessageFromUser{Method: contracts.SUBSCRIBE, Params: []string{stream}, ID: id}))
+}
+
+func (md *MarketData) resubscribe(send func(any) error) error {
+	md.mu.Lock()
+	streams := make([]string, 0, len(md.subs))
+	for s := range md.subs {
+		streams = append(streams, s)
+	}
+	md.mu.Unlock()
+	for _, s := range streams {
+		md.mu.Lock()
+		md.nextID++
+		id := md.nextID
+		md.mu.Unlock()
+		if err := send(contracts.MessageFromUser{Method: contracts.SUBSCRIBE, Params: []string{s}, ID: id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// one frame is a stream message , a notice , an error or a pong , only the first has a "stream"
+func (md *MarketData) frame(data []byte) {
+	var f struct {
+		contracts.MessageFromPubSubForUser
+		Error *contracts.ErrorBody `json:"error"`
+		ID    int                  `json:"id"`
+	}
+	if json.Unmarshal(data, &f) != nil {
+		return
+	}
+	md.mu.Lock()
+	h := md.subs[f.Stream]
+	onStatus, onError, onDecode := md.onStatus, md.onError, md.onDecode
+	md.mu.Unlock()
+
+	switch {
+	case f.Stream == contracts.SystemStream:
+		var st contracts.SystemStatusData
+		if onStatus != nil && json.Unmarshal(f.Data, &st) == nil {
+			onStatus(st)
+		}
+	case f.Stream != "":
+		if h == nil {
+			return // unsubscribed , the gateway may still have a few in flight
+		}
+		if err := h(f.Data); err != nil && onDecode != nil {
+			onDecode(f.Stream, err)
+		}
+	case f.Error != nil:
+		if onError != nil {
+			onError(contracts.ErrorMessage{ID: f.ID, Error: *f.Error})
+		}
+	}
+}
+
+func decoder[T any](fn func(T)) func(json.RawMessage) error {
+	return func(data json.RawMessage) error {
+		var v T
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		fn(v)
+		return nil
+	}
+}
+
+// requests between connections are sent by the next resubscribe
+func notConnectedIsFine(err error) error {
+	if err == ErrNotConnected {
+		return nil
+	}
+	return err
+}
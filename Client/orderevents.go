@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	contracts "exchange/Contracts"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+// OrderEvents is a /ws/OrderEvents connection that survives disconnects , every new connection asks to resume
+// after the last seq delivered , so events sent while it was down arrive once and in order if the gateway still had them
+// when it did not (gateway restart , resume_buffer overrun , resume_window passed) OnGap is called and delivery
+// goes on from the live events , the engine is the place to resync open orders from then
+type OrderEvents struct {
+	c *conn
+
+	mu       sync.Mutex
+	epoch    uint64 // 0 until the first session frame
+	seq      uint64 // last seq delivered
+	onEvent  func(contracts.SequencedOrderEvent)
+	onGap    func(contracts.OrderEventsSessionData)
+	onStatus func(contracts.SystemStatusData)
+}
+
+func NewOrderEvents(base string, opts ...Option) *OrderEvents {
+	oe := &OrderEvents{}
+	oe.c = newConn(base, "/ws/OrderEvents", opts)
+	oe.c.query = oe.query
+	oe.c.onFrame = oe.frame
+	return oe
+}
+
+// Run connects and reconnects until ctx is done or Close is called , it returns nil after Close
+func (oe *OrderEvents) Run(ctx context.Context) error {
+	return oe.c.run(ctx)
+}
+
+func (oe *OrderEvents) Close() {
+	oe.c.close()
+}
+
+func (oe *OrderEvents) OnEvent(fn func(contracts.SequencedOrderEvent)) {
+	oe.mu.Lock()
+	oe.onEvent = fn
+	oe.mu.Unlock()
+}
+
+// OnGap is called when a reconnect could not be resumed in full , some events before s.Seq are lost ,
+// whatever the gateway still kept follows as usual through OnEvent
+func (oe *OrderEvents) OnGap(fn func(s contracts.OrderEventsSessionData)) {
+	oe.mu.Lock()
+	oe.onGap = fn
+	oe.mu.Unlock()
+}
+
+// OnSystemStatus receives the system notices , halts , maintenance and the restart before the gateway goes away
+func (oe *OrderEvents) OnSystemStatus(fn func(contracts.SystemStatusData)) {
+	oe.mu.Lock()
+	oe.onStatus = fn
+	oe.mu.Unlock()
+}
+
+// Position is where the next connection resumes from , epoch 0 before the first connection
+func (oe *OrderEvents) Position() (epoch, seq uint64) {
+	oe.mu.Lock()
+	defer oe.mu.Unlock()
+	return oe.epoch, oe.seq
+}
+
+func (oe *OrderEvents) query() url.Values {
+	oe.mu.Lock()
+	defer oe.mu.Unlock()
+	if oe.epoch == 0 {
+		return nil
+	}
+	return url.Values{
+		"since": {strconv.FormatUint(oe.seq, 10)},
+		"epoch": {strconv.FormatUint(oe.epoch, 10)},
+	}
+}
+
+// one frame is the session frame , an order event , a system notice or a pong , told apart by their keys
+// the notice is the bare systemStatus object here , not wrapped in a stream message like on market data
+func (oe *OrderEvents) frame(data []byte) {
+	var probe struct {
+		Event   string  `json:"e"`
+		Time    int64   `json:"E"` // only here so "E" is not taken for "e" , json matches keys case insensitively
+		OrderId *uint64 `json:"OrderId"`
+	}
+	if json.Unmarshal(data, &probe) != nil {
+		return
+	}
+	switch {
+	case probe.Event == "session":
+		var s contracts.OrderEventsSessionData
+		if json.Unmarshal(data, &s) == nil {
+			oe.session(s)
+		}
+	case probe.OrderId != nil:
+		var ev contracts.SequencedOrderEvent
+		if json.Unmarshal(data, &ev) == nil {
+			oe.event(ev)
+		}
+	case probe.Event == "systemStatus":
+		var st contracts.SystemStatusData
+		oe.mu.Lock()
+		onStatus := oe.onStatus
+		oe.mu.Unlock()
+		if onStatus != nil && json.Unmarshal(data, &st) == nil {
+			onStatus(st)
+		}
+	}
+}
+
+func (oe *OrderEvents) session(s contracts.OrderEventsSessionData) {
+	oe.mu.Lock()
+	// a new epoch means the numbering started over , anything we had is gone even if the gateway did not say so
+	gap := oe.epoch != 0 && (s.Gap || s.Epoch != oe.epoch)
+	switch {
+	case oe.epoch == 0:
+		oe.seq = s.Seq // nothing asked for , live events continue after this
+	case gap:
+		oe.seq = 0 // the gateway replays what it still has , oldest first , take all of it
+	}
+	oe.epoch = s.Epoch
+	onGap := oe.onGap
+	oe.mu.Unlock()
+	if gap && onGap != nil {
+		onGap(s)
+	}
+}
+
+func (oe *OrderEvents) event(ev contracts.SequencedOrderEvent) {
+	oe.mu.Lock()
+	if ev.Seq != 0 && ev.Seq <= oe.seq {
+		oe.mu.Unlock()
+		return // replayed twice , a resume raced with a live event
+	}
+	if ev.Seq > oe.seq {
+		oe.seq = ev.Seq
+	}
+	onEvent := oe.onEvent
+	oe.mu.Unlock()
+	if onEvent != nil {
+		onEvent(ev)
+	}
+}
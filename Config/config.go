@@ -0,0 +1,485 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logging "exchange/Logging"
+	shm "exchange/Shm"
+
+	"gopkg.in/yaml.v3"
+)
+
+// typed configuration for one gateway instance
+// precedence : defaults < yaml file < GATEWAY_* environment < command line flags
+// every leaf field is addressed by its yaml path , e.g. server.addr is GATEWAY_SERVER_ADDR and -server.addr
+
+const EnvPrefix = "GATEWAY_"
+
+// the symbol manager tracks the shards of a connection in a 64 bit mask
+const MaxSymbolManagerShards = 64
+
+type ShmConfig struct {
+	Dir              string `yaml:"dir"`         // ring file names below are relative to this directory
+	LayoutFile       string `yaml:"layout_file"` // descriptor written by the engine , see shm.VerifyLayoutFile
+	BalanceResponse  string `yaml:"balance_response"`
+	CancelOrders     string `yaml:"cancel_orders"`
+	HoldingsResponse string `yaml:"holdings_response"`
+	OrderEvents      string `yaml:"order_events"`
+	PostOrders       string `yaml:"post_orders"`
+	Queries          string `yaml:"queries"`
+	WaitStrategy     string `yaml:"wait_strategy"` // spin , yield , sleep or doorbell
+}
+
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	ReconnectAfter    time.Duration `yaml:"reconnect_after"`         // hint sent to clients in the 1001 close frame
+	SendBufferSize    int           `yaml:"send_buffer_size"`        // per connection order event buffer
+	AdminToken        string        `yaml:"admin_token"`             // bearer token for /admin , empty disables the admin api
+	TrustForwardedFor bool          `yaml:"trust_forwarded_for"`     // take the client ip from X-Forwarded-For , only behind a proxy that sets it
+	PingInterval      time.Duration `yaml:"ping_interval"`           // websocket ping to every client
+	PongTimeout       time.Duration `yaml:"pong_timeout"`            // read deadline , extended by every pong and message
+	WriteTimeout      time.Duration `yaml:"write_timeout"`           // order event writes and control frames
+	MaxLifetime       time.Duration `yaml:"max_lifetime"`            // connections are closed with 1001 after this , 0 keeps them forever
+	LifetimeWarning   time.Duration `yaml:"lifetime_warning"`        // how long before max_lifetime the connectionExpiring frame goes out
+	AllowedOrigins    []string      `yaml:"allowed_origins"`         // browser origins allowed to upgrade , empty means same origin only , "*" any
+	MdReadLimit       int64         `yaml:"market_data_read_limit"`  // largest frame a market data client may send , bigger ones close with 1009
+	OeReadLimit       int64         `yaml:"order_events_read_limit"` // order event clients only send PING
+	Compression       bool          `yaml:"compression"`             // negotiate permessage-deflate on market data , see symbol_manager.compression_threshold
+	CompressionLevel  int           `yaml:"compression_level"`       // flate level , 1 is fastest , 9 smallest , -2 huffman only
+	DevUser           uint64        `yaml:"dev_user"`                // dev only , order events connections nobody authenticated get this user while no authenticator is set , 0 refuses them
+	TLS               TLSConfig     `yaml:"tls"`
+}
+
+// TLS is off while cert_file is empty
+type TLSConfig struct {
+	CertFile          string            `yaml:"cert_file"`
+	KeyFile           string            `yaml:"key_file"`
+	ReloadInterval    time.Duration     `yaml:"reload_interval"`     // how often handshakes look for a renewed cert and key on disk
+	ClientCAFile      string            `yaml:"client_ca_file"`      // enables client certificates , verified when a client sends one
+	RequireClientCert bool              `yaml:"require_client_cert"` // refuse handshakes without a client certificate
+	ClientCertUsers   map[string]uint64 `yaml:"client_cert_users"`   // yaml only , client certificate common name -> order events user id
+}
+
+type RedisConfig struct {
+	Addr        string        `yaml:"addr"`
+	Password    string        `yaml:"password"`
+	DB          int           `yaml:"db"`
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+}
+
+type SymbolManagerConfig struct {
+	Shards               int           `yaml:"shards"`                // streams are split over this many manager loops , 0 is one per cpu
+	CommandChanSize      int           `yaml:"command_chan_size"`     // per shard
+	WriteTimeout         time.Duration `yaml:"write_timeout"`         // a market data write blocked this long fails and drops the frame
+	CompressionThreshold int           `yaml:"compression_threshold"` // bytes , smaller frames are never compressed
+}
+
+type HubConfig struct {
+	RegisterChanSize  int           `yaml:"register_chan_size"`
+	BroadcastChanSize int           `yaml:"broadcast_chan_size"`
+	ResumeBuffer      int           `yaml:"resume_buffer"` // order events kept per user for ?since= resumes , 0 disables resuming
+	ResumeWindow      time.Duration `yaml:"resume_window"` // how long a user's events are kept after their last connection closed
+}
+
+// recording is off while dir is empty , see Recorder
+type RecordConfig struct {
+	Dir            string        `yaml:"dir"`             // recording-*.jsonl files go here , created if missing
+	MaxFileSize    int64         `yaml:"max_file_size"`   // bytes , a file this big is closed and a new one started
+	RotateInterval time.Duration `yaml:"rotate_interval"` // a file this old is closed too , 0 rotates on size only
+	MaxFiles       int           `yaml:"max_files"`       // older files are deleted , 0 keeps every file
+	BufferSize     int           `yaml:"buffer_size"`     // records queued for the writer , more are dropped and counted
+	FlushInterval  time.Duration `yaml:"flush_interval"`  // buffered records reach the file at least this often
+}
+
+type LogConfig struct {
+	Level          string        `yaml:"level"`           // debug , info , warn or error , changeable at runtime on /admin/log-level
+	Format         string        `yaml:"format"`          // json or text
+	SampleInterval time.Duration `yaml:"sample_interval"` // hot path lines are let through once per interval , 0 logs every one
+}
+
+type HealthConfig struct {
+	CheckTimeout   time.Duration `yaml:"check_timeout"`    // budget for all /readyz checks together
+	RingStallAfter time.Duration `yaml:"ring_stall_after"` // a ring with entries waiting and no consumer progress for this long is not ready
+}
+
+// zero means unlimited for every field
+type TierLimits struct {
+	MessagesPerSecond int `yaml:"messages_per_second"` // inbound messages per connection , token bucket refill
+	MessageBurst      int `yaml:"message_burst"`       // token bucket size , defaults to messages_per_second
+	MaxStreams        int `yaml:"max_streams"`         // market data subscriptions per connection
+	MaxConnsPerIP     int `yaml:"max_conns_per_ip"`
+	MaxConnsPerUser   int `yaml:"max_conns_per_user"` // order event connections per user
+}
+
+type LimitsConfig struct {
+	Default             TierLimits            `yaml:"default"`                // connections without a known api key
+	Tiers               map[string]TierLimits `yaml:"tiers"`                  // yaml only , replaces default for keys mapped to the tier
+	APIKeys             map[string]string     `yaml:"api_keys"`               // yaml only , api key -> tier name
+	IPMessagesPerSecond int                   `yaml:"ip_messages_per_second"` // inbound messages across all connections of one ip
+	IPMessageBurst      int                   `yaml:"ip_message_burst"`
+	MaxViolations       int                   `yaml:"max_violations"` // rejected messages in a row before the connection is closed
+}
+
+type Config struct {
+	Shm           ShmConfig           `yaml:"shm"`
+	Server        ServerConfig        `yaml:"server"`
+	Redis         RedisConfig         `yaml:"redis"`
+	SymbolManager SymbolManagerConfig `yaml:"symbol_manager"`
+	Hub           HubConfig           `yaml:"hub"`
+	Record        RecordConfig        `yaml:"record"`
+	Log           LogConfig           `yaml:"log"`
+	Health        HealthConfig        `yaml:"health"`
+	Limits        LimitsConfig        `yaml:"limits"`
+}
+
+// Default matches what main.go used to hard code
+func Default() *Config {
+	return &Config{
+		Shm: ShmConfig{
+			Dir:              "/tmp/trading",
+			LayoutFile:       "layout.json",
+			BalanceResponse:  "BalanceResponse",
+			CancelOrders:     "CancelOrders",
+			HoldingsResponse: "HoldingsResponse",
+			OrderEvents:      "OrderEvents",
+			PostOrders:       "IncomingOrdersForMe",
+			Queries:          "Queries",
+			WaitStrategy:     "sleep",
+		},
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 10 * time.Second,
+			ShutdownTimeout:   10 * time.Second,
+			ReconnectAfter:    time.Second,
+			SendBufferSize:    256,
+			PingInterval:      20 * time.Second,
+			PongTimeout:       60 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			MaxLifetime:       24 * time.Hour,
+			LifetimeWarning:   5 * time.Minute,
+			MdReadLimit:       4096,
+			OeReadLimit:       512,
+			Compression:       true,
+			CompressionLevel:  1,
+			TLS: TLSConfig{
+				ReloadInterval: time.Minute,
+			},
+		},
+		Redis: RedisConfig{
+			Addr:        "localhost:6379",
+			DialTimeout: 5 * time.Second,
+		},
+		SymbolManager: SymbolManagerConfig{
+			CommandChanSize:      1000,
+			WriteTimeout:         5 * time.Second,
+			CompressionThreshold: 512,
+		},
+		Hub: HubConfig{
+			RegisterChanSize:  256,
+			BroadcastChanSize: 10000,
+			ResumeBuffer:      128,
+			ResumeWindow:      time.Minute,
+		},
+		Record: RecordConfig{
+			MaxFileSize:    256 << 20,
+			RotateInterval: time.Hour,
+			MaxFiles:       48,
+			BufferSize:     65536,
+			FlushInterval:  time.Second,
+		},
+		Log: LogConfig{
+			Level:          "info",
+			Format:         logging.FormatJSON,
+			SampleInterval: time.Second,
+		},
+		Health: HealthConfig{
+			CheckTimeout:   2 * time.Second,
+			RingStallAfter: 5 * time.Second,
+		},
+		Limits: LimitsConfig{
+			Default: TierLimits{
+				MessagesPerSecond: 10,
+				MessageBurst:      20,
+				MaxStreams:        50,
+				MaxConnsPerIP:     50,
+				MaxConnsPerUser:   10,
+			},
+			IPMessagesPerSecond: 100,
+			IPMessageBurst:      200,
+			MaxViolations:       20,
+		},
+	}
+}
+
+// ShmPath resolves a ring file name against Shm.Dir
+func (c *Config) ShmPath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(c.Shm.Dir, name)
+}
+
+// Load builds the config from args (usually os.Args[1:]) and the environment and validates it
+// -config points at the yaml file , it is optional
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("gateway", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(EnvPrefix+"CONFIG"), "path to the yaml config file")
+	leaves := fieldsOf(cfg)
+	flagValues := make(map[string]*string)
+	for _, l := range leaves {
+		flagValues[l.path] = fs.String(l.path, "", fmt.Sprintf("overrides %s (env %s)", l.path, l.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", *configPath, err)
+		}
+	}
+
+	for _, l := range leaves {
+		if v, ok := os.LookupEnv(l.env); ok {
+			if err := setField(l.value, v); err != nil {
+				return nil, fmt.Errorf("env %s: %w", l.env, err)
+			}
+		}
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, l := range leaves {
+		if set[l.path] {
+			if err := setField(l.value, *flagValues[l.path]); err != nil {
+				return nil, fmt.Errorf("flag -%s: %w", l.path, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every problem at once so a broken deploy is fixed in one go
+func (c *Config) Validate() error {
+	errs := []error{}
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Shm.Dir != "", "shm.dir must not be empty")
+	for _, f := range []struct{ name, value string }{
+		{"shm.layout_file", c.Shm.LayoutFile},
+		{"shm.balance_response", c.Shm.BalanceResponse},
+		{"shm.cancel_orders", c.Shm.CancelOrders},
+		{"shm.holdings_response", c.Shm.HoldingsResponse},
+		{"shm.order_events", c.Shm.OrderEvents},
+		{"shm.post_orders", c.Shm.PostOrders},
+		{"shm.queries", c.Shm.Queries},
+	} {
+		check(f.value != "", "%s must not be empty", f.name)
+	}
+	if _, err := shm.ParseWaitStrategy(c.Shm.WaitStrategy); err != nil {
+		errs = append(errs, fmt.Errorf("shm.wait_strategy: %w", err))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("server.addr %q: %w", c.Server.Addr, err))
+	}
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.ReconnectAfter >= 0, "server.reconnect_after must not be negative")
+	check(c.Server.SendBufferSize > 0, "server.send_buffer_size must be positive")
+	check(c.Server.PingInterval > 0, "server.ping_interval must be positive")
+	check(c.Server.PongTimeout > c.Server.PingInterval, "server.pong_timeout must be longer than server.ping_interval")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.MaxLifetime >= 0, "server.max_lifetime must not be negative")
+	check(c.Server.LifetimeWarning >= 0 && (c.Server.MaxLifetime == 0 || c.Server.LifetimeWarning < c.Server.MaxLifetime),
+		"server.lifetime_warning must not be negative and must be shorter than server.max_lifetime")
+	for _, origin := range c.Server.AllowedOrigins {
+		check(origin == "*" || strings.Contains(origin, "://"), "server.allowed_origins entry %q must be \"*\" or scheme://host", origin)
+	}
+	check(c.Server.MdReadLimit > 0, "server.market_data_read_limit must be positive")
+	check(c.Server.OeReadLimit > 0, "server.order_events_read_limit must be positive")
+	check(c.Server.CompressionLevel >= -2 && c.Server.CompressionLevel <= 9, "server.compression_level must be between -2 and 9")
+	check((c.Server.TLS.CertFile == "") == (c.Server.TLS.KeyFile == ""), "server.tls.cert_file and server.tls.key_file must be set together")
+	check(c.Server.TLS.ReloadInterval > 0, "server.tls.reload_interval must be positive")
+	check(c.Server.TLS.ClientCAFile == "" || c.Server.TLS.CertFile != "", "server.tls.client_ca_file needs server.tls.cert_file")
+	check(!c.Server.TLS.RequireClientCert || c.Server.TLS.ClientCAFile != "", "server.tls.require_client_cert needs server.tls.client_ca_file")
+	check(len(c.Server.TLS.ClientCertUsers) == 0 || c.Server.TLS.ClientCAFile != "", "server.tls.client_cert_users needs server.tls.client_ca_file")
+	check(c.Server.DevUser == 0 || c.Server.TLS.ClientCAFile == "", "server.dev_user is for development , it cannot be combined with server.tls.client_ca_file")
+
+	if _, _, err := net.SplitHostPort(c.Redis.Addr); err != nil {
+		errs = append(errs, fmt.Errorf("redis.addr %q: %w", c.Redis.Addr, err))
+	}
+	check(c.Redis.DB >= 0, "redis.db must not be negative")
+	check(c.Redis.DialTimeout > 0, "redis.dial_timeout must be positive")
+
+	check(c.SymbolManager.Shards >= 0 && c.SymbolManager.Shards <= MaxSymbolManagerShards, "symbol_manager.shards must be between 0 and %d", MaxSymbolManagerShards)
+	check(c.SymbolManager.CommandChanSize > 0, "symbol_manager.command_chan_size must be positive")
+	check(c.SymbolManager.WriteTimeout > 0, "symbol_manager.write_timeout must be positive")
+	check(c.SymbolManager.CompressionThreshold >= 0, "symbol_manager.compression_threshold must not be negative")
+	check(c.Hub.RegisterChanSize > 0, "hub.register_chan_size must be positive")
+	check(c.Hub.BroadcastChanSize > 0, "hub.broadcast_chan_size must be positive")
+	check(c.Hub.ResumeBuffer >= 0, "hub.resume_buffer must not be negative")
+	// a replay goes through the send buffer in one go , right behind the session frame
+	check(c.Hub.ResumeBuffer < c.Server.SendBufferSize, "hub.resume_buffer must be smaller than server.send_buffer_size")
+	check(c.Hub.ResumeWindow >= 0, "hub.resume_window must not be negative")
+
+	check(c.Record.MaxFileSize > 0, "record.max_file_size must be positive")
+	check(c.Record.RotateInterval >= 0, "record.rotate_interval must not be negative")
+	check(c.Record.MaxFiles >= 0, "record.max_files must not be negative")
+	check(c.Record.BufferSize > 0, "record.buffer_size must be positive")
+	check(c.Record.FlushInterval > 0, "record.flush_interval must be positive")
+
+	if _, err := logging.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level: %w", err))
+	}
+	if _, err := logging.ParseFormat(c.Log.Format); err != nil {
+		errs = append(errs, fmt.Errorf("log.format: %w", err))
+	}
+	check(c.Log.SampleInterval >= 0, "log.sample_interval must not be negative")
+
+	check(c.Health.CheckTimeout > 0, "health.check_timeout must be positive")
+	check(c.Health.RingStallAfter > 0, "health.ring_stall_after must be positive")
+
+	checkTier := func(name string, t TierLimits) {
+		check(t.MessagesPerSecond >= 0 && t.MessageBurst >= 0 && t.MaxStreams >= 0 &&
+			t.MaxConnsPerIP >= 0 && t.MaxConnsPerUser >= 0, "%s limits must not be negative", name)
+	}
+	checkTier("limits.default", c.Limits.Default)
+	tiers := make([]string, 0, len(c.Limits.Tiers))
+	for name := range c.Limits.Tiers {
+		tiers = append(tiers, name)
+	}
+	sort.Strings(tiers)
+	for _, name := range tiers {
+		checkTier("limits.tiers."+name, c.Limits.Tiers[name])
+	}
+	keys := make([]string, 0, len(c.Limits.APIKeys))
+	for key := range c.Limits.APIKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		_, ok := c.Limits.Tiers[c.Limits.APIKeys[key]]
+		check(ok, "limits.api_keys maps a key to unknown tier %q", c.Limits.APIKeys[key])
+	}
+	check(c.Limits.IPMessagesPerSecond >= 0 && c.Limits.IPMessageBurst >= 0, "limits.ip_* must not be negative")
+	check(c.Limits.MaxViolations >= 0, "limits.max_violations must not be negative")
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+type leaf struct {
+	path  string // server.addr
+	env   string // GATEWAY_SERVER_ADDR
+	value reflect.Value
+}
+
+func fieldsOf(cfg *Config) []leaf {
+	return walk(reflect.ValueOf(cfg).Elem(), "")
+}
+
+func walk(v reflect.Value, prefix string) []leaf {
+	leaves := []leaf{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		path := prefix + name
+		fv := v.Field(i)
+		if fv.Kind() == reflect.Map {
+			continue // maps only come from the yaml file
+		}
+		if fv.Kind() == reflect.Struct {
+			leaves = append(leaves, walk(fv, path+".")...)
+			continue
+		}
+		leaves = append(leaves, leaf{
+			path:  path,
+			env:   EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_")),
+			value: fv,
+		})
+	}
+	return leaves
+}
+
+func setField(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported config field type %s", v.Type())
+		}
+		// comma separated in env and flags , a list in yaml
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported config field type %s", v.Type())
+	}
+	return nil
+}
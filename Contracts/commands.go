@@ -2,7 +2,13 @@ package contracts
 
 
 
-import "github.com/gorilla/websocket"
+import (
+    "encoding/json"
+    "sync"
+    "sync/atomic"
+
+    "github.com/gorilla/websocket"
+)
 
 
 
@@ -14,6 +20,9 @@ type Command interface {
 type SubscribeCommand struct {
     StreamName  string             
     Conn *websocket.Conn
+    BytesSent *atomic.Uint64 // optional , counts what the manager writes to Conn
+    Encoding Encoding // what the connection asked for at connect time
+    WriteLock *sync.Mutex // one per connection , shared by every shard writing to Conn
 }
 func ( SubscribeCommand) isCommand(){}
 // User unsubscribes from a stream
@@ -25,7 +34,9 @@ func ( UnsubscribeCommand) isCommand(){}
 // Broadcast data to all subscribers of a stream
 type BroadcastCommand struct {
     StreamName string 
-    Data   []byte  
+    Data   []byte  // json envelope , what json connections get
+    Payload json.RawMessage // the stream message inside the envelope , re encoded for binary connections
+    Retain bool // keep the message and send it to later subscribers of the stream , used for the system stream
 }
 func (BroadcastCommand) isCommand(){}
 
@@ -33,3 +44,24 @@ type CleanupConnectionCommand struct {
     Conn *websocket.Conn
 }
 func ( CleanupConnectionCommand) isCommand(){}
+
+// a message for one connection only , e.g. an error reply , written by the manager so it never races a broadcast
+type ReplyCommand struct {
+    Conn *websocket.Conn
+    Data []byte // already in the connection encoding
+    Encoding Encoding
+    WriteLock *sync.Mutex
+}
+func ( ReplyCommand) isCommand(){}
+
+// readiness probe , the manager closes Reply when it reaches the command
+type PingCommand struct {
+    Reply chan struct{}
+}
+func ( PingCommand) isCommand(){}
+
+// admin view , the manager sends the subscriber count of every stream on Reply
+type StreamStatsCommand struct {
+    Reply chan map[string]int
+}
+func ( StreamStatsCommand) isCommand(){}
@@ -0,0 +1,37 @@
+package contracts
+
+import "fmt"
+
+// wire encoding of everything the gateway sends on a connection , picked with ?encoding= at connect time
+// requests from the client stay json text in every encoding , see Wire for the encoders
+type Encoding uint8
+
+const (
+	EncodingJSON     Encoding = iota // text frames , the default
+	EncodingMsgPack                  // binary frames , same keys as json
+	EncodingProtobuf                 // binary frames , one Frame message per frame , see Wire/gateway.proto
+	EncodingSBE                      // binary frames , fixed layout , see Wire/sbe.xml
+
+	EncodingCount // number of encodings , for per encoding caches
+)
+
+var encodingNames = [EncodingCount]string{"json", "msgpack", "protobuf", "sbe"}
+
+func ParseEncoding(s string) (Encoding, error) {
+	if s == "" {
+		return EncodingJSON, nil
+	}
+	for i, name := range encodingNames {
+		if s == name {
+			return Encoding(i), nil
+		}
+	}
+	return EncodingJSON, fmt.Errorf("unknown encoding %q , want json , msgpack , protobuf or sbe", s)
+}
+
+func (e Encoding) String() string {
+	if e < EncodingCount {
+		return encodingNames[e]
+	}
+	return fmt.Sprintf("encoding(%d)", uint8(e))
+}
@@ -3,12 +3,17 @@ package contracts
 
 
 // For SymbolManager to call PubSubManager so subscriptons to pub sub can be managed 
+// the manager passes itself as to , so the pubsub side never needs a pointer back to it
 type SubscriberToPubSub interface{
-	SubscribeToSymbolMethod(StreamName string)
+	SubscribeToSymbolMethod(StreamName string, to BroadCasterForPubSub)
 }
 type UnSubscriberToPubSub interface {
 	UnSubscribeToSymbolMethod(StreamName string)
 }
+type UpstreamPubSub interface {
+	SubscriberToPubSub
+	UnSubscriberToPubSub
+}
 
 // for pubsusb manager to call of symbol manager 
 type BroadCasterForPubSub interface {
@@ -2,11 +2,13 @@ package contracts
 
 import (
 	"encoding/json"
+	shm "exchange/Shm"
 )
 type Method string
 const (
 	SUBSCRIBE 	Method = "SUBSCRIBE"
 	UNSUBSCRIBE Method = "UNSUBSCRIBE"
+	PING 		Method = "PING" // application level ping for clients that cannot see websocket pings
 )
 
 type MessageFromUser struct {
@@ -65,4 +67,82 @@ type TickerData struct {
     EventTime int64  `json:"E"`
     Price     uint64 `json:"p"`  // Last traded price 
     // can add volume and other fields 
-}
\ No newline at end of file
+}
+// stream every market data connection is put on when it connects , see SystemStatusData
+const SystemStream = "!system"
+
+type SystemStatus string
+const (
+    SystemNormal      SystemStatus = "normal"      // all clear , ends an earlier notice
+    SystemTradingHalt SystemStatus = "tradingHalt" // matching stopped for Symbols (all when empty)
+    SystemMaintenance SystemStatus = "maintenance" // planned window between StartsAt and EndsAt
+    SystemRestart     SystemStatus = "restart"     // gateway restarting , expect a 1001 close
+)
+
+func (s SystemStatus) Valid() bool {
+    switch s {
+    case SystemNormal, SystemTradingHalt, SystemMaintenance, SystemRestart:
+        return true
+    }
+    return false
+}
+
+// server initiated notice , pushed to every market data and order events connection
+type SystemStatusData struct {
+    Event     string       `json:"e"`                  // "systemStatus"
+    EventTime int64        `json:"E"`                  // Millisecond timestamp
+    Status    SystemStatus `json:"status"`
+    Message   string       `json:"message,omitempty"`
+    Symbols   []uint32     `json:"symbols,omitempty"`  // affected symbols , empty means every symbol
+    StartsAt  int64        `json:"startsAt,omitempty"` // Millisecond timestamp
+    EndsAt    int64        `json:"endsAt,omitempty"`   // Millisecond timestamp
+}
+
+// sent back on the connection when a request is refused
+type ErrorMessage struct {
+    ID    int       `json:"id,omitempty"` // ID of the refused request
+    Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+    Code string `json:"code"`
+    Msg  string `json:"msg"`
+}
+
+const (
+    ErrCodeRateLimited    = "rate_limited"
+    ErrCodeTooManyStreams = "too_many_streams"
+)
+
+// answer to a PING
+type PongMessage struct {
+    ID     int    `json:"id,omitempty"`
+    Result string `json:"result"` // "pong"
+    Time   int64  `json:"time"`   // server Millisecond timestamp
+}
+
+// sent once before the server closes a connection that reached its maximum lifetime
+type ConnectionExpiringData struct {
+    Event     string `json:"e"`       // "connectionExpiring"
+    EventTime int64  `json:"E"`
+    CloseAt   int64  `json:"closeAt"` // Millisecond timestamp , reconnect before this
+}
+
+// an order event as the order events endpoint sends it , Seq numbers the events of one user within an epoch
+// the json is the flat shm.OrderEvent with Seq added
+type SequencedOrderEvent struct {
+    shm.OrderEvent
+    Seq uint64
+}
+
+// first frame on every order events connection , the epoch changes when the gateway restarts and Seq starts over
+// Seq also starts over for a user who was gone longer than hub.resume_window , a resume from before then gets Gap
+// a connection that asked to resume with ?since=<seq>&epoch=<epoch> gets the events after since right behind it ,
+// Gap means some of them were not kept any more or the epoch did not match , the client has to resync then
+type OrderEventsSessionData struct {
+    Event     string `json:"e"`     // "session"
+    EventTime int64  `json:"E"`     // Millisecond timestamp
+    Epoch     uint64 `json:"epoch"`
+    Seq       uint64 `json:"seq"`   // latest seq of the user when the connection registered , a resume replays since+1 up to it
+    Gap       bool   `json:"gap"`
+}
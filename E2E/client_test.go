@@ -0,0 +1,178 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	contracts "exchange/Contracts"
+	shm "exchange/Shm"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client is a websocket client on one of the real endpoints , reads are only done when a scenario asks
+// so a client that is never read from is a slow consumer as far as the gateway can tell
+
+type Client struct {
+	conn   *websocket.Conn
+	nextID int
+}
+
+type ClientOption func(*dialOptions)
+
+type dialOptions struct {
+	readBuffer int // kernel receive buffer , 0 leaves the default
+	header     http.Header
+	encoding   string // ?encoding= , empty is json
+}
+
+// WithReadBuffer shrinks the socket receive buffer so an unread client backs up the gateway quickly
+func WithReadBuffer(bytes int) ClientOption {
+	return func(o *dialOptions) { o.readBuffer = bytes }
+}
+
+// WithEncoding connects with ?encoding=enc , frames then have to be decoded with Wire/wiretest
+func WithEncoding(enc string) ClientOption {
+	return func(o *dialOptions) { o.encoding = enc }
+}
+
+func (h *Harness) dial(path string, o dialOptions) (*Client, error) {
+	if o.encoding != "" {
+		path += "?encoding=" + o.encoding
+	}
+	dialer := websocket.Dialer{HandshakeTimeout: 5 * time.Second}
+	if o.readBuffer > 0 {
+		dialer.NetDialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			if tcp, ok := conn.(*net.TCPConn); ok {
+				tcp.SetReadBuffer(o.readBuffer)
+			}
+			return conn, nil
+		}
+	}
+	conn, resp, err := dialer.Dial(h.URL+path, o.header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("dial %s: %w (http %d)", path, err, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("dial %s: %w", path, err)
+	}
+	return &Client{conn: conn}, nil
+}
+
+func (h *Harness) MarketData(opts ...ClientOption) (*Client, error) {
+	var o dialOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return h.dial("/ws/marketData", o)
+}
+
+// OrderEvents connects as userID , see UserHeader
+func (h *Harness) OrderEvents(userID uint64, opts ...ClientOption) (*Client, error) {
+	o := dialOptions{header: http.Header{UserHeader: {strconv.FormatUint(userID, 10)}}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return h.dial("/ws/OrderEvents", o)
+}
+
+func (c *Client) send(method contracts.Method, params ...string) error {
+	c.nextID++
+	return c.conn.WriteJSON(contracts.MessageFromUser{Method: method, Params: params, ID: c.nextID})
+}
+
+func (c *Client) Subscribe(stream string) error {
+	return c.send(contracts.SUBSCRIBE, stream)
+}
+
+func (c *Client) Unsubscribe(stream string) error {
+	return c.send(contracts.UNSUBSCRIBE, stream)
+}
+
+// Next reads the next frame , whatever it is
+func (c *Client) Next(timeout time.Duration) ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(timeout))
+	_, data, err := c.conn.ReadMessage()
+	return data, err
+}
+
+// NextStream skips frames until one of stream arrives and returns its data , system notices are skipped too
+func (c *Client) NextStream(stream string, timeout time.Duration) (json.RawMessage, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := c.Next(time.Until(deadline))
+		if err != nil {
+			return nil, fmt.Errorf("waiting for %s: %w", stream, err)
+		}
+		var msg contracts.MessageFromPubSubForUser
+		if json.Unmarshal(data, &msg) == nil && msg.Stream == stream {
+			return msg.Data, nil
+		}
+	}
+}
+
+// NextOrderEvent skips notices and pongs until an order event arrives
+func (c *Client) NextOrderEvent(timeout time.Duration) (shm.OrderEvent, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := c.Next(time.Until(deadline))
+		if err != nil {
+			return shm.OrderEvent{}, fmt.Errorf("waiting for an order event: %w", err)
+		}
+		var probe map[string]json.RawMessage
+		if json.Unmarshal(data, &probe) != nil {
+			continue
+		}
+		if _, ok := probe["OrderId"]; !ok {
+			continue
+		}
+		var ev shm.OrderEvent
+		if err := json.Unmarshal(data, &ev); err != nil {
+			return shm.OrderEvent{}, err
+		}
+		return ev, nil
+	}
+}
+
+// Silent checks that nothing but control frames arrive for d
+func (c *Client) Silent(d time.Duration) error {
+	data, err := c.Next(d)
+	if err == nil {
+		return fmt.Errorf("unexpected frame %s", data)
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return nil
+	}
+	return err
+}
+
+// Closed reads until the server closes the connection and returns the close code , frames on the way are dropped
+func (c *Client) Closed(timeout time.Duration) (int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		_, err := c.Next(time.Until(deadline))
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if errors.As(err, &ce) {
+			return ce.Code, nil
+		}
+		return 0, err
+	}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,173 @@
+package e2e
+
+import (
+	"fmt"
+	"testing"
+
+	metrics "exchange/Metrics"
+	shm "exchange/Shm"
+	"exchange/Wire/wiretest"
+)
+
+// clients on ?encoding=msgpack , protobuf and sbe get frames the schemas in Wire decode , checked with the
+// reference decoders in Wire/wiretest and not with Wire itself
+
+var binaryEncodings = []string{"msgpack", "protobuf", "sbe"}
+
+// field names per encoding , msgpack keys are the json keys
+var frameKeys = map[string]map[string]string{
+	"msgpack":  {"trade": "trade", "tradeId": "t", "price": "p", "session": "session", "orderEvent": "", "orderId": "OrderId", "eventKind": "EventKind"},
+	"protobuf": {"trade": "trade", "tradeId": "trade_id", "price": "price", "session": "order_events_session", "orderEvent": "order_event", "orderId": "order_id", "eventKind": "event_kind"},
+	"sbe":      {"trade": "Trade", "tradeId": "tradeId", "price": "price", "session": "OrderEventsSession", "orderEvent": "OrderEvent", "orderId": "orderId", "eventKind": "eventKind"},
+}
+
+func TestEncodings(t *testing.T) {
+	runScenarios(t, []scenario{
+		{name: "binary_market_data", run: binaryMarketData},
+		{name: "binary_order_events", run: binaryOrderEvents},
+	})
+}
+
+// decodeFrame decodes one frame of enc , for msgpack the message is the "e" of the map
+func decodeFrame(schemas *wiretest.Schemas, enc string, frame []byte) (wiretest.Frame, error) {
+	switch enc {
+	case "protobuf":
+		return schemas.Protobuf(frame)
+	case "sbe":
+		return schemas.SBE(frame)
+	}
+	v, err := wiretest.Msgpack(frame)
+	if err != nil {
+		return wiretest.Frame{}, err
+	}
+	fields, ok := v.(map[string]any)
+	if !ok {
+		return wiretest.Frame{}, fmt.Errorf("msgpack frame is a %T , not a map", v)
+	}
+	var f wiretest.Frame
+	if stream, ok := fields["stream"].(string); ok {
+		f.Stream = stream
+		if fields, ok = fields["data"].(map[string]any); !ok {
+			return f, fmt.Errorf("msgpack market data without a data map")
+		}
+	}
+	f.Message, _ = fields["e"].(string)
+	f.Fields = fields
+	return f, nil
+}
+
+// expectFields compares by printed value , every decoder picks its own integer types
+func expectFields(enc string, f wiretest.Frame, want map[string]any) error {
+	for name, v := range want {
+		key := frameKeys[enc][name]
+		value, ok := f.Fields[key]
+		if !ok && enc == "protobuf" {
+			value = 0 // proto3 leaves zero values out
+		}
+		if got := fmt.Sprint(value); got != fmt.Sprint(v) {
+			return fmt.Errorf("%s %s %s = %s , want %v", enc, f.Message, key, got, v)
+		}
+	}
+	return nil
+}
+
+// one client per encoding on the same stream , each decodes the same trade
+func binaryMarketData(h *Harness) error {
+	const stream = "trade.1"
+	schemas, err := wiretest.Load("../Wire")
+	if err != nil {
+		return err
+	}
+	clients := map[string]*Client{}
+	for _, enc := range binaryEncodings {
+		cl, err := h.MarketData(WithEncoding(enc))
+		if err != nil {
+			return err
+		}
+		defer cl.Close()
+		if err := cl.Subscribe(stream); err != nil {
+			return err
+		}
+		clients[enc] = cl
+	}
+	if err := h.WaitClients(metrics.EndpointMarketData, len(binaryEncodings), wait); err != nil {
+		return err
+	}
+	if err := h.WaitRedisSubscribers(stream, 1, wait); err != nil {
+		return err
+	}
+	h.Publish(stream, `{"e":"trade","E":1760867227123,"s":1,"t":42,"p":6500025,"q":15,"T":1760867227120,"a":"1001","b":"1002","m":true}`)
+
+	for _, enc := range binaryEncodings {
+		frame, err := clients[enc].Next(wait)
+		if err != nil {
+			return fmt.Errorf("%s: %w", enc, err)
+		}
+		f, err := decodeFrame(schemas, enc, frame)
+		if err != nil {
+			return fmt.Errorf("%s: %w", enc, err)
+		}
+		if f.Stream != stream || f.Message != frameKeys[enc]["trade"] {
+			return fmt.Errorf("%s frame is %s on %q , want %s on %q", enc, f.Message, f.Stream, frameKeys[enc]["trade"], stream)
+		}
+		if err := expectFields(enc, f, map[string]any{"tradeId": 42, "price": 6500025}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the session frame and the order events after it decode in every encoding
+func binaryOrderEvents(h *Harness) error {
+	schemas, err := wiretest.Load("../Wire")
+	if err != nil {
+		return err
+	}
+	users := map[string]uint64{"msgpack": 7001, "protobuf": 7002, "sbe": 7003}
+	clients := map[string]*Client{}
+	for _, enc := range binaryEncodings {
+		cl, err := h.OrderEvents(users[enc], WithEncoding(enc))
+		if err != nil {
+			return err
+		}
+		defer cl.Close()
+		clients[enc] = cl
+	}
+	if err := h.WaitClients(metrics.EndpointOrderEvents, len(binaryEncodings), wait); err != nil {
+		return err
+	}
+
+	for i, enc := range binaryEncodings {
+		order := uint64(i + 1)
+		if err := h.Engine.PlaceOrder(shm.Order{OrderID: order, User_id: users[enc], Quantity: 5, Symbol: 1}); err != nil {
+			return err
+		}
+		cl := clients[enc]
+		frame, err := cl.Next(wait)
+		if err != nil {
+			return fmt.Errorf("%s session: %w", enc, err)
+		}
+		f, err := decodeFrame(schemas, enc, frame)
+		if err != nil {
+			return fmt.Errorf("%s session: %w", enc, err)
+		}
+		if f.Message != frameKeys[enc]["session"] {
+			return fmt.Errorf("%s first frame is %q , want the session", enc, f.Message)
+		}
+		for _, kind := range []uint32{EventAccepted, EventFilled} {
+			if frame, err = cl.Next(wait); err != nil {
+				return fmt.Errorf("%s order %d: %w", enc, order, err)
+			}
+			if f, err = decodeFrame(schemas, enc, frame); err != nil {
+				return fmt.Errorf("%s order %d: %w", enc, order, err)
+			}
+			if f.Message != frameKeys[enc]["orderEvent"] {
+				return fmt.Errorf("%s frame is %q , want an order event", enc, f.Message)
+			}
+			if err := expectFields(enc, f, map[string]any{"orderId": order, "eventKind": kind}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package e2e
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	shm "exchange/Shm"
+)
+
+// Engine stands in for the matching engine on the other side of the rings
+// it is the only producer of the event and response rings , so everything written to them goes through its loop
+//
+//	order with quantity    -> accepted , then filled
+//	order without quantity -> rejected with ErrorCode 1
+//	cancel                 -> canceled
+//	balance query          -> balance response with Available_balance 1_000_000
+//	holdings query         -> holdings response with 100 of every symbol available
+//
+// the harness plays the gateway side of the inbound rings too , see PlaceOrder , Cancel and Query ,
+// the real gateway has no order entry path yet
+type Engine struct {
+	orders   *shm.Queue
+	cancels  *shm.CancelOrderQueue
+	queries  *shm.QueryQueue
+	events   *shm.OrderEventQueue
+	balances *shm.BalanceResponseQueue
+	holdings *shm.HoldingResponseQueue
+
+	inbound sync.Mutex // PlaceOrder , Cancel and Query may be called from several goroutines , the rings are spsc
+	emit    chan []shm.OrderEvent
+	quit    chan struct{}
+	done    chan struct{}
+}
+
+// event kinds the fake engine writes , the real numbering lives in the engine
+const (
+	EventAccepted uint32 = iota
+	EventFilled
+	EventPartiallyFilled
+	EventCanceled
+	EventRejected
+)
+
+const (
+	FakeBalance  = 1_000_000
+	FakeHoldings = 100
+)
+
+func (e *Engine) start() {
+	e.emit = make(chan []shm.OrderEvent, 64)
+	e.quit = make(chan struct{})
+	e.done = make(chan struct{})
+	go e.run()
+}
+
+func (e *Engine) stop() {
+	if e.quit != nil {
+		close(e.quit)
+		<-e.done
+	}
+	e.close()
+}
+
+// close unmaps whatever createRings got to
+func (e *Engine) close() {
+	if e.orders != nil {
+		e.orders.Close()
+	}
+	if e.cancels != nil {
+		e.cancels.Close()
+	}
+	if e.queries != nil {
+		e.queries.Close()
+	}
+	if e.events != nil {
+		e.events.Close()
+	}
+	if e.balances != nil {
+		e.balances.Close()
+	}
+	if e.holdings != nil {
+		e.holdings.Close()
+	}
+}
+
+func (e *Engine) run() {
+	defer close(e.done)
+	orders := make([]shm.Order, 256)
+	cancels := make([]shm.OrderToBeCanceled, 256)
+	queries := make([]shm.Query, 256)
+	for {
+		select {
+		case <-e.quit:
+			return
+		case evs := <-e.emit:
+			e.publish(evs)
+			continue
+		default:
+		}
+		busy := false
+		if n := e.orders.DequeueBatch(orders); n > 0 {
+			busy = true
+			for _, o := range orders[:n] {
+				if o.Quantity == 0 {
+					e.publish([]shm.OrderEvent{{UserId: o.User_id, OrderId: o.OrderID, Symbol: o.Symbol, EventKind: EventRejected, ErrorCode: 1}})
+					continue
+				}
+				e.publish([]shm.OrderEvent{
+					{UserId: o.User_id, OrderId: o.OrderID, Symbol: o.Symbol, EventKind: EventAccepted, RemainingQty: o.Quantity, OriginalQty: o.Quantity},
+					{UserId: o.User_id, OrderId: o.OrderID, Symbol: o.Symbol, EventKind: EventFilled, FilledQty: o.Quantity, OriginalQty: o.Quantity},
+				})
+			}
+		}
+		if n := e.cancels.DequeueBatch(cancels); n > 0 {
+			busy = true
+			for _, c := range cancels[:n] {
+				e.publish([]shm.OrderEvent{{UserId: c.UserId, OrderId: c.OrderId, Symbol: c.Symbol, EventKind: EventCanceled}})
+			}
+		}
+		if n := e.queries.DequeueBatch(queries); n > 0 {
+			busy = true
+			for _, q := range queries[:n] {
+				e.answer(q)
+			}
+		}
+		if !busy {
+			time.Sleep(200 * time.Microsecond)
+		}
+	}
+}
+
+// publish retries while the gateway drains the ring , a full ring is what a slow gateway looks like to the engine
+func (e *Engine) publish(evs []shm.OrderEvent) {
+	for len(evs) > 0 {
+		n, _ := e.events.EnqueueBatch(evs)
+		evs = evs[n:]
+		if len(evs) > 0 {
+			select {
+			case <-e.quit:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+}
+
+func (e *Engine) answer(q shm.Query) {
+	switch q.QueryType {
+	case shm.QueryGetBalance, shm.QueryAddUser:
+		e.balances.Enqueue(shm.BalanceResponse{
+			QueryId:  q.QueryId,
+			UserId:   q.UserId,
+			Response: shm.UserBalance{User_id: q.UserId, Available_balance: FakeBalance},
+		})
+	case shm.QueryGetHoldings:
+		resp := shm.HoldingResponse{QueryId: q.QueryId, UserId: q.UserId}
+		resp.Response.UserId = q.UserId
+		for i := range resp.Response.AvailableHoldings {
+			resp.Response.AvailableHoldings[i] = FakeHoldings
+		}
+		e.holdings.Enqueue(resp)
+	}
+}
+
+// Emit writes events to the order events ring as they are , for routing and flow control scenarios
+func (e *Engine) Emit(evs ...shm.OrderEvent) {
+	select {
+	case e.emit <- evs:
+	case <-e.quit:
+	}
+}
+
+func (e *Engine) PlaceOrder(o shm.Order) error {
+	e.inbound.Lock()
+	defer e.inbound.Unlock()
+	return e.orders.Enqueue(o)
+}
+
+func (e *Engine) Cancel(c shm.OrderToBeCanceled) error {
+	e.inbound.Lock()
+	defer e.inbound.Unlock()
+	return e.cancels.Enqueue(c)
+}
+
+func (e *Engine) Query(q shm.Query) error {
+	e.inbound.Lock()
+	defer e.inbound.Unlock()
+	return e.queries.Enqueue(q)
+}
+
+// BalanceResponse waits for the next balance response , the harness is its only consumer
+func (e *Engine) BalanceResponse(timeout time.Duration) (shm.BalanceResponse, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if r, err := e.balances.Dequeue(); err == nil && r != nil {
+			return *r, nil
+		}
+		if time.Now().After(deadline) {
+			return shm.BalanceResponse{}, fmt.Errorf("no balance response within %s", timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// HoldingResponse waits for the next holdings response , the harness is its only consumer
+func (e *Engine) HoldingResponse(timeout time.Duration) (shm.HoldingResponse, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if r, err := e.holdings.Dequeue(); err == nil && r != nil {
+			return *r, nil
+		}
+		if time.Now().After(deadline) {
+			return shm.HoldingResponse{}, fmt.Errorf("no holdings response within %s", timeout)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,243 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	gateway "exchange/Gateway"
+	shm "exchange/Shm"
+	ws "exchange/Ws"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// end to end harness , one real gateway per Harness with everything around it faked in process :
+//
+//	rings    all six created with the shm.Create* functions in a temp dir , the gateway opens them like in production
+//	engine   a goroutine consuming the order , cancel and query rings and answering on the event and response rings
+//	redis    miniredis , the gateway talks to it with the real pubsub manager
+//	clients  gorilla websocket clients on the real endpoints , see client_test.go
+//
+// order event users come from the X-User header , see UserHeader , so one harness can route to many users
+// every scenario is a subtest on a fresh harness , torn down by t.Cleanup
+//
+//	go test -race ./E2E
+//	go test ./E2E -run TestGateway/slow -v -args -gateway.log
+
+// UserHeader carries the order events user id of a harness client
+const UserHeader = "X-User"
+
+// adminToken opens /admin for scenarios that set it as server.admin_token
+const adminToken = "e2e-admin"
+
+var gatewayLog = flag.Bool("gateway.log", false, "print the gateway log of every scenario to stderr")
+
+type Harness struct {
+	Dir     string
+	Config  *config.Config
+	Redis   *miniredis.Miniredis
+	Engine  *Engine
+	Gateway *gateway.Gateway
+	URL     string // ws://host:port , endpoints are appended by the clients
+}
+
+// a scenario runs against a fresh harness , configure tweaks the gateway config before it is validated ,
+// addr , shm and redis are already set
+type scenario struct {
+	name      string
+	configure func(cfg *config.Config)
+	run       func(h *Harness) error
+}
+
+func runScenarios(t *testing.T, scenarios []scenario) {
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			h := startHarness(t, sc.configure)
+			if err := sc.run(h); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// startHarness brings up rings , engine , miniredis and the gateway , t.Cleanup stops them in reverse
+func startHarness(t *testing.T, configure func(cfg *config.Config)) *Harness {
+	t.Helper()
+	h := &Harness{Dir: t.TempDir(), Redis: miniredis.RunT(t)}
+
+	cfg := config.Default()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Shm.Dir = h.Dir
+	cfg.Redis.Addr = h.Redis.Addr()
+	cfg.Log.Level = "debug"
+	if configure != nil {
+		configure(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	h.Config = cfg
+
+	var err error
+	if h.Engine, err = createRings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	h.Engine.start()
+	t.Cleanup(h.Engine.stop)
+
+	var out io.Writer = io.Discard
+	if *gatewayLog {
+		out = os.Stderr
+	}
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	if h.Gateway, err = gateway.New(cfg, gateway.WithLogger(logger), gateway.WithAuthenticator(ws.HeaderAuthenticator(UserHeader))); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Gateway.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.Gateway.Shutdown(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+	h.URL = "ws://" + h.Gateway.Addr().String()
+	return h
+}
+
+// createRings lays out a fresh shm dir the way the engine does on startup
+func createRings(cfg *config.Config) (*Engine, error) {
+	if err := shm.WriteLayoutFile(cfg.ShmPath(cfg.Shm.LayoutFile)); err != nil {
+		return nil, err
+	}
+	e := &Engine{}
+	var err error
+	if e.balances, err = shm.CreateBalanceResponseQueue(cfg.ShmPath(cfg.Shm.BalanceResponse)); err != nil {
+		return nil, err
+	}
+	if e.cancels, err = shm.CreateCancelOrderQueue(cfg.ShmPath(cfg.Shm.CancelOrders)); err != nil {
+		e.close()
+		return nil, err
+	}
+	if e.holdings, err = shm.CreateHoldingResponseQueue(cfg.ShmPath(cfg.Shm.HoldingsResponse)); err != nil {
+		e.close()
+		return nil, err
+	}
+	if e.events, err = shm.CreateOrderEventQueue(cfg.ShmPath(cfg.Shm.OrderEvents)); err != nil {
+		e.close()
+		return nil, err
+	}
+	if e.orders, err = shm.CreateQueue(cfg.ShmPath(cfg.Shm.PostOrders)); err != nil {
+		e.close()
+		return nil, err
+	}
+	if e.queries, err = shm.CreateQueryQueue(cfg.ShmPath(cfg.Shm.Queries)); err != nil {
+		e.close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// Publish sends a market data message through redis , data is the json stream message
+func (h *Harness) Publish(stream string, data string) int {
+	return h.Redis.Publish(stream, data)
+}
+
+// SystemStatus publishes a notice through the admin api , the scenario has to set server.admin_token to adminToken
+func (h *Harness) SystemStatus(st contracts.SystemStatusData) error {
+	body, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, "http://"+h.Gateway.Addr().String()+"/admin/system-status", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+adminToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("system status: http %d %s", resp.StatusCode, msg)
+	}
+	return nil
+}
+
+// WaitRedisSubscribers waits until the gateway holds n redis subscriptions on stream , subscribing is asynchronous
+func (h *Harness) WaitRedisSubscribers(stream string, n int, timeout time.Duration) error {
+	return waitFor(timeout, func() bool { return h.Redis.PubSubNumSub(stream)[stream] == n },
+		func() string {
+			return fmt.Sprintf("redis subscribers of %s: want %d , have %d", stream, n, h.Redis.PubSubNumSub(stream)[stream])
+		})
+}
+
+// Metric returns the value of one sample on /metrics , name includes the labels as prometheus prints them
+func (h *Harness) Metric(name string) (float64, error) {
+	resp, err := http.Get("http://" + h.Gateway.Addr().String() + "/metrics")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	return sample(string(body), name)
+}
+
+func waitFor(timeout time.Duration, ok func() bool, describe func() string) error {
+	deadline := time.Now().Add(timeout)
+	for !ok() {
+		if time.Now().After(deadline) {
+			return errors.New(describe())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return nil
+}
+
+// sample finds name in the prometheus text format , a missing sample is 0 since vectors only print what was touched
+func sample(body, name string) (float64, error) {
+	for _, line := range strings.Split(body, "\n") {
+		value, ok := strings.CutPrefix(line, name+" ")
+		if !ok {
+			continue
+		}
+		return strconv.ParseFloat(strings.TrimSpace(value), 64)
+	}
+	return 0, nil
+}
+
+// WaitClients waits until the gateway counts n connected clients on endpoint , see metrics.Endpoint*
+// the hub takes the registration off a queue right after , well before an event can make it through the rings
+func (h *Harness) WaitClients(endpoint string, n int, timeout time.Duration) error {
+	name := fmt.Sprintf("gateway_connected_clients{endpoint=%q}", endpoint)
+	var have float64
+	return waitFor(timeout, func() bool {
+		v, err := h.Metric(name)
+		have = v
+		return err == nil && v == float64(n)
+	}, func() string { return fmt.Sprintf("%s: want %d , have %v", name, n, have) })
+}
@@ -0,0 +1,136 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	config "exchange/Config"
+	metrics "exchange/Metrics"
+	recorder "exchange/Recorder"
+	shm "exchange/Shm"
+)
+
+// the recorder writes what came in from redis and the ring , a replay of that recording into the same gateway
+// gives the clients the same messages again and is not recorded a second time
+
+func TestRecordReplay(t *testing.T) {
+	runScenarios(t, []scenario{{name: "record_replay", run: recordReplay, configure: recordOptions}})
+}
+
+func recordOptions(cfg *config.Config) {
+	cfg.Record.Dir = filepath.Join(cfg.Shm.Dir, "recordings")
+	cfg.Record.FlushInterval = 20 * time.Millisecond
+}
+
+func recordReplay(h *Harness) error {
+	const stream, user = "trade.1", 6001
+	md, err := h.MarketData()
+	if err != nil {
+		return err
+	}
+	defer md.Close()
+	oe, err := h.OrderEvents(user)
+	if err != nil {
+		return err
+	}
+	defer oe.Close()
+	if err := md.Subscribe(stream); err != nil {
+		return err
+	}
+	if err := h.WaitRedisSubscribers(stream, 1, wait); err != nil {
+		return err
+	}
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+
+	var live [][]byte
+	for i := range 3 {
+		h.Publish(stream, fmt.Sprintf(`{"e":"trade","E":%d,"s":1,"t":%d,"p":%d,"q":1}`, time.Now().UnixMilli(), i, 100+i))
+		data, err := md.NextStream(stream, wait)
+		if err != nil {
+			return err
+		}
+		live = append(live, data)
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: user, Quantity: 2, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectEvents(oe, user, 1, EventAccepted, EventFilled); err != nil {
+		return err
+	}
+
+	var counted [2]int
+	if err := waitFor(wait, func() bool {
+		counted, err = countRecording(h.Config.Record.Dir)
+		return err == nil && counted == [2]int{3, 2}
+	}, func() string {
+		return fmt.Sprintf("recording has %d market data messages and %d order events (err %v) , want 3 and 2", counted[0], counted[1], err)
+	}); err != nil {
+		return err
+	}
+
+	rd, err := recorder.Open(h.Config.Record.Dir)
+	if err != nil {
+		return err
+	}
+	st, err := recorder.Replay(context.Background(), rd, h.Gateway, recorder.WithSpeed(0))
+	if err != nil {
+		return err
+	}
+	if st.MarketData != 3 || st.OrderEvents != 2 {
+		return fmt.Errorf("replay stats %+v", st)
+	}
+	for i, want := range live {
+		got, err := md.NextStream(stream, wait)
+		if err != nil {
+			return fmt.Errorf("replayed message %d: %w", i, err)
+		}
+		if !bytes.Equal(got, want) {
+			return fmt.Errorf("replayed message %d is %s , want %s", i, got, want)
+		}
+	}
+	if err := expectEvents(oe, user, 1, EventAccepted, EventFilled); err != nil {
+		return fmt.Errorf("replayed events: %w", err)
+	}
+
+	// give the writer a few flushes , the replay must not show up in the recording
+	time.Sleep(5 * h.Config.Record.FlushInterval)
+	if counted, err = countRecording(h.Config.Record.Dir); err != nil {
+		return err
+	}
+	if counted != [2]int{3, 2} {
+		return fmt.Errorf("after the replay the recording has %d market data messages and %d order events , want 3 and 2", counted[0], counted[1])
+	}
+	return nil
+}
+
+// countRecording returns market data messages and order events in a recording
+func countRecording(dir string) ([2]int, error) {
+	var n [2]int
+	rd, err := recorder.Open(dir)
+	if err != nil {
+		return n, err
+	}
+	defer rd.Close()
+	for {
+		rec, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if rec.IsMarketData() {
+			n[0]++
+		} else {
+			n[1] += len(rec.Events)
+		}
+	}
+}
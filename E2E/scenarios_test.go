@@ -0,0 +1,336 @@
+package e2e
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	config "exchange/Config"
+	metrics "exchange/Metrics"
+	shm "exchange/Shm"
+
+	"github.com/gorilla/websocket"
+)
+
+const wait = 3 * time.Second
+
+func TestGateway(t *testing.T) {
+	runScenarios(t, []scenario{
+		{name: "subscribe_broadcast", run: subscribeBroadcast},
+		{name: "private_routing", run: privateRouting},
+		{name: "queries", run: queries},
+		{name: "slow_consumer", run: slowConsumer, configure: func(cfg *config.Config) {
+			cfg.Server.SendBufferSize = 4
+			cfg.Hub.ResumeBuffer = 2
+		}},
+		{name: "disconnect_cleanup", run: disconnectCleanup},
+		{name: "order_events_auth", run: orderEventsAuth, configure: func(cfg *config.Config) {
+			cfg.Server.DevUser = 7 // must not let anything through next to an authenticator
+		}},
+	})
+}
+
+// two subscribers get every broadcast , a client on another stream gets none
+func subscribeBroadcast(h *Harness) error {
+	const stream, other = "trade.1", "trade.2"
+	a, err := h.MarketData()
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := h.MarketData()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	c, err := h.MarketData()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for _, cl := range []*Client{a, b} {
+		if err := cl.Subscribe(stream); err != nil {
+			return err
+		}
+	}
+	if err := c.Subscribe(other); err != nil {
+		return err
+	}
+	// one redis subscription per stream no matter how many clients
+	if err := h.WaitRedisSubscribers(stream, 1, wait); err != nil {
+		return err
+	}
+	if err := h.WaitRedisSubscribers(other, 1, wait); err != nil {
+		return err
+	}
+
+	for i := range 3 {
+		msg := fmt.Sprintf(`{"e":"trade","E":%d,"s":1,"t":%d,"p":100,"q":1}`, time.Now().UnixMilli(), i)
+		if n := h.Publish(stream, msg); n != 1 {
+			return fmt.Errorf("publish reached %d redis subscribers , want 1", n)
+		}
+		for name, cl := range map[string]*Client{"a": a, "b": b} {
+			if _, err := cl.NextStream(stream, wait); err != nil {
+				return fmt.Errorf("client %s message %d: %w", name, i, err)
+			}
+		}
+	}
+	if err := c.Silent(200 * time.Millisecond); err != nil {
+		return fmt.Errorf("client on %s: %w", other, err)
+	}
+	return nil
+}
+
+// events go to every connection of their user and nobody else , events for absent users are dropped
+func privateRouting(h *Harness) error {
+	const alice, bob, nobody = 1001, 1002, 1003
+	a1, err := h.OrderEvents(alice)
+	if err != nil {
+		return err
+	}
+	defer a1.Close()
+	a2, err := h.OrderEvents(alice)
+	if err != nil {
+		return err
+	}
+	defer a2.Close()
+	b, err := h.OrderEvents(bob)
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	// connections register with the hub asynchronously
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 3, wait); err != nil {
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: alice, Quantity: 5, Symbol: 1}); err != nil {
+		return err
+	}
+	for _, cl := range []*Client{a1, a2} {
+		if err := expectEvents(cl, alice, 1, EventAccepted, EventFilled); err != nil {
+			return err
+		}
+	}
+	if err := h.Engine.Cancel(shm.OrderToBeCanceled{OrderId: 2, UserId: bob, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectEvents(b, bob, 2, EventCanceled); err != nil {
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 3, User_id: bob, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectEvents(b, bob, 3, EventRejected); err != nil {
+		return err
+	}
+
+	before, err := h.Metric(`gateway_dropped_messages_total{endpoint="order_events",reason="no_connection"}`)
+	if err != nil {
+		return err
+	}
+	h.Engine.Emit(shm.OrderEvent{UserId: nobody, OrderId: 4, EventKind: EventFilled})
+	if err := waitMetricAbove(h, `gateway_dropped_messages_total{endpoint="order_events",reason="no_connection"}`, before, wait); err != nil {
+		return err
+	}
+	for name, cl := range map[string]*Client{"alice": a1, "bob": b} {
+		if err := cl.Silent(200 * time.Millisecond); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// queries go through the rings and come back on the response rings
+func queries(h *Harness) error {
+	if err := h.Engine.Query(shm.Query{QueryId: 1, UserId: 7, QueryType: shm.QueryGetBalance}); err != nil {
+		return err
+	}
+	bal, err := h.Engine.BalanceResponse(wait)
+	if err != nil {
+		return err
+	}
+	if bal.QueryId != 1 || bal.UserId != 7 || bal.Response.Available_balance != FakeBalance {
+		return fmt.Errorf("balance response %+v", bal)
+	}
+	if err := h.Engine.Query(shm.Query{QueryId: 2, UserId: 7, QueryType: shm.QueryGetHoldings}); err != nil {
+		return err
+	}
+	hold, err := h.Engine.HoldingResponse(wait)
+	if err != nil {
+		return err
+	}
+	if hold.QueryId != 2 || hold.UserId != 7 || hold.Response.AvailableHoldings[0] != FakeHoldings {
+		return fmt.Errorf("holdings response query %d user %d", hold.QueryId, hold.UserId)
+	}
+	return nil
+}
+
+// a client that stops reading is evicted with 1008 , the user can connect again afterwards
+func slowConsumer(h *Harness) error {
+	const user = 2001
+	const disconnects = `gateway_slow_consumer_disconnects_total{endpoint="order_events"}`
+	slow, err := h.OrderEvents(user, WithReadBuffer(4096))
+	if err != nil {
+		return err
+	}
+	defer slow.Close()
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+
+	// the socket buffers on both ends fill first , then the write pump blocks and the send buffer backs up
+	evs := make([]shm.OrderEvent, 500)
+	for i := range evs {
+		evs[i] = shm.OrderEvent{UserId: user, OrderId: uint64(100 + i), EventKind: EventPartiallyFilled, RemainingQty: 1, OriginalQty: 2, FilledQty: 1}
+	}
+	err = waitFor(10*time.Second, func() bool {
+		h.Engine.Emit(evs...)
+		n, err := h.Metric(disconnects)
+		return err == nil && n > 0
+	}, func() string { return "the slow client was never disconnected" })
+	if err != nil {
+		return err
+	}
+	code, err := slow.Closed(wait)
+	if err != nil {
+		return fmt.Errorf("slow client: %w", err)
+	}
+	if code != websocket.ClosePolicyViolation {
+		return fmt.Errorf("slow client closed with %d , want %d", code, websocket.ClosePolicyViolation)
+	}
+
+	again, err := h.OrderEvents(user)
+	if err != nil {
+		return err
+	}
+	defer again.Close()
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	// the engine may still be flushing the flood , skip to the order
+	for {
+		ev, err := again.NextOrderEvent(wait)
+		if err != nil {
+			return fmt.Errorf("after reconnect: %w", err)
+		}
+		if ev.OrderId == 1 {
+			if ev.EventKind != EventAccepted {
+				return fmt.Errorf("after reconnect got %+v , want accepted", ev)
+			}
+			return nil
+		}
+	}
+}
+
+// closing a client releases its redis subscription and its hub registration
+func disconnectCleanup(h *Harness) error {
+	const stream, user = "depth.1", 3001
+	md, err := h.MarketData()
+	if err != nil {
+		return err
+	}
+	if err := md.Subscribe(stream); err != nil {
+		md.Close()
+		return err
+	}
+	if err := h.WaitRedisSubscribers(stream, 1, wait); err != nil {
+		md.Close()
+		return err
+	}
+	md.Close()
+	if err := h.WaitRedisSubscribers(stream, 0, wait); err != nil {
+		return fmt.Errorf("after close: %w", err)
+	}
+
+	oe, err := h.OrderEvents(user)
+	if err != nil {
+		return err
+	}
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		oe.Close()
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		oe.Close()
+		return err
+	}
+	if err := expectEvents(oe, user, 1, EventAccepted, EventFilled); err != nil {
+		oe.Close()
+		return err
+	}
+	oe.Close()
+
+	// the hub forgets the user once the read loop notices , after that its events count as no_connection
+	const dropped = `gateway_dropped_messages_total{endpoint="order_events",reason="no_connection"}`
+	return waitFor(wait, func() bool {
+		before, err := h.Metric(dropped)
+		if err != nil {
+			return false
+		}
+		h.Engine.Emit(shm.OrderEvent{UserId: user, OrderId: 2, EventKind: EventFilled})
+		return waitMetricAbove(h, dropped, before, 100*time.Millisecond) == nil
+	}, func() string { return "events for a closed connection were never dropped as no_connection" })
+}
+
+// order events connections nobody authenticated are refused before the upgrade , and never counted
+func orderEventsAuth(h *Harness) error {
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"no credentials", nil, http.StatusUnauthorized},
+		{"bad credentials", http.Header{UserHeader: {"nobody"}}, http.StatusForbidden},
+	} {
+		conn, resp, err := websocket.DefaultDialer.Dial(h.URL+"/ws/OrderEvents", tc.header)
+		if err == nil {
+			conn.Close()
+			return fmt.Errorf("%s: upgraded , want http %d", tc.name, tc.status)
+		}
+		if resp == nil || resp.StatusCode != tc.status {
+			return fmt.Errorf("%s: %v , want http %d", tc.name, err, tc.status)
+		}
+	}
+	cl, err := h.OrderEvents(7)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: 7, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	return expectEvents(cl, 7, 1, EventAccepted, EventFilled)
+}
+
+func expectEvents(cl *Client, user, order uint64, kinds ...uint32) error {
+	for _, kind := range kinds {
+		ev, err := cl.NextOrderEvent(wait)
+		if err != nil {
+			return fmt.Errorf("user %d order %d: %w", user, order, err)
+		}
+		if ev.UserId != user || ev.OrderId != order || ev.EventKind != kind {
+			return fmt.Errorf("user %d got %+v , want order %d kind %d", user, ev, order, kind)
+		}
+	}
+	return nil
+}
+
+func waitMetricAbove(h *Harness, name string, floor float64, timeout time.Duration) error {
+	var last float64
+	var lastErr error
+	err := waitFor(timeout, func() bool {
+		last, lastErr = h.Metric(name)
+		return lastErr == nil && last > floor
+	}, func() string { return fmt.Sprintf("%s stayed at %v , want above %v", name, last, floor) })
+	return errors.Join(err, lastErr)
+}
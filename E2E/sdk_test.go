@@ -0,0 +1,329 @@
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	client "exchange/Client"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	metrics "exchange/Metrics"
+	shm "exchange/Shm"
+)
+
+// scenarios for the Go SDK in Client , the SDK talks to the gateway through a Proxy so they can cut it off
+
+func TestSDK(t *testing.T) {
+	runScenarios(t, []scenario{
+		{name: "market_data_reconnect", run: sdkMarketDataReconnect},
+		{name: "order_events_resume", run: sdkOrderEventsResume},
+		{name: "resume_gap", run: sdkResumeGap, configure: func(cfg *config.Config) {
+			cfg.Hub.ResumeBuffer = 4
+		}},
+		{name: "order_events_system_status", run: sdkOrderEventsSystemStatus, configure: func(cfg *config.Config) {
+			cfg.Server.AdminToken = adminToken
+		}},
+	})
+}
+
+func sdkOptions(extra ...client.Option) []client.Option {
+	return append([]client.Option{
+		client.WithBackoff(20*time.Millisecond, 200*time.Millisecond),
+		client.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}, extra...)
+}
+
+func userHeader(user uint64) client.Option {
+	return client.WithHeader(http.Header{UserHeader: {strconv.FormatUint(user, 10)}})
+}
+
+// runSDK starts an SDK connection for the length of a scenario , the returned func stops it and reports how Run ended ,
+// it may be called again (deferred) and returns the same
+func runSDK(run func(ctx context.Context) error, closeFn func()) func() error {
+	done := make(chan error, 1)
+	go func() { done <- run(context.Background()) }()
+	return sync.OnceValue(func() error {
+		closeFn()
+		select {
+		case err := <-done:
+			return err
+		case <-time.After(wait):
+			return fmt.Errorf("sdk Run did not return after Close")
+		}
+	})
+}
+
+func recv[T any](ch <-chan T, what string) (T, error) {
+	select {
+	case v := <-ch:
+		return v, nil
+	case <-time.After(wait):
+		var zero T
+		return zero, fmt.Errorf("no %s within %v", what, wait)
+	}
+}
+
+// typed callbacks and the local book survive a dropped connection , subscriptions come back by themselves
+// and the first depth diff after the reconnect shows the gap
+func sdkMarketDataReconnect(h *Harness) error {
+	const trades, depth = "trade.1", "depth.1"
+	p, err := h.Proxy()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	connects := make(chan struct{}, 8)
+	md := client.NewMarketData(p.URL, sdkOptions(client.WithConnectHooks(func() { connects <- struct{}{} }, nil))...)
+	got := make(chan contracts.TradeData, 8)
+	if err := md.Trades(trades, func(t contracts.TradeData) { got <- t }); err != nil {
+		return err
+	}
+	gaps := make(chan error, 8)
+	book, err := md.Book(depth, nil, func(err error) { gaps <- err })
+	if err != nil {
+		return err
+	}
+	stop := runSDK(md.Run, md.Close)
+	defer stop()
+
+	if _, err := recv(connects, "connection"); err != nil {
+		return err
+	}
+	for _, s := range []string{trades, depth} {
+		if err := h.WaitRedisSubscribers(s, 1, wait); err != nil {
+			return err
+		}
+	}
+	h.Publish(trades, `{"e":"trade","E":1,"s":1,"t":7,"p":100,"q":3}`)
+	t, err := recv(got, "trade")
+	if err != nil {
+		return err
+	}
+	if t.TradeID != 7 || t.Price != 100 || t.Quantity != 3 {
+		return fmt.Errorf("trade %+v", t)
+	}
+
+	h.Publish(depth, `{"e":"depth","s":1,"U":1,"u":1,"b":[["100","1"],["99","2"]],"a":[["101","1"]]}`)
+	h.Publish(depth, `{"e":"depth","s":1,"U":2,"u":2,"b":[["100","0"]],"a":[]}`)
+	if err := waitFor(wait, func() bool { return book.LastUpdateID() == 2 }, func() string {
+		return fmt.Sprintf("book at update %d , want 2", book.LastUpdateID())
+	}); err != nil {
+		return err
+	}
+	if bid, ask, ok := book.Best(); !ok || bid.Price != "99" || ask.Price != "101" {
+		return fmt.Errorf("best %v / %v , want 99 / 101", bid, ask)
+	}
+
+	// while the connection is down the gateway lets go of the redis subscriptions and update 3 is missed
+	p.Pause()
+	for _, s := range []string{trades, depth} {
+		if err := h.WaitRedisSubscribers(s, 0, wait); err != nil {
+			return fmt.Errorf("after cut: %w", err)
+		}
+	}
+	h.Publish(depth, `{"e":"depth","s":1,"U":3,"u":3,"b":[["98","5"]],"a":[]}`)
+	p.Resume()
+	if _, err := recv(connects, "reconnect"); err != nil {
+		return err
+	}
+	for _, s := range []string{trades, depth} {
+		if err := h.WaitRedisSubscribers(s, 1, wait); err != nil {
+			return fmt.Errorf("resubscribe: %w", err)
+		}
+	}
+
+	h.Publish(depth, `{"e":"depth","s":1,"U":4,"u":4,"b":[],"a":[["102","1"]]}`)
+	if _, err := recv(gaps, "book gap"); err != nil {
+		return err
+	}
+	// without a snapshot the book starts over from the diff that showed the gap
+	if book.LastUpdateID() != 4 || len(book.Bids(0)) != 0 || len(book.Asks(0)) != 1 {
+		return fmt.Errorf("book after gap at %d with %d bids %d asks , want 4 , 0 , 1", book.LastUpdateID(), len(book.Bids(0)), len(book.Asks(0)))
+	}
+	h.Publish(trades, `{"e":"trade","E":2,"s":1,"t":8,"p":101,"q":1}`)
+	if t, err = recv(got, "trade after reconnect"); err != nil {
+		return err
+	}
+	if t.TradeID != 8 {
+		return fmt.Errorf("trade after reconnect %+v", t)
+	}
+	return stop()
+}
+
+// events sent while the connection was down are replayed once and in order on the next one
+func sdkOrderEventsResume(h *Harness) error {
+	const user = 4001
+	p, err := h.Proxy()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	oe := client.NewOrderEvents(p.URL, sdkOptions(userHeader(user))...)
+	events := make(chan contracts.SequencedOrderEvent, 64)
+	oe.OnEvent(func(ev contracts.SequencedOrderEvent) { events <- ev })
+	gaps := make(chan contracts.OrderEventsSessionData, 8)
+	oe.OnGap(func(s contracts.OrderEventsSessionData) { gaps <- s })
+	stop := runSDK(oe.Run, oe.Close)
+	defer stop()
+
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectSequence(events, 1, 2); err != nil {
+		return err
+	}
+
+	if err := disconnectedEmit(h, p, user, 3); err != nil {
+		return err
+	}
+	p.Resume()
+	if err := expectSequence(events, 3, 5); err != nil {
+		return fmt.Errorf("replay: %w", err)
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 9, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectSequence(events, 6, 7); err != nil {
+		return fmt.Errorf("live after replay: %w", err)
+	}
+	select {
+	case s := <-gaps:
+		return fmt.Errorf("unexpected gap %+v", s)
+	case ev := <-events:
+		return fmt.Errorf("unexpected event %+v", ev)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if epoch, seq := oe.Position(); epoch == 0 || seq != 7 {
+		return fmt.Errorf("position epoch %d seq %d , want seq 7", epoch, seq)
+	}
+	return stop()
+}
+
+// more events than resume_buffer while down , the client is told about the gap and gets what was kept
+func sdkResumeGap(h *Harness) error {
+	const user = 5001
+	p, err := h.Proxy()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	oe := client.NewOrderEvents(p.URL, sdkOptions(userHeader(user))...)
+	events := make(chan contracts.SequencedOrderEvent, 64)
+	oe.OnEvent(func(ev contracts.SequencedOrderEvent) { events <- ev })
+	gaps := make(chan contracts.OrderEventsSessionData, 8)
+	oe.OnGap(func(s contracts.OrderEventsSessionData) { gaps <- s })
+	stop := runSDK(oe.Run, oe.Close)
+	defer stop()
+
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectSequence(events, 1, 2); err != nil {
+		return err
+	}
+
+	// seq 3..12 , only the last 4 are kept
+	if err := disconnectedEmit(h, p, user, 10); err != nil {
+		return err
+	}
+	p.Resume()
+	s, err := recv(gaps, "gap")
+	if err != nil {
+		return err
+	}
+	if !s.Gap || s.Seq != 12 {
+		return fmt.Errorf("session %+v , want a gap at seq 12", s)
+	}
+	if err := expectSequence(events, 9, 12); err != nil {
+		return fmt.Errorf("kept events: %w", err)
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 2, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectSequence(events, 13, 14); err != nil {
+		return fmt.Errorf("live after gap: %w", err)
+	}
+	return stop()
+}
+
+// a notice published through the admin api reaches OnSystemStatus and is not taken for an order event
+func sdkOrderEventsSystemStatus(h *Harness) error {
+	const user = 5501
+	oe := client.NewOrderEvents(h.URL, sdkOptions(userHeader(user))...)
+	events := make(chan contracts.SequencedOrderEvent, 64)
+	oe.OnEvent(func(ev contracts.SequencedOrderEvent) { events <- ev })
+	notices := make(chan contracts.SystemStatusData, 8)
+	oe.OnSystemStatus(func(st contracts.SystemStatusData) { notices <- st })
+	stop := runSDK(oe.Run, oe.Close)
+	defer stop()
+
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 1, wait); err != nil {
+		return err
+	}
+	if err := h.SystemStatus(contracts.SystemStatusData{Status: contracts.SystemTradingHalt, Symbols: []uint32{1}, Message: "halted"}); err != nil {
+		return err
+	}
+	st, err := recv(notices, "system status")
+	if err != nil {
+		return err
+	}
+	if st.Status != contracts.SystemTradingHalt || st.Message != "halted" || len(st.Symbols) != 1 || st.Symbols[0] != 1 {
+		return fmt.Errorf("system status %+v", st)
+	}
+	if err := h.Engine.PlaceOrder(shm.Order{OrderID: 1, User_id: user, Quantity: 1, Symbol: 1}); err != nil {
+		return err
+	}
+	if err := expectSequence(events, 1, 2); err != nil {
+		return fmt.Errorf("after the notice: %w", err)
+	}
+	return stop()
+}
+
+// disconnectedEmit pauses the proxy , waits for the hub to forget the connection and has n events routed
+// to the user while nobody is connected , the proxy stays paused
+func disconnectedEmit(h *Harness, p *Proxy, user uint64, n int) error {
+	const dropped = `gateway_dropped_messages_total{endpoint="order_events",reason="no_connection"}`
+	p.Pause()
+	if err := h.WaitClients(metrics.EndpointOrderEvents, 0, wait); err != nil {
+		return fmt.Errorf("after cut: %w", err)
+	}
+	before, err := h.Metric(dropped)
+	if err != nil {
+		return err
+	}
+	evs := make([]shm.OrderEvent, n)
+	for i := range evs {
+		evs[i] = shm.OrderEvent{UserId: user, OrderId: uint64(100 + i), Symbol: 1, EventKind: EventCanceled}
+	}
+	h.Engine.Emit(evs...)
+	return waitMetricAbove(h, dropped, before+float64(n-1), wait)
+}
+
+func expectSequence(events <-chan contracts.SequencedOrderEvent, from, to uint64) error {
+	for seq := from; seq <= to; seq++ {
+		ev, err := recv(events, fmt.Sprintf("event seq %d", seq))
+		if err != nil {
+			return err
+		}
+		if ev.Seq != seq {
+			return fmt.Errorf("got seq %d (order %d) , want %d", ev.Seq, ev.OrderId, seq)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,402 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	health "exchange/Health"
+	hub "exchange/Hub"
+	limits "exchange/Limits"
+	logging "exchange/Logging"
+	metrics "exchange/Metrics"
+	pubsubmanager "exchange/PubSubManager"
+	recorder "exchange/Recorder"
+	shm "exchange/Shm"
+	symbolmanager "exchange/SymbolManager"
+	ws "exchange/Ws"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// the whole gateway behind one type so other services can embed it , main.go is a thin wrapper
+//
+//	g, err := gateway.New(cfg, gateway.WithAuthenticator(auth), gateway.WithStreamHandler("fx.", fx))
+//	g.Echo().GET("/venue", venueInfo)
+//	if err := g.Start(ctx); err != nil { ... }
+//	g.PublishMarketData("trade.1", data)
+//	g.Shutdown(ctx)
+//
+// nothing in here is package level , several gateways can run in one process on different addrs and rings
+
+type Gateway struct {
+	cfg      *config.Config
+	log      *slog.Logger
+	logLevel *slog.LevelVar // nil when the logger came from WithLogger , /admin/log-level is then off
+	metrics  *metrics.Metrics
+	pubsub   *pubsubmanager.PubSubManager
+	sm       *symbolmanager.SymbolManager
+	hub      *hub.OrderEventsHub
+	checker  *health.Checker
+	server   *ws.Server
+	shm      *shm.ShmManager
+	rec      *recorder.Recorder // nil unless record.dir is set
+	released bool               // Shutdown or a failed Start gave back the rings , redis and the recording already
+
+	stopSm, stopHub, stopPoller, stopRec context.CancelFunc
+	smDone, hubDone, pollerDone, recDone <-chan struct{}
+}
+
+type options struct {
+	logger         *slog.Logger
+	authenticators []ws.Authenticator
+	streams        []streamRoute
+}
+
+type Option func(*options)
+
+// WithLogger replaces the logger built from cfg.Log , the gateway never touches slog.Default
+func WithLogger(l *slog.Logger) Option {
+	return func(o *options) { o.logger = l }
+}
+
+// WithAuthenticator adds an order events authenticator , asked after the client certificate in the order given
+func WithAuthenticator(a ws.Authenticator) Option {
+	return func(o *options) { o.authenticators = append(o.authenticators, a) }
+}
+
+// StreamHandler produces market data streams in process instead of redis
+// the symbol manager subscribes it on the first subscriber of a stream , every message goes to the
+// broadcaster it is handed , and unsubscribes it after the last subscriber left
+type StreamHandler = contracts.UpstreamPubSub
+
+// WithStreamHandler routes every stream starting with prefix to h , the longest matching prefix wins
+// prefixes starting with ! are taken , those streams are produced by the gateway itself
+func WithStreamHandler(prefix string, h StreamHandler) Option {
+	return func(o *options) { o.streams = append(o.streams, streamRoute{prefix: prefix, handler: h}) }
+}
+
+// New opens the shm rings and builds every component , nothing listens or runs until Start
+func New(cfg *config.Config, opts ...Option) (*Gateway, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, r := range o.streams {
+		if r.prefix == "" || strings.HasPrefix(r.prefix, "!") || r.handler == nil {
+			return nil, fmt.Errorf("stream handler prefix %q: must be non empty , not start with ! and have a handler", r.prefix)
+		}
+	}
+
+	g := &Gateway{cfg: cfg, log: o.logger}
+	if g.log == nil {
+		logger, logLevel, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+		if err != nil {
+			return nil, err
+		}
+		g.log, g.logLevel = logger, logLevel
+	}
+
+	rings, err := openRings(cfg, g.log)
+	if err != nil {
+		return nil, err
+	}
+	g.shm = rings
+
+	g.metrics = metrics.New()
+	for ring, depth := range map[string]func() uint64{
+		"balance_response":  rings.Balance_Response_queue.Depth,
+		"cancel_orders":     rings.CancelOrderQueue.Depth,
+		"holdings_response": rings.Holding_Response_queue.Depth,
+		"order_events":      rings.Order_Events_queue.Depth,
+		"post_orders":       rings.Post_Order_queue.Depth,
+		"queries":           rings.Query_queue.Depth,
+	} {
+		g.metrics.RegisterRingDepth(ring, depth)
+	}
+
+	if cfg.Record.Dir != "" {
+		if g.rec, err = recorder.New(cfg.Record, recorder.WithLogger(g.log), recorder.WithMetrics(g.metrics), recorder.WithSampleInterval(cfg.Log.SampleInterval)); err != nil {
+			rings.Close()
+			return nil, err
+		}
+		g.metrics.RegisterChannel("recorder", g.rec.QueueLen, g.rec.QueueCap())
+	}
+
+	g.pubsub = pubsubmanager.New(cfg.Redis, pubsubmanager.WithLogger(g.log), pubsubmanager.WithSampleInterval(cfg.Log.SampleInterval))
+	g.sm = symbolmanager.New(cfg.SymbolManager,
+		symbolmanager.WithUpstream(newUpstreamRouter(g.pubsub, o.streams, g.rec)),
+		symbolmanager.WithMetrics(g.metrics),
+		symbolmanager.WithLogger(g.log),
+		symbolmanager.WithSampleInterval(cfg.Log.SampleInterval),
+	)
+	for i := 0; i < g.sm.Shards(); i++ {
+		g.metrics.RegisterChannel(fmt.Sprintf("symbol_manager_commands_%d", i), func() int { return g.sm.CommandQueueLen(i) }, g.sm.CommandQueueCap())
+	}
+
+	g.hub = hub.NewOrderEventHub(cfg.Hub, hub.WithMetrics(g.metrics), hub.WithLogger(g.log), hub.WithSampleInterval(cfg.Log.SampleInterval))
+	g.metrics.RegisterChannel("hub_broadcast", g.hub.BroadcastQueueLen, g.hub.BroadcastQueueCap())
+	rings.BrodCaster = g.hub
+	if g.rec != nil {
+		rings.BrodCaster = g.rec.OrderEventsTee(g.hub)
+	}
+
+	g.checker = health.NewChecker(cfg.Health.CheckTimeout)
+	g.checker.Register("redis", g.pubsub.Ping)
+	g.checker.Register("symbol_manager", g.sm.Ping)
+	g.checker.Register("order_events_hub", g.hub.Ping)
+	// the engine drains the rings we produce into , our poller drains order events ,
+	// balance and holdings responses have no consumer yet so only their header and file are checked
+	for _, ring := range []struct {
+		name          string
+		status        func() shm.RingStatus
+		watchConsumer bool
+	}{
+		{"ring.balance_response", rings.Balance_Response_queue.Status, false},
+		{"ring.cancel_orders", rings.CancelOrderQueue.Status, true},
+		{"ring.holdings_response", rings.Holding_Response_queue.Status, false},
+		{"ring.order_events", rings.Order_Events_queue.Status, true},
+		{"ring.post_orders", rings.Post_Order_queue.Status, true},
+		{"ring.queries", rings.Query_queue.Status, true},
+	} {
+		g.checker.Register(ring.name, shm.NewRingMonitor(ring.status, ring.watchConsumer, cfg.Health.RingStallAfter).Check)
+	}
+
+	serverOpts := []ws.Option{ws.WithLogger(g.log), ws.WithSampleInterval(cfg.Log.SampleInterval)}
+	for _, a := range o.authenticators {
+		serverOpts = append(serverOpts, ws.WithAuthenticator(a))
+	}
+	g.server = ws.NewServer(g.sm, g.hub, cfg.Server, g.metrics, g.logLevel, g.checker, limits.New(cfg.Limits), serverOpts...)
+	if err := g.server.ConfigureTLS(); err != nil {
+		rings.Close()
+		if g.rec != nil {
+			g.rec.Close()
+		}
+		return nil, fmt.Errorf("tls setup error: %w", err)
+	}
+	return g, nil
+}
+
+// openRings checks the engine layout and maps every ring , on error whatever was mapped is closed again
+func openRings(cfg *config.Config, log *slog.Logger) (*shm.ShmManager, error) {
+	// the engine writes its struct layouts here on startup , refuse to run against a mismatched engine
+	if err := shm.VerifyLayoutFile(cfg.ShmPath(cfg.Shm.LayoutFile)); err != nil {
+		return nil, fmt.Errorf("shm layout check failed: %w", err)
+	}
+	m := &shm.ShmManager{Log: log}
+	opened := []interface{ Close() error }{}
+	fail := func(ring string, err error) (*shm.ShmManager, error) {
+		for _, q := range opened {
+			q.Close()
+		}
+		return nil, fmt.Errorf("%s error: %w", ring, err)
+	}
+	var err error
+	if m.Balance_Response_queue, err = shm.OpenBalanceResponseQueue(cfg.ShmPath(cfg.Shm.BalanceResponse)); err != nil {
+		return fail("BalanceResponseQueue", err)
+	}
+	opened = append(opened, m.Balance_Response_queue)
+	if m.CancelOrderQueue, err = shm.OpenCancelOrderQueue(cfg.ShmPath(cfg.Shm.CancelOrders)); err != nil {
+		return fail("OpenCancelOrderQueue", err)
+	}
+	opened = append(opened, m.CancelOrderQueue)
+	if m.Holding_Response_queue, err = shm.OpenHoldingResponseQueue(cfg.ShmPath(cfg.Shm.HoldingsResponse)); err != nil {
+		return fail("OpenHoldingResponseQueue", err)
+	}
+	opened = append(opened, m.Holding_Response_queue)
+	if m.Order_Events_queue, err = shm.OpenOrderEventQueue(cfg.ShmPath(cfg.Shm.OrderEvents)); err != nil {
+		return fail("OpenOrderEventQueue", err)
+	}
+	opened = append(opened, m.Order_Events_queue)
+	// the gateway is the consumer of the order events ring , pick up whatever a previous run left in flight
+	report, err := m.Order_Events_queue.Recover(shm.RecoverReplay)
+	if err != nil {
+		return fail("OrderEventQueue recovery", err)
+	}
+	log.Info("order events ring recovered", "report", report.String())
+	if m.Post_Order_queue, err = shm.OpenQueue(cfg.ShmPath(cfg.Shm.PostOrders)); err != nil {
+		return fail("OpenQueue", err)
+	}
+	opened = append(opened, m.Post_Order_queue)
+	if m.Query_queue, err = shm.OpenQueryQueue(cfg.ShmPath(cfg.Shm.Queries)); err != nil {
+		return fail("OpenQueryQueue", err)
+	}
+	m.OrderEventsWait, _ = shm.ParseWaitStrategy(cfg.Shm.WaitStrategy) // already validated by config.Load
+	return m, nil
+}
+
+// CreateRings lays out a fresh shm dir the way the engine does on startup , the layout file and every ring in cfg.Shm ,
+// for tools and tests that run a gateway without an engine , nothing produces into the order events ring then unless
+// the tool does , rings already in the dir are replaced with empty ones
+func CreateRings(cfg *config.Config) error {
+	if err := shm.WriteLayoutFile(cfg.ShmPath(cfg.Shm.LayoutFile)); err != nil {
+		return err
+	}
+	// created and unmapped again , the files stay for openRings
+	created := func(q interface{ Close() error }, err error) error {
+		if err != nil {
+			return err
+		}
+		return q.Close()
+	}
+	return errors.Join(
+		created(shm.CreateBalanceResponseQueue(cfg.ShmPath(cfg.Shm.BalanceResponse))),
+		created(shm.CreateCancelOrderQueue(cfg.ShmPath(cfg.Shm.CancelOrders))),
+		created(shm.CreateHoldingResponseQueue(cfg.ShmPath(cfg.Shm.HoldingsResponse))),
+		created(shm.CreateOrderEventQueue(cfg.ShmPath(cfg.Shm.OrderEvents))),
+		created(shm.CreateQueue(cfg.ShmPath(cfg.Shm.PostOrders))),
+		created(shm.CreateQueryQueue(cfg.ShmPath(cfg.Shm.Queries))),
+	)
+}
+
+// Start connects to redis , binds server.addr and runs every component , ctx only bounds the startup
+// it returns once the gateway takes clients , Shutdown stops it
+// on error nothing was started and everything New opened is released again , the gateway cannot be used any more
+func (g *Gateway) Start(ctx context.Context) error {
+	if err := g.pubsub.Connect(ctx); err != nil {
+		g.release()
+		return fmt.Errorf("redis connect error: %w", err)
+	}
+	if err := g.server.Listen(); err != nil {
+		g.release()
+		return fmt.Errorf("listen error: %w", err)
+	}
+	if g.rec != nil {
+		g.stopRec, g.recDone = start(g.rec.Run)
+	}
+	g.stopSm, g.smDone = start(g.sm.StartSymbolMnagaer)
+	g.stopHub, g.hubDone = start(g.hub.Start)
+	go g.server.CreateServer()
+	g.stopPoller, g.pollerDone = start(g.shm.PollOrderEvents)
+	return nil
+}
+
+// Shutdown drains the gateway in order , everything shares the deadline of ctx and whatever is left
+// when it expires is dropped , the rings are unmapped at the end so the gateway cannot be started again
+// a poller still running at the deadline keeps them mapped , that is ctx.Err() and the process should exit
+// only the first call does anything , later ones return nil
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	if g.released {
+		return nil
+	}
+	g.released = true
+	g.log.Info("shutting down gracefully")
+	g.checker.SetShuttingDown()
+	errs := []error{}
+	pollerStuck := false
+
+	// 1. no new upgrades , listener closed
+	if err := g.server.BeginShutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("http shutdown: %w", err))
+	}
+	if g.stopPoller != nil {
+		// 2. stop reading order events , the last batch is handed to the hub and committed
+		g.stopPoller()
+		pollerStuck = !g.wait(ctx, g.pollerDone, "order events poller")
+		// 3. hub routes what is queued and closes every client send channel
+		g.stopHub()
+		g.wait(ctx, g.hubDone, "order events hub")
+	}
+	// 4. order event pumps flush and send 1001 , market data clients get 1001 , the rest is closed
+	g.server.CloseConnections(ctx)
+	if g.stopSm != nil {
+		// 5. market data fan out and redis
+		g.stopSm()
+		g.wait(ctx, g.smDone, "symbol manager")
+	}
+	if err := g.pubsub.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("redis close: %w", err))
+	}
+	// 6. nothing feeds the recorder any more , it writes what is queued and closes its file
+	if g.stopRec != nil {
+		g.stopRec()
+		g.wait(ctx, g.recDone, "recorder")
+	} else if g.rec != nil {
+		if err := g.rec.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("recording close: %w", err))
+		}
+	}
+	// 7. unmap every ring , not under a poller that may still read them
+	if pollerStuck {
+		g.log.Warn("order events poller still running , rings stay mapped")
+		errs = append(errs, fmt.Errorf("order events poller: %w", ctx.Err()))
+	} else if err := g.shm.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("shm close: %w", err))
+	}
+	g.log.Info("shutdown complete")
+	return errors.Join(errs...)
+}
+
+// start runs a component loop in its own go routine , cancel stops it and done closes once it returned
+func start(run func(context.Context)) (context.CancelFunc, <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx)
+	}()
+	return cancel, done
+}
+
+// wait returns false when ctx expired before done closed
+func (g *Gateway) wait(ctx context.Context, done <-chan struct{}, name string) bool {
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		g.log.Warn("shutdown deadline hit", "waiting_for", name)
+		return false
+	}
+}
+
+// release gives back what New opened when Start fails before anything ran
+func (g *Gateway) release() {
+	g.released = true
+	if err := g.pubsub.Close(); err != nil {
+		g.log.Error("redis close failed", "err", err)
+	}
+	if g.rec != nil {
+		if err := g.rec.Close(); err != nil {
+			g.log.Error("recording close failed", "err", err)
+		}
+	}
+	if err := g.shm.Close(); err != nil {
+		g.log.Error("shm close failed", "err", err)
+	}
+}
+
+// PublishMarketData sends data to every subscriber of stream as if it came from redis
+// data is the json stream message , binary connections get it re encoded like any other
+// it is not recorded , this is the way a replay comes back in
+func (g *Gateway) PublishMarketData(stream string, data json.RawMessage) {
+	g.sm.BroadCasteFromRemote(contracts.MessageFromPubSubForUser{Stream: stream, Data: data})
+}
+
+// PublishOrderEvents routes events to their users as if the engine had written them to the ring , not recorded either
+func (g *Gateway) PublishOrderEvents(events ...shm.OrderEvent) {
+	g.hub.BrodCastBatch(events)
+}
+
+// Echo is the http router , routes added before Start are served next to the websocket endpoints
+func (g *Gateway) Echo() *echo.Echo {
+	return g.server.Echo()
+}
+
+// Addr is the bound address once started , useful with server.addr ":0"
+func (g *Gateway) Addr() net.Addr {
+	return g.server.Addr()
+}
+
+func (g *Gateway) Logger() *slog.Logger {
+	return g.log
+}
+
+func (g *Gateway) Metrics() *metrics.Metrics {
+	return g.metrics
+}
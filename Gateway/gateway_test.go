@@ -0,0 +1,129 @@
+package gateway
+
+import (
+	"context"
+	config "exchange/Config"
+	shm "exchange/Shm"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Shm.Dir = t.TempDir()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestCreateRingsOpensForTheGateway(t *testing.T) {
+	cfg := testConfig(t)
+	if err := CreateRings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	m, err := openRings(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("gateway cannot open the created rings: %v", err)
+	}
+	defer m.Close()
+	if err := m.Order_Events_queue.Enqueue(shm.OrderEvent{UserId: 1, OrderId: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if depth := m.Order_Events_queue.Depth(); depth != 1 {
+		t.Fatalf("order events depth %d , want 1", depth)
+	}
+}
+
+func TestCreateRingsMissingDir(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Shm.Dir = filepath.Join(cfg.Shm.Dir, "missing")
+	if err := CreateRings(cfg); err == nil {
+		t.Fatal("rings created in a directory that does not exist")
+	}
+}
+
+func TestCreateRingsReplacesExistingRings(t *testing.T) {
+	cfg := testConfig(t)
+	if err := CreateRings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	q, err := shm.OpenOrderEventQueue(cfg.ShmPath(cfg.Shm.OrderEvents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Enqueue(shm.OrderEvent{UserId: 1, OrderId: 1}); err != nil {
+		t.Fatal(err)
+	}
+	q.Close()
+
+	if err := CreateRings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if q, err = shm.OpenOrderEventQueue(cfg.ShmPath(cfg.Shm.OrderEvents)); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if depth := q.Depth(); depth != 0 {
+		t.Fatalf("order events depth %d after creating the rings again , want 0", depth)
+	}
+}
+
+// a gateway on fresh rings and miniredis , not started
+func newTestGateway(t *testing.T, addr string) *Gateway {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.Server.Addr = addr
+	cfg.Redis.Addr = miniredis.RunT(t).Addr()
+	if err := CreateRings(cfg); err != nil {
+		t.Fatal(err)
+	}
+	g, err := New(cfg, WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestShutdownTwice(t *testing.T) {
+	g := newTestGateway(t, "127.0.0.1:0")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := g.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the rings are unmapped and redis is closed already , nothing may be closed again
+	if err := g.Shutdown(ctx); err != nil {
+		t.Fatalf("second shutdown: %v", err)
+	}
+}
+
+func TestShutdownAfterFailedStart(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	g := newTestGateway(t, ln.Addr().String()) // listen fails after redis connected
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := g.Start(ctx); err == nil {
+		t.Fatal("started on an address in use")
+	}
+	for range 2 {
+		if err := g.Shutdown(ctx); err != nil {
+			t.Fatalf("shutdown after a failed start: %v", err)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package gateway
+
+import (
+	contracts "exchange/Contracts"
+	recorder "exchange/Recorder"
+	"strings"
+)
+
+// the symbol manager has one upstream , this one picks a stream handler by prefix and falls back to redis
+// with a recorder every message from either goes through its tee first
+
+type streamRoute struct {
+	prefix  string
+	handler StreamHandler
+}
+
+type upstreamRouter struct {
+	redis  contracts.UpstreamPubSub
+	routes []streamRoute
+	rec    *recorder.Recorder // may be nil
+}
+
+func newUpstreamRouter(redis contracts.UpstreamPubSub, routes []streamRoute, rec *recorder.Recorder) *upstreamRouter {
+	return &upstreamRouter{redis: redis, routes: routes, rec: rec}
+}
+
+func (u *upstreamRouter) pick(stream string) contracts.UpstreamPubSub {
+	var best *streamRoute
+	for i := range u.routes {
+		r := &u.routes[i]
+		if strings.HasPrefix(stream, r.prefix) && (best == nil || len(r.prefix) > len(best.prefix)) {
+			best = r
+		}
+	}
+	if best == nil {
+		return u.redis
+	}
+	return best.handler
+}
+
+func (u *upstreamRouter) SubscribeToSymbolMethod(stream string, to contracts.BroadCasterForPubSub) {
+	if u.rec != nil {
+		to = u.rec.MarketDataTee(to)
+	}
+	u.pick(stream).SubscribeToSymbolMethod(stream, to)
+}
+
+func (u *upstreamRouter) UnSubscribeToSymbolMethod(stream string) {
+	u.pick(stream).UnSubscribeToSymbolMethod(stream)
+}
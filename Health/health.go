@@ -0,0 +1,126 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// liveness and readiness for the orchestrator
+// /healthz only says the process answers http , /readyz runs every registered check and
+// reports unavailable as soon as one fails or shutdown has started
+
+// a check returns nil when its dependency is usable , it must give up when ctx is done
+type Check func(ctx context.Context) error
+
+var ErrShuttingDown = errors.New("shutting down")
+
+type Checker struct {
+	timeout  time.Duration // per readiness request , shared by all checks
+	mu       sync.Mutex
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+func NewChecker(timeout time.Duration) *Checker {
+	return &Checker{
+		timeout: timeout,
+		checks:  make(map[string]Check),
+	}
+}
+
+// Register adds a readiness check , registering the same name again replaces it
+func (c *Checker) Register(name string, check Check) {
+	c.mu.Lock()
+	c.checks[name] = check
+	c.mu.Unlock()
+}
+
+// SetShuttingDown flips readiness to false for good , main calls it first thing on a signal
+func (c *Checker) SetShuttingDown() {
+	c.draining.Store(true)
+}
+
+type Report struct {
+	Status string            `json:"status"` // ok or unavailable
+	Checks map[string]string `json:"checks"` // ok or the error of each check
+}
+
+func (r Report) Ready() bool {
+	return r.Status == "ok"
+}
+
+// Run executes every check concurrently under the checker timeout
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	names := make([]string, 0, len(c.checks))
+	for name := range c.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, name := range names {
+		checks[i] = c.checks[name]
+	}
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = check(ctx)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: "ok", Checks: make(map[string]string, len(names)+1)}
+	if c.draining.Load() {
+		report.Status = "unavailable"
+		report.Checks["shutdown"] = ErrShuttingDown.Error()
+	}
+	for i, name := range names {
+		if results[i] != nil {
+			report.Status = "unavailable"
+			report.Checks[name] = results[i].Error()
+			continue
+		}
+		report.Checks[name] = "ok"
+	}
+	return report
+}
+
+// LivenessHandler answers 200 as long as the process can serve http
+func (c *Checker) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// ReadinessHandler answers 200 with every check ok , 503 otherwise , the body lists each check either way
+func (c *Checker) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+		code := http.StatusOK
+		if !report.Ready() {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,111 @@
+package hub
+
+import (
+	contracts "exchange/Contracts"
+	shm "exchange/Shm"
+	"time"
+)
+
+// every user gets a seq per event , counted from 1 for as long as the hub runs , the epoch tells clients when it started over
+// the last resume_buffer events of a user are kept while they have a connection and resume_window after the last one closed ,
+// a connection opened with ?since=<seq>&epoch=<epoch> gets the kept events after since before anything live
+// a user is forgotten , counter and all , once the window is over , events for a user the hub does not know are not
+// numbered since nobody sees them , a resume for a forgotten user is always a gap as their numbering starts over
+
+type userEvents struct {
+	seq    uint64
+	buf    []contracts.SequencedOrderEvent // ring indexed by seq , nil while nothing is kept
+	first  uint64                          // first seq that went into buf
+	leftAt time.Time                       // when the last connection closed , zero while connected
+}
+
+// oldest seq still in the buffer , seq+1 when nothing is
+func (u *userEvents) oldest() uint64 {
+	if u.buf == nil {
+		return u.seq + 1
+	}
+	n := uint64(len(u.buf))
+	if u.seq >= n && u.seq-n+1 > u.first {
+		return u.seq - n + 1
+	}
+	return u.first
+}
+
+// sequence numbers an event and keeps it if its user is resumable
+// a user without an entry has no connection and nothing kept , the event goes out with seq 0 to nobody
+func (oh *OrderEventsHub) sequence(event shm.OrderEvent) contracts.SequencedOrderEvent {
+	u := oh.users[event.UserId]
+	if u == nil {
+		return contracts.SequencedOrderEvent{OrderEvent: event}
+	}
+	u.seq++
+	sev := contracts.SequencedOrderEvent{OrderEvent: event, Seq: u.seq}
+	if u.buf != nil {
+		u.buf[u.seq%uint64(len(u.buf))] = sev
+	}
+	return sev
+}
+
+// add registers a connection , sends its session frame and replays what it asked for
+func (oh *OrderEventsHub) add(client ClientInterface) {
+	user_id := client.GetUserId()
+	oh.connections[user_id] = append(oh.connections[user_id], client)
+	u, known := oh.users[user_id]
+	if !known {
+		u = &userEvents{}
+		oh.users[user_id] = u
+	}
+	u.leftAt = time.Time{}
+	if u.buf == nil && oh.resumeBuffer > 0 {
+		u.buf = make([]contracts.SequencedOrderEvent, oh.resumeBuffer)
+		u.first = u.seq + 1
+	}
+
+	session := contracts.OrderEventsSessionData{Event: "session", EventTime: time.Now().UnixMilli(), Epoch: oh.epoch, Seq: u.seq}
+	from, to := uint64(1), uint64(0) // nothing to replay
+	if since, epoch := client.GetResume(); epoch != 0 {
+		switch {
+		case epoch != oh.epoch || !known || since > u.seq:
+			session.Gap = true
+		default:
+			from, to = since+1, u.seq
+			if oldest := u.oldest(); from < oldest {
+				session.Gap = true
+				from = oldest
+			}
+		}
+	}
+	if !oh.sendOne(user_id, client, session) {
+		return
+	}
+	for seq := from; seq <= to; seq++ {
+		if !oh.sendOne(user_id, client, u.buf[seq%uint64(len(u.buf))]) {
+			return
+		}
+	}
+	if to >= from || session.Gap {
+		oh.log.Debug("connection resumed", "user_id", user_id, "replayed", to+1-from, "gap", session.Gap)
+	}
+}
+
+// left marks a user without connections , with nothing to keep the user is forgotten right away
+func (oh *OrderEventsHub) left(user_id uint64) {
+	u := oh.users[user_id]
+	if u == nil {
+		return
+	}
+	if oh.resumeBuffer == 0 || oh.resumeWindow == 0 {
+		delete(oh.users, user_id)
+		return
+	}
+	u.leftAt = time.Now()
+}
+
+// sweep forgets users gone for longer than the window
+func (oh *OrderEventsHub) sweep(now time.Time) {
+	for user_id, u := range oh.users {
+		if !u.leftAt.IsZero() && now.Sub(u.leftAt) > oh.resumeWindow {
+			delete(oh.users, user_id)
+		}
+	}
+}
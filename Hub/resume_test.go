@@ -0,0 +1,117 @@
+package hub
+
+import (
+	"encoding/json"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	shm "exchange/Shm"
+	"testing"
+	"time"
+)
+
+// the hub loop is not running , the tests call add , removeClient , routeEvent and sweep the way it would
+
+type fakeClient struct {
+	user         uint64
+	since, epoch uint64
+	send         chan Outbound
+}
+
+func (c *fakeClient) GetUserId() uint64                { return c.user }
+func (c *fakeClient) GetSendCh() chan Outbound         { return c.send }
+func (c *fakeClient) GetEncoding() contracts.Encoding  { return contracts.EncodingJSON }
+func (c *fakeClient) GetResume() (since, epoch uint64) { return c.since, c.epoch }
+
+func newResumeHub() *OrderEventsHub {
+	return NewOrderEventHub(config.HubConfig{ResumeBuffer: 8, ResumeWindow: time.Minute})
+}
+
+// connect registers a client and returns its session frame
+func connect(t *testing.T, oh *OrderEventsHub, user, since, epoch uint64) (*fakeClient, contracts.OrderEventsSessionData) {
+	t.Helper()
+	c := &fakeClient{user: user, since: since, epoch: epoch, send: make(chan Outbound, 16)}
+	oh.add(c)
+	var session contracts.OrderEventsSessionData
+	if err := json.Unmarshal((<-c.send).Data, &session); err != nil || session.Event != "session" {
+		t.Fatalf("first frame is not a session: %v", err)
+	}
+	return c, session
+}
+
+func events(oh *OrderEventsHub, user uint64, n int) {
+	for i := range n {
+		oh.routeEvent(shm.OrderEvent{UserId: user, OrderId: uint64(i + 1)}, time.Now())
+	}
+}
+
+func TestSweepForgetsUsersPastTheWindow(t *testing.T) {
+	oh := newResumeHub()
+	c, _ := connect(t, oh, 7, 0, 0)
+	events(oh, 7, 3)
+	oh.removeClient(c)
+
+	oh.sweep(time.Now())
+	if _, ok := oh.users[7]; !ok {
+		t.Fatal("user forgotten inside the window")
+	}
+	oh.sweep(time.Now().Add(2 * time.Minute))
+	if _, ok := oh.users[7]; ok {
+		t.Fatal("user kept past the window")
+	}
+	// nobody is connected , these are not numbered and do not bring the user back
+	events(oh, 7, 2)
+	if n := len(oh.users); n != 0 {
+		t.Fatalf("%d users known after events for a forgotten user", n)
+	}
+}
+
+func TestResumeOfForgottenUserIsAGap(t *testing.T) {
+	for _, since := range []uint64{0, 3} {
+		oh := newResumeHub()
+		c, first := connect(t, oh, 7, 0, 0)
+		events(oh, 7, 3)
+		oh.removeClient(c)
+		oh.sweep(time.Now().Add(2 * time.Minute))
+		events(oh, 7, 5)
+
+		_, session := connect(t, oh, 7, since, first.Epoch)
+		if !session.Gap {
+			t.Errorf("resume from %d after the user was forgotten got no gap", since)
+		}
+		if session.Epoch != first.Epoch || session.Seq != 0 {
+			t.Errorf("session epoch %d seq %d , want epoch %d seq 0", session.Epoch, session.Seq, first.Epoch)
+		}
+	}
+}
+
+func TestResumeInsideTheWindowReplays(t *testing.T) {
+	oh := newResumeHub()
+	c, first := connect(t, oh, 7, 0, 0)
+	events(oh, 7, 3)
+	oh.removeClient(c)
+	events(oh, 7, 2)
+	oh.sweep(time.Now())
+
+	c, session := connect(t, oh, 7, 3, first.Epoch)
+	if session.Gap || session.Seq != 5 {
+		t.Fatalf("session %+v , want seq 5 without a gap", session)
+	}
+	for want := uint64(4); want <= 5; want++ {
+		var ev struct {
+			Seq uint64
+		}
+		if err := json.Unmarshal((<-c.send).Data, &ev); err != nil || ev.Seq != want {
+			t.Fatalf("replayed seq %d (%v) , want %d", ev.Seq, err, want)
+		}
+	}
+}
+
+func TestNoResumeForgetsUserOnLeave(t *testing.T) {
+	oh := NewOrderEventHub(config.HubConfig{})
+	c, _ := connect(t, oh, 7, 0, 0)
+	events(oh, 7, 1)
+	oh.removeClient(c)
+	if _, ok := oh.users[7]; ok {
+		t.Fatal("user kept with resuming disabled")
+	}
+}
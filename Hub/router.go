@@ -1,15 +1,42 @@
 package hub
 
 import (
-	"encoding/json"
-	shm "exchange/Shm"
+	"context"
+	"errors"
 	"fmt"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	logging "exchange/Logging"
+	metrics "exchange/Metrics"
+	shm "exchange/Shm"
+	wire "exchange/Wire"
+	"log/slog"
+	"time"
 )
 
 type ClientInterface interface {
 	GetUserId() uint64
 	//GetConnObj() *websocket.Conn
-	GetSendCh() chan []byte
+	GetSendCh() chan Outbound
+	GetEncoding() contracts.Encoding // events are encoded once per encoding per user , see fanOut
+	GetResume() (since, epoch uint64) // what the connection asked to resume from , epoch 0 when it did not , see resume.go
+}
+
+// what the hub puts on a client send channel
+type Outbound struct {
+	Data     []byte
+	PolledAt time.Time // when the event was taken off the shm ring , zero for anything else
+}
+
+type kickRequest struct {
+	userID uint64
+	reply  chan int
+}
+
+// a batch from the shm poller stamped on arrival
+type eventBatch struct {
+	events   []shm.OrderEvent
+	polledAt time.Time
 }
 
 // for any type to be a client interface it must implement these functions , so i made client implement these functions this we can use client freely as a ClientInterface
@@ -17,79 +44,311 @@ type OrderEventsHub struct {
 	connections    map[uint64][]ClientInterface
 	registerChan   chan ClientInterface
 	unregisterChan chan ClientInterface
-	broadcastChan  chan shm.OrderEvent
+	broadcastChan  chan eventBatch // the shm poller forwards whole batches
+	done           chan struct{}   // closed when Start returns , later sends are dropped
+	pingChan       chan chan struct{} // readiness probes , see Ping
+	kickChan       chan kickRequest   // admin disconnects , see DisconnectUser
+	noticeChan     chan contracts.SystemStatusData // system notices for every connection , see BroadcastAll
+	evicting       map[ClientInterface]struct{} // slow clients with an unregister on the way
+	metrics        *metrics.Metrics
+	log            *slog.Logger
+	routeSample    *logging.Sampler // one routing line per interval
+	users          map[uint64]*userEvents // seq and kept events per user , see resume.go
+	epoch          uint64
+	resumeBuffer   int
+	resumeWindow   time.Duration
+}
+
+type Option func(*OrderEventsHub)
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(oh *OrderEventsHub) { oh.metrics = m }
 }
 
-func NewOrderEventHub() *OrderEventsHub {
-	return &OrderEventsHub{
+// WithLogger replaces slog.Default , the hub adds its component
+func WithLogger(l *slog.Logger) Option {
+	return func(oh *OrderEventsHub) { oh.log = l.With("component", "order_events_hub") }
+}
+
+// WithSampleInterval is how often the routing line gets through , 0 logs every batch
+func WithSampleInterval(d time.Duration) Option {
+	return func(oh *OrderEventsHub) { oh.routeSample = logging.NewSampler(d) }
+}
+
+func NewOrderEventHub(cfg config.HubConfig, opts ...Option) *OrderEventsHub {
+	oh := &OrderEventsHub{
 		connections:    make(map[uint64][]ClientInterface),
-		registerChan:   make(chan ClientInterface, 256),
-		unregisterChan: make(chan ClientInterface, 256),
-		broadcastChan:  make(chan shm.OrderEvent, 10000),
+		registerChan:   make(chan ClientInterface, cfg.RegisterChanSize),
+		unregisterChan: make(chan ClientInterface, cfg.RegisterChanSize),
+		broadcastChan:  make(chan eventBatch, cfg.BroadcastChanSize),
+		done:           make(chan struct{}),
+		pingChan:       make(chan chan struct{}),
+		kickChan:       make(chan kickRequest),
+		noticeChan:     make(chan contracts.SystemStatusData, 16),
+		evicting:       make(map[ClientInterface]struct{}),
+		log:            slog.With("component", "order_events_hub"),
+		routeSample:    logging.NewSampler(logging.DefaultSampleInterval),
+		users:          make(map[uint64]*userEvents),
+		epoch:          uint64(time.Now().UnixNano()),
+		resumeBuffer:   cfg.ResumeBuffer,
+		resumeWindow:   cfg.ResumeWindow,
+	}
+	for _, opt := range opts {
+		opt(oh)
 	}
+	return oh
 }
 
 // need to expose registern , unregister functions for the server pointer to call them in the hadnler
 func (oh *OrderEventsHub) Register(client_type ClientInterface) {
-	oh.registerChan <- client_type
+	select {
+	case oh.registerChan <- client_type:
+	case <-oh.done:
+		// hub already stopped , closing the channel lets the write pump say goodbye
+		close(client_type.GetSendCh())
+	}
 }
 func (oh *OrderEventsHub) UnRegister(client_type ClientInterface) {
-	oh.unregisterChan <- client_type
+	select {
+	case oh.unregisterChan <- client_type:
+	case <-oh.done:
+	}
 }
 
 func (oh*OrderEventsHub)BrodCast(event shm.OrderEvent){
-	oh.broadcastChan<-event
+	oh.BrodCastBatch([]shm.OrderEvent{event})
+}
+
+func (oh*OrderEventsHub)BrodCastBatch(events []shm.OrderEvent){
+	oh.metrics.MessagesIn(metrics.SourceShm, len(events))
+	select {
+	case oh.broadcastChan<-eventBatch{events: events, polledAt: time.Now()}:
+	case <-oh.done:
+	}
 }
 
-func (oh *OrderEventsHub) Start() {
+// Ping waits until the hub loop picks up a probe , for /readyz
+func (oh *OrderEventsHub) Ping(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case oh.pingChan <- reply:
+	case <-oh.done:
+		return errors.New("hub stopped")
+	case <-ctx.Done():
+		return errors.New("hub loop not responding")
+	}
+	<-reply
+	return nil
+}
+
+// DisconnectUser drops every connection of a user , their send channels are closed and the write pumps hang up
+// returns how many connections were dropped
+func (oh *OrderEventsHub) DisconnectUser(ctx context.Context, userID uint64) (int, error) {
+	reply := make(chan int, 1)
+	select {
+	case oh.kickChan <- kickRequest{userID: userID, reply: reply}:
+	case <-oh.done:
+		return 0, errors.New("hub stopped")
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+	return <-reply, nil
+}
+
+// BroadcastAll queues a system notice for every connected user
+func (oh *OrderEventsHub) BroadcastAll(st contracts.SystemStatusData) {
+	select {
+	case oh.noticeChan <- st:
+	case <-oh.done:
+	}
+}
+
+// occupancy of the broadcast channel for the metrics endpoint
+func (oh *OrderEventsHub) BroadcastQueueLen() int {
+	return len(oh.broadcastChan)
+}
+
+func (oh *OrderEventsHub) BroadcastQueueCap() int {
+	return cap(oh.broadcastChan)
+}
+
+// Start runs the hub until ctx is cancelled , then flushes what is queued and closes every client
+// stop the shm poller first so no events arrive after the flush
+func (oh *OrderEventsHub) Start(ctx context.Context) {
+	defer close(oh.done)
+	// kept events are swept a few times per window , a nil channel never fires when nothing outlives a connection
+	var sweep <-chan time.Time
+	if oh.resumeBuffer > 0 && oh.resumeWindow > 0 {
+		t := time.NewTicker(max(oh.resumeWindow/4, time.Second))
+		defer t.Stop()
+		sweep = t.C
+	}
 	for {
 		select {
+		case <-ctx.Done():
+			oh.shutdown()
+			return
 		case client := <-oh.registerChan:
+			oh.add(client)
 			user_id := client.GetUserId()
-			fmt.Println("registrng")
-			oh.connections[user_id] = append(oh.connections[user_id], client)
-			fmt.Println(oh.connections)
+			oh.log.Debug("client registered", "user_id", user_id, "user_connections", len(oh.connections[user_id]), "users", len(oh.connections))
+		case now := <-sweep:
+			oh.sweep(now)
 		case client := <-oh.unregisterChan:
-			user_id := client.GetUserId()
-			if clients, ok := oh.connections[user_id]; ok {
-				new_clients := make([]ClientInterface, 0, len(clients)-1)
-				for _, connobj := range clients {
-					if connobj != client {
-						new_clients = append(new_clients, connobj)
-					}
-				}
-				
-				if len(new_clients) == 0 {
-					delete(oh.connections, user_id)  
-				} else {
-					oh.connections[user_id] = new_clients
-				}
-				
-				close(client.GetSendCh()) // close the channel 
+			oh.removeClient(client)
+
+		case reply := <-oh.pingChan:
+			close(reply)
+
+		case st := <-oh.noticeChan:
+			oh.routeNotice(st)
+
+		case kick := <-oh.kickChan:
+			clients := oh.connections[kick.userID]
+			for _, client := range clients {
+				oh.removeClient(client)
 			}
-		
+			oh.log.Info("user disconnected by admin", "user_id", kick.userID, "connections", len(clients))
+			kick.reply <- len(clients)
 			
-		case event := <-oh.broadcastChan:
-			bytes, err := json.Marshal(event)
-			if err != nil {
-				fmt.Println("marshal error:", err)
-				continue  
+		case batch := <-oh.broadcastChan:
+			for _, event := range batch.events {
+				oh.routeEvent(event, batch.polledAt)
 			}
-			
-			clients := oh.connections[event.UserId]
-			for _, client := range clients {
-				select {
-				case client.GetSendCh() <- bytes:
-					
-				default:
-					// if slow , close the slow client 
-					go func(c ClientInterface) {
-						oh.UnRegister(c)
-					}(client)
+
+		}
+	}
+}
+
+func (oh *OrderEventsHub) removeClient(client ClientInterface) {
+	delete(oh.evicting, client)
+	user_id := client.GetUserId()
+	clients, ok := oh.connections[user_id]
+	if !ok {
+		return
+	}
+	new_clients := make([]ClientInterface, 0, len(clients))
+	found := false
+	for _, connobj := range clients {
+		if connobj != client {
+			new_clients = append(new_clients, connobj)
+		} else {
+			found = true
+		}
+	}
+	// a slow client can be unregistered more than once , only close its channel the first time
+	if !found {
+		return
+	}
+
+	oh.log.Debug("client unregistered", "user_id", user_id, "user_connections", len(new_clients))
+	if len(new_clients) == 0 {
+		delete(oh.connections, user_id)
+		oh.left(user_id)
+	} else {
+		oh.connections[user_id] = new_clients
+	}
+
+	close(client.GetSendCh()) // close the channel
+}
+
+// applies pending registrations , routes every event already queued and closes all send channels
+// the write pumps drain their channel before sending the close frame so nothing queued is lost
+func (oh *OrderEventsHub) shutdown() {
+	for {
+		select {
+		case client := <-oh.unregisterChan:
+			oh.removeClient(client)
+		case client := <-oh.registerChan:
+			oh.add(client)
+		case batch := <-oh.broadcastChan:
+			for _, event := range batch.events {
+				oh.routeEvent(event, batch.polledAt)
+			}
+		case st := <-oh.noticeChan:
+			oh.routeNotice(st)
+		default:
+			oh.log.Info("hub flushed , closing clients", "users", len(oh.connections))
+			for user_id, clients := range oh.connections {
+				for _, client := range clients {
+					close(client.GetSendCh())
 				}
+				delete(oh.connections, user_id)
 			}
-		
+			return
+		}
+	}
+}
+
+// sends one event to every connection of its user
+func (oh *OrderEventsHub) routeEvent(event shm.OrderEvent, polledAt time.Time) {
+	clients := oh.connections[event.UserId]
+	if ok, skipped := oh.routeSample.Allow(); ok && oh.log.Enabled(context.Background(), slog.LevelDebug) {
+		oh.log.Debug("routing order event", "user_id", event.UserId, "order_id", event.OrderId, "connections", len(clients), "skipped", skipped)
+	}
+	if len(clients) == 0 {
+		oh.metrics.Dropped(metrics.EndpointOrderEvents, "no_connection")
+	}
+	oh.fanOut(event.UserId, clients, oh.sequence(event), polledAt)
+}
+
+// sends a system notice to every connection of every user
+func (oh *OrderEventsHub) routeNotice(st contracts.SystemStatusData) {
+	n := 0
+	for user_id, clients := range oh.connections {
+		oh.fanOut(user_id, clients, st, time.Time{})
+		n += len(clients)
+	}
+	oh.log.Info("system notice sent", "connections", n)
+}
 
+// per user fan out , a client whose buffer is full is evicted instead of blocking the hub
+// msg is encoded once for each encoding the user's connections asked for
+func (oh *OrderEventsHub) fanOut(user_id uint64, clients []ClientInterface, msg any, polledAt time.Time) {
+	var frames [contracts.EncodingCount][]byte
+	for _, client := range clients {
+		enc := client.GetEncoding()
+		if frames[enc] == nil {
+			data, err := wire.Message(enc, msg)
+			if err != nil {
+				oh.metrics.Dropped(metrics.EndpointOrderEvents, "encode_error")
+				oh.log.Error("message encode failed", "user_id", user_id, "encoding", enc.String(), "type", fmt.Sprintf("%T", msg), "err", err)
+				continue
+			}
+			frames[enc] = data
 		}
+		oh.send(user_id, client, Outbound{Data: frames[enc], PolledAt: polledAt})
+	}
+}
+
+// sendOne encodes msg for one connection , for session frames and replays
+func (oh *OrderEventsHub) sendOne(user_id uint64, client ClientInterface, msg any) bool {
+	data, err := wire.Message(client.GetEncoding(), msg)
+	if err != nil {
+		oh.metrics.Dropped(metrics.EndpointOrderEvents, "encode_error")
+		oh.log.Error("message encode failed", "user_id", user_id, "encoding", client.GetEncoding().String(), "type", fmt.Sprintf("%T", msg), "err", err)
+		return true
+	}
+	return oh.send(user_id, client, Outbound{Data: data})
+}
+
+// send never blocks the hub , a client whose buffer is full is evicted , false then
+func (oh *OrderEventsHub) send(user_id uint64, client ClientInterface, out Outbound) bool {
+	select {
+	case client.GetSendCh() <- out:
+		return true
+	default:
+	}
+	// if slow , close the slow client
+	oh.metrics.Dropped(metrics.EndpointOrderEvents, "slow_consumer")
+	if _, already := oh.evicting[client]; already {
+		return false
 	}
+	oh.evicting[client] = struct{}{}
+	oh.log.Warn("slow consumer , disconnecting", "user_id", user_id, "buffer", cap(client.GetSendCh()))
+	oh.metrics.SlowConsumerDisconnect(metrics.EndpointOrderEvents)
+	go func(c ClientInterface) {
+		oh.UnRegister(c)
+	}(client)
+	return false
 }
@@ -0,0 +1,198 @@
+package limits
+
+import (
+	"errors"
+	config "exchange/Config"
+	"sync"
+	"time"
+)
+
+// inbound limits for websocket clients
+// every connection gets a tier from its api key , the tier decides the per connection message bucket ,
+// how many streams it may hold and how many connections its ip and user may open
+// on top of that all connections of one ip share an ip wide message bucket
+// a zero in any limit means unlimited
+
+const DefaultTier = "default"
+
+var (
+	ErrTooManyConnsPerIP   = errors.New("too many connections from this ip")
+	ErrTooManyConnsPerUser = errors.New("too many connections for this user")
+)
+
+// Bucket is a token bucket , a nil bucket allows everything
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns nil when perSecond is zero , burst defaults to perSecond
+func NewBucket(perSecond, burst int) *Bucket {
+	if perSecond <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perSecond
+	}
+	return &Bucket{
+		rate:   float64(perSecond),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *Bucket) Allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type ipState struct {
+	conns  int
+	bucket *Bucket
+}
+
+type Limiter struct {
+	cfg   config.LimitsConfig
+	mu    sync.Mutex
+	ips   map[string]*ipState
+	users map[uint64]int
+}
+
+func New(cfg config.LimitsConfig) *Limiter {
+	return &Limiter{
+		cfg:   cfg,
+		ips:   make(map[string]*ipState),
+		users: make(map[uint64]int),
+	}
+}
+
+// Tier resolves an api key , unknown and empty keys get the default tier
+func (l *Limiter) Tier(apiKey string) (string, config.TierLimits) {
+	if l == nil {
+		return DefaultTier, config.TierLimits{}
+	}
+	if apiKey != "" {
+		if name, ok := l.cfg.APIKeys[apiKey]; ok {
+			if tier, ok := l.cfg.Tiers[name]; ok {
+				return name, tier
+			}
+		}
+	}
+	return DefaultTier, l.cfg.Default
+}
+
+// Conn holds the limits of one open connection , Release it when the connection is gone
+// a nil Conn , handed out by a nil Limiter , allows everything
+type Conn struct {
+	l        *Limiter
+	ip       string
+	userID   uint64
+	tier     string
+	limits   config.TierLimits
+	bucket   *Bucket
+	ipBucket *Bucket
+	once     sync.Once
+}
+
+// Acquire reserves a connection slot for ip and , when userID is not zero , for the user
+// call it before the upgrade so a refused client gets a plain http error
+func (l *Limiter) Acquire(ip string, userID uint64, apiKey string) (*Conn, error) {
+	if l == nil {
+		return nil, nil
+	}
+	tier, limits := l.Tier(apiKey)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st, ok := l.ips[ip]
+	if !ok {
+		st = &ipState{bucket: NewBucket(l.cfg.IPMessagesPerSecond, l.cfg.IPMessageBurst)}
+	}
+	if limits.MaxConnsPerIP > 0 && st.conns >= limits.MaxConnsPerIP {
+		return nil, ErrTooManyConnsPerIP
+	}
+	if userID != 0 && limits.MaxConnsPerUser > 0 && l.users[userID] >= limits.MaxConnsPerUser {
+		return nil, ErrTooManyConnsPerUser
+	}
+	st.conns++
+	l.ips[ip] = st
+	if userID != 0 {
+		l.users[userID]++
+	}
+
+	return &Conn{
+		l:        l,
+		ip:       ip,
+		userID:   userID,
+		tier:     tier,
+		limits:   limits,
+		bucket:   NewBucket(limits.MessagesPerSecond, limits.MessageBurst),
+		ipBucket: st.bucket,
+	}, nil
+}
+
+func (c *Conn) Tier() string {
+	if c == nil {
+		return ""
+	}
+	return c.tier
+}
+
+// Allow takes a token for one inbound message from the connection bucket and the ip bucket
+func (c *Conn) Allow() bool {
+	if c == nil {
+		return true
+	}
+	return c.bucket.Allow() && c.ipBucket.Allow()
+}
+
+// CanSubscribe reports whether a connection holding current streams may add another
+func (c *Conn) CanSubscribe(current int) bool {
+	return c == nil || c.limits.MaxStreams <= 0 || current < c.limits.MaxStreams
+}
+
+// TooManyViolations is true once a connection had max_violations rejected messages in a row
+func (c *Conn) TooManyViolations(inARow int) bool {
+	return c != nil && c.l.cfg.MaxViolations > 0 && inARow >= c.l.cfg.MaxViolations
+}
+
+func (c *Conn) Release() {
+	if c == nil {
+		return
+	}
+	c.once.Do(func() {
+		l := c.l
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if st, ok := l.ips[c.ip]; ok {
+			st.conns--
+			if st.conns <= 0 {
+				delete(l.ips, c.ip)
+			}
+		}
+		if c.userID != 0 {
+			l.users[c.userID]--
+			if l.users[c.userID] <= 0 {
+				delete(l.users, c.userID)
+			}
+		}
+	})
+}
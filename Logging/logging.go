@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// structured logging for the gateway , built on log/slog
+// main builds one logger with New and installs it with slog.SetDefault , components derive
+// their own with slog.With("component", ...) when they are constructed , or from the logger
+// handed to their WithLogger option when several gateways share a process
+// the level lives in a LevelVar so it can be changed at runtime through LevelHandler
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// ParseLevel accepts debug , info , warn and error
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q , want debug, info, warn or error", s)
+	}
+	return l, nil
+}
+
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatText:
+		return FormatText, nil
+	}
+	return "", fmt.Errorf("unknown log format %q , want json or text", s)
+}
+
+// New builds the process logger , changing the returned LevelVar changes every logger derived from it
+func New(w io.Writer, format, level string) (*slog.Logger, *slog.LevelVar, error) {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := ParseFormat(format)
+	if err != nil {
+		return nil, nil, err
+	}
+	lv := new(slog.LevelVar)
+	lv.Set(l)
+
+	opts := &slog.HandlerOptions{Level: lv}
+	var h slog.Handler
+	if f == FormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(h), lv, nil
+}
+
+type levelBody struct {
+	Level string `json:"level"`
+}
+
+// LevelHandler serves the current level on GET and changes it on PUT/POST with {"level":"debug"}
+// changes are logged on log , the caller's logger so the line carries its component
+func LevelHandler(lv *slog.LevelVar, log *slog.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			var body levelBody
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&body); err != nil {
+				http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			l, err := ParseLevel(body.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			old := lv.Level()
+			lv.Set(l)
+			log.Warn("log level changed", "from", old.String(), "to", l.String(), "remote", r.RemoteAddr)
+		default:
+			w.Header().Set("Allow", "GET, PUT, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(levelBody{Level: lv.Level().String()})
+	})
+}
+
+// DefaultSampleInterval is what components sample at until their WithSampleInterval option says otherwise
+const DefaultSampleInterval = time.Second
+
+// Sampler lets one line through per interval on hot paths and counts what it held back
+// the count is meant to go on the next line that gets through , e.g.
+//
+//	if ok, skipped := s.Allow(); ok { log.Debug("routed event", "skipped", skipped) }
+//
+// a zero interval lets everything through
+type Sampler struct {
+	interval   int64 // nanoseconds
+	next       atomic.Int64
+	suppressed atomic.Uint64
+}
+
+func NewSampler(interval time.Duration) *Sampler {
+	return &Sampler{interval: int64(interval)}
+}
+
+func (s *Sampler) Allow() (bool, uint64) {
+	if s == nil || s.interval <= 0 {
+		return true, 0
+	}
+	now := time.Now().UnixNano()
+	next := s.next.Load()
+	if now < next || !s.next.CompareAndSwap(next, now+s.interval) {
+		s.suppressed.Add(1)
+		return false, 0
+	}
+	return true, s.suppressed.Swap(0)
+}
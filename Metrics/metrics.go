@@ -0,0 +1,222 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// prometheus metrics for one gateway , every instance owns its registry so nothing is global
+// all recording methods are safe on a nil *Metrics so components work without metrics wired in
+
+const (
+	EndpointMarketData  = "market_data"
+	EndpointOrderEvents = "order_events"
+
+	SourceWebsocket = "websocket"
+	SourceRedis     = "redis"
+	SourceShm       = "shm"
+
+	RecordMarketData  = "market_data"
+	RecordOrderEvents = "order_events"
+)
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	connectedClients  *prometheus.GaugeVec
+	streamSubscribers *prometheus.GaugeVec
+	messagesIn        *prometheus.CounterVec
+	messagesOut       *prometheus.CounterVec
+	dropped           *prometheus.CounterVec
+	slowDisconnects   *prometheus.CounterVec
+	limitRejections   *prometheus.CounterVec
+	orderEventLatency prometheus.Histogram
+	recorded          *prometheus.CounterVec
+	recorderDropped   *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	m := &Metrics{
+		registry: reg,
+		connectedClients: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gateway_connected_clients",
+			Help: "Open websocket connections per endpoint.",
+		}, []string{"endpoint"}),
+		streamSubscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gateway_stream_subscribers",
+			Help: "Subscribed connections per market data stream.",
+		}, []string{"stream"}),
+		messagesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_messages_in_total",
+			Help: "Messages received , by source.",
+		}, []string{"source"}),
+		messagesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_messages_out_total",
+			Help: "Messages written to websocket clients , by endpoint.",
+		}, []string{"endpoint"}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_dropped_messages_total",
+			Help: "Messages that never reached a client , by endpoint and reason.",
+		}, []string{"endpoint", "reason"}),
+		slowDisconnects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_slow_consumer_disconnects_total",
+			Help: "Clients disconnected because their send buffer was full.",
+		}, []string{"endpoint"}),
+		limitRejections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_limit_rejections_total",
+			Help: "Connections and messages refused by a rate or size limit , by endpoint and limit.",
+		}, []string{"endpoint", "limit"}),
+		orderEventLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "gateway_order_event_latency_seconds",
+			Help:    "Time from reading an order event off the shm ring to writing it to the socket.",
+			Buckets: prometheus.ExponentialBuckets(0.00001, 2, 18), // 10us .. ~1.3s
+		}),
+		recorded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_recorder_records_total",
+			Help: "Records written to the recording , by kind , an order events record is one poller batch.",
+		}, []string{"kind"}),
+		recorderDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gateway_recorder_dropped_total",
+			Help: "Records missing from the recording , by kind and reason.",
+		}, []string{"kind", "reason"}),
+	}
+	reg.MustRegister(
+		m.connectedClients,
+		m.streamSubscribers,
+		m.messagesIn,
+		m.messagesOut,
+		m.dropped,
+		m.slowDisconnects,
+		m.limitRejections,
+		m.orderEventLatency,
+		m.recorded,
+		m.recorderDropped,
+	)
+	return m
+}
+
+// Handler serves the registry in the prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// RegisterRingDepth exposes Depth() of a shm ring , sampled on every scrape
+func (m *Metrics) RegisterRingDepth(ring string, depth func() uint64) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "gateway_shm_ring_depth",
+		Help:        "Entries published by the producer and not yet committed by the consumer.",
+		ConstLabels: prometheus.Labels{"ring": ring},
+	}, func() float64 { return float64(depth()) }))
+}
+
+// RegisterChannel exposes how full an internal channel is , sampled on every scrape
+func (m *Metrics) RegisterChannel(name string, length func() int, capacity int) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "gateway_channel_occupancy",
+		Help:        "Buffered items waiting in an internal channel.",
+		ConstLabels: prometheus.Labels{"channel": name},
+	}, func() float64 { return float64(length()) }))
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name:        "gateway_channel_capacity",
+		Help:        "Buffer size of an internal channel.",
+		ConstLabels: prometheus.Labels{"channel": name},
+	}, func() float64 { return float64(capacity) }))
+}
+
+func (m *Metrics) ClientConnected(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.connectedClients.WithLabelValues(endpoint).Inc()
+}
+
+func (m *Metrics) ClientDisconnected(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.connectedClients.WithLabelValues(endpoint).Dec()
+}
+
+// SetStreamSubscribers is called by the symbol manager whenever a stream changes , 0 removes the series
+func (m *Metrics) SetStreamSubscribers(stream string, n int) {
+	if m == nil {
+		return
+	}
+	if n == 0 {
+		m.streamSubscribers.DeleteLabelValues(stream)
+		return
+	}
+	m.streamSubscribers.WithLabelValues(stream).Set(float64(n))
+}
+
+func (m *Metrics) MessagesIn(source string, n int) {
+	if m == nil {
+		return
+	}
+	m.messagesIn.WithLabelValues(source).Add(float64(n))
+}
+
+func (m *Metrics) MessageOut(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.messagesOut.WithLabelValues(endpoint).Inc()
+}
+
+func (m *Metrics) Dropped(endpoint, reason string) {
+	if m == nil {
+		return
+	}
+	m.dropped.WithLabelValues(endpoint, reason).Inc()
+}
+
+func (m *Metrics) SlowConsumerDisconnect(endpoint string) {
+	if m == nil {
+		return
+	}
+	m.slowDisconnects.WithLabelValues(endpoint).Inc()
+}
+
+func (m *Metrics) LimitRejected(endpoint, limit string) {
+	if m == nil {
+		return
+	}
+	m.limitRejections.WithLabelValues(endpoint, limit).Inc()
+}
+
+func (m *Metrics) ObserveOrderEventLatency(polledAt time.Time) {
+	if m == nil || polledAt.IsZero() {
+		return
+	}
+	m.orderEventLatency.Observe(time.Since(polledAt).Seconds())
+}
+
+func (m *Metrics) Recorded(kind string) {
+	if m == nil {
+		return
+	}
+	m.recorded.WithLabelValues(kind).Inc()
+}
+
+func (m *Metrics) RecorderDropped(kind, reason string) {
+	if m == nil {
+		return
+	}
+	m.recorderDropped.WithLabelValues(kind, reason).Inc()
+}
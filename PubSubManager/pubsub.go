@@ -4,56 +4,82 @@ import(
 	 "sync"
 	 "github.com/redis/go-redis/v9"
 	  "exchange/Contracts"
+	  config "exchange/Config"
 	  "context"
+	  "log/slog"
+	  "time"
+	  logging "exchange/Logging"
 	 // "encoding/json"
-	  "fmt"
 	)
 
 // the pubsusb manager exposes the subscribe , unsubscribe methods , initiates the redis pubsub clietn
-var PubSubManagerInstance *PubSubManager
-var once sync.Once
+// one per gateway , New only builds the client , Connect is what talks to redis
 
 type  PubSubManager struct{
 	rclient 		*redis.Client 
-	BroadCaster 	contracts.BroadCasterForPubSub
 	Subscriptions 	map[string]*redis.PubSub // keeps a track of what all streams are we subscribed to 
 	mu 				sync.Mutex
+	closed 			bool // set by Close , late subscribe calls from the symbol manager are ignored
+	log 			*slog.Logger
+	msgSample 		*logging.Sampler // one line per interval for incoming redis messages
 }
 
 
-func CreateSingletonInstance(broadcaster contracts.BroadCasterForPubSub) *PubSubManager{
-	once.Do(func(){
-		client := redis.NewClient(&redis.Options{
-			Addr: "localhost:6379",
-		})
-		if err := client.Ping(context.Background()).Err(); err != nil {
-			panic(err)
-		}
+type Option func(*PubSubManager)
 
-		PubSubManagerInstance = &PubSubManager{
-			rclient: client,
-			BroadCaster: broadcaster,
-			Subscriptions:  make(map[string]*redis.PubSub),
-		}
-	})
+// WithLogger replaces slog.Default , the manager adds its component
+func WithLogger(l *slog.Logger) Option {
+	return func(ps *PubSubManager) { ps.log = l.With("component", "pubsub") }
+}
+
+// WithSampleInterval is how often the incoming message line gets through , 0 logs every one
+func WithSampleInterval(d time.Duration) Option {
+	return func(ps *PubSubManager) { ps.msgSample = logging.NewSampler(d) }
+}
 
-	return PubSubManagerInstance
+func New(cfg config.RedisConfig, opts ...Option) *PubSubManager{
+	ps := &PubSubManager{
+		rclient: redis.NewClient(&redis.Options{
+			Addr: cfg.Addr,
+			Password: cfg.Password,
+			DB: cfg.DB,
+			DialTimeout: cfg.DialTimeout,
+		}),
+		Subscriptions:  make(map[string]*redis.PubSub),
+		log: slog.With("component", "pubsub"),
+		msgSample: logging.NewSampler(logging.DefaultSampleInterval),
+	}
+	for _, opt := range opts {
+		opt(ps)
+	}
+	return ps
 }
 
-func getPubSubManagerInstance() *PubSubManager{
-	return PubSubManagerInstance
+// Connect makes sure redis is there before the gateway takes clients
+func (ps *PubSubManager) Connect(ctx context.Context) error {
+	return ps.rclient.Ping(ctx).Err()
 }
 
+// Ping checks the redis connection , for /readyz
+func (ps *PubSubManager) Ping(ctx context.Context) error {
+	return ps.rclient.Ping(ctx).Err()
+}
 
-func (ps *PubSubManager)SubscribeToSymbolMethod(StreamName string){
+
+// every message of the stream is handed to to , the symbol manager that asked
+func (ps *PubSubManager)SubscribeToSymbolMethod(StreamName string, to contracts.BroadCasterForPubSub){
 	
 	ps.mu.Lock()
+	if ps.closed {
+		ps.mu.Unlock()
+		return
+	}
 	if _, already := ps.Subscriptions[StreamName]; already {
 		ps.mu.Unlock()
 		return
 	}
 	// if not subscibed
-	fmt.Println("subscribing to the stream")
+	ps.log.Info("subscribing to redis channel", "stream", StreamName)
 	pubsub := ps.rclient.Subscribe(context.Background(), StreamName)
 	
 	ps.Subscriptions[StreamName] = pubsub
@@ -65,14 +91,16 @@ func (ps *PubSubManager)SubscribeToSymbolMethod(StreamName string){
 	go func() {
 		for msg := range ch {
 			//var m contracts.MessageFromPubSubForUser
-			fmt.Println("got some  message from pubsusb",  msg)
+			if ok, skipped := ps.msgSample.Allow(); ok && ps.log.Enabled(context.Background(), slog.LevelDebug) {
+				ps.log.Debug("redis message", "stream", msg.Channel, "bytes", len(msg.Payload), "skipped", skipped)
+			}
 			
 			//if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
 			//	fmt.Println("Redis message unmarshal error:", err)
 			//	continue
 			//}
 			// Notify RoomManager (via Broadcaster interface)
-			ps.BroadCaster.BroadCasteFromRemote(contracts.MessageFromPubSubForUser{
+			to.BroadCasteFromRemote(contracts.MessageFromPubSubForUser{
 				Stream: msg.Channel,
 				Data:  []byte(msg.Payload),
 			})
@@ -93,11 +121,28 @@ func (ps *PubSubManager) UnSubscribeToSymbolMethod(StreamName string) {
     ps.mu.Unlock()
 	// unsubscribe methods needs to be called on the pubsub objct only 
     if err := pubsub.Unsubscribe(context.Background(), StreamName); err != nil {
-        fmt.Println("Error unsubscribing:", err)
+        ps.log.Error("redis unsubscribe failed", "stream", StreamName, "err", err)
     }
 	// close pubusb
     if err := pubsub.Close(); err != nil {
-        fmt.Println("Error closing pubsub:", err)
+        ps.log.Error("redis pubsub close failed", "stream", StreamName, "err", err)
     }
 }
 
+
+
+// Close drops every redis subscription and the client , the receiver go routines exit when their channel closes
+func (ps *PubSubManager) Close() error {
+	ps.mu.Lock()
+	ps.closed = true
+	subs := ps.Subscriptions
+	ps.Subscriptions = make(map[string]*redis.PubSub)
+	ps.mu.Unlock()
+
+	for stream, pubsub := range subs {
+		if err := pubsub.Close(); err != nil {
+			ps.log.Error("redis pubsub close failed", "stream", stream, "err", err)
+		}
+	}
+	return ps.rclient.Close()
+}
@@ -0,0 +1,153 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	shm "exchange/Shm"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// a recording is a directory of json lines files , one record per line :
+//
+//	{"t":1760867227123456789,"format":"gateway-recording/1"}                  first line of every file
+//	{"t":1760867227123501234,"stream":"trade.1","data":{"e":"trade",...}}     an upstream market data message
+//	{"t":1760867227123777777,"events":[{"UserId":1001,"OrderId":1,...},...]}  an order events batch off the ring
+//
+// t is unix nanoseconds when the gateway received it , data is the payload as redis delivered it
+// files are named by the time they were opened so a sorted listing is the recording in order ,
+// a file cut short by a crash ends in a partial line , readers skip it
+
+const (
+	Format     = "gateway-recording/1"
+	FilePrefix = "recording-"
+	FileSuffix = ".jsonl"
+	fileTime   = "20060102T150405.000000000Z"
+)
+
+type Record struct {
+	Time   int64            `json:"t"`
+	Format string           `json:"format,omitempty"` // only on the first line of a file
+	Stream string           `json:"stream,omitempty"`
+	Data   json.RawMessage  `json:"data,omitempty"`
+	Events []shm.OrderEvent `json:"events,omitempty"`
+}
+
+func (r Record) IsMarketData() bool  { return r.Stream != "" }
+func (r Record) IsOrderEvents() bool { return len(r.Events) > 0 }
+
+// Reader reads the records of several files in order , see Open
+type Reader struct {
+	files []string
+	cur   *os.File
+	br    *bufio.Reader
+	name  string
+	line  int
+}
+
+// Open reads the given files in the order given , a directory stands for its recording files sorted by name
+func Open(paths ...string) (*Reader, error) {
+	rd := &Reader{}
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			rd.files = append(rd.files, p)
+			continue
+		}
+		files, err := filepath.Glob(filepath.Join(p, FilePrefix+"*"+FileSuffix))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(files)
+		rd.files = append(rd.files, files...)
+	}
+	if len(rd.files) == 0 {
+		return nil, fmt.Errorf("no recording files in %s", strings.Join(paths, " "))
+	}
+	return rd, nil
+}
+
+func (rd *Reader) Files() []string { return rd.files }
+
+// Next returns the next market data or order events record , io.EOF after the last file
+func (rd *Reader) Next() (Record, error) {
+	for {
+		if rd.cur == nil {
+			if len(rd.files) == 0 {
+				return Record{}, io.EOF
+			}
+			if err := rd.openNext(); err != nil {
+				return Record{}, err
+			}
+			if rd.cur == nil {
+				continue
+			}
+		}
+		data, err := rd.br.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Record{}, fmt.Errorf("%s: %w", rd.name, err)
+		}
+		last := err != nil
+		if last {
+			rd.cur.Close()
+			rd.cur = nil
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+		rd.line++
+		var rec Record
+		if jerr := json.Unmarshal(data, &rec); jerr != nil {
+			if last {
+				continue // cut short by a crash
+			}
+			return Record{}, fmt.Errorf("%s line %d: %w", rd.name, rd.line, jerr)
+		}
+		if rec.Format != "" {
+			continue
+		}
+		return rec, nil
+	}
+}
+
+func (rd *Reader) openNext() error {
+	rd.name, rd.files = rd.files[0], rd.files[1:]
+	f, err := os.Open(rd.name)
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(f, 64<<10)
+	head, err := br.ReadBytes('\n')
+	if len(head) == 0 && errors.Is(err, io.EOF) {
+		// created right before a crash , nothing in it
+		f.Close()
+		return nil
+	}
+	var rec Record
+	if err != nil || json.Unmarshal(head, &rec) != nil || rec.Format != Format {
+		f.Close()
+		return fmt.Errorf("%s: not a %s file", rd.name, Format)
+	}
+	rd.cur, rd.br, rd.line = f, br, 1
+	return nil
+}
+
+// Close releases the file being read , only needed when stopping before io.EOF
+func (rd *Reader) Close() error {
+	if rd.cur == nil {
+		return nil
+	}
+	err := rd.cur.Close()
+	rd.cur = nil
+	return err
+}
@@ -0,0 +1,294 @@
+package recorder
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	logging "exchange/Logging"
+	metrics "exchange/Metrics"
+	shm "exchange/Shm"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// records what came into the gateway , every upstream market data message and every order event batch the poller
+// took off the ring , with the time it arrived , to rotating append only files so an incident can be played back later
+// see Reader and Replay for the other side
+//
+// recording never holds up delivery , the tees hand records to a buffered channel and move on , a full buffer
+// drops the record and counts it in gateway_recorder_dropped_total , one writer goroutine owns the files
+
+type Recorder struct {
+	cfg     config.RecordConfig
+	in      chan Record
+	log     *slog.Logger
+	metrics *metrics.Metrics
+	errs    *logging.Sampler // write errors repeat for every record while the disk is full
+
+	// owned by Run , or by New and Close when Run never ran
+	file      *os.File
+	w         *bufio.Writer
+	size      int64
+	opened    time.Time
+	closeOnce sync.Once
+}
+
+type Option func(*Recorder)
+
+func WithLogger(l *slog.Logger) Option {
+	return func(r *Recorder) { r.log = l.With("component", "recorder") }
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(r *Recorder) { r.metrics = m }
+}
+
+// WithSampleInterval is how often a repeating write error gets logged , 0 logs every one
+func WithSampleInterval(d time.Duration) Option {
+	return func(r *Recorder) { r.errs = logging.NewSampler(d) }
+}
+
+// New creates cfg.Dir and opens the first file , so a directory the gateway cannot write to fails at startup
+func New(cfg config.RecordConfig, opts ...Option) (*Recorder, error) {
+	r := &Recorder{
+		cfg:  cfg,
+		in:   make(chan Record, cfg.BufferSize),
+		log:  slog.With("component", "recorder"),
+		errs: logging.NewSampler(logging.DefaultSampleInterval),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("recording dir: %w", err)
+	}
+	if err := r.open(time.Now()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// MarketData records one upstream message , safe from any goroutine
+func (r *Recorder) MarketData(at time.Time, msg contracts.MessageFromPubSubForUser) {
+	r.enqueue(Record{Time: at.UnixNano(), Stream: msg.Stream, Data: msg.Data}, metrics.RecordMarketData)
+}
+
+// OrderEvents records one poller batch , events is not copied , the hub and the recorder only read it
+func (r *Recorder) OrderEvents(at time.Time, events []shm.OrderEvent) {
+	r.enqueue(Record{Time: at.UnixNano(), Events: events}, metrics.RecordOrderEvents)
+}
+
+func (r *Recorder) enqueue(rec Record, kind string) {
+	select {
+	case r.in <- rec:
+	default:
+		r.metrics.RecorderDropped(kind, "buffer_full")
+	}
+}
+
+func (r *Recorder) QueueLen() int { return len(r.in) }
+func (r *Recorder) QueueCap() int { return cap(r.in) }
+
+// Run writes records until ctx is done , then writes what is still queued and closes the file
+func (r *Recorder) Run(ctx context.Context) {
+	r.log.Info("recording", "dir", r.cfg.Dir, "file", r.file.Name())
+	flush := time.NewTicker(r.cfg.FlushInterval)
+	defer flush.Stop()
+	for {
+		select {
+		case rec := <-r.in:
+			r.write(rec)
+		case now := <-flush.C:
+			r.flush()
+			if r.cfg.RotateInterval > 0 && r.file != nil && now.Sub(r.opened) >= r.cfg.RotateInterval {
+				r.rotate(now)
+			}
+		case <-ctx.Done():
+			r.drain()
+			r.Close()
+			return
+		}
+	}
+}
+
+// drain writes what the tees queued before Run was told to stop
+func (r *Recorder) drain() {
+	for {
+		select {
+		case rec := <-r.in:
+			r.write(rec)
+		default:
+			return
+		}
+	}
+}
+
+// Close flushes and closes the current file , Run does it on its way out , call it only when Run never ran
+func (r *Recorder) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		err = r.closeFile()
+		if err == nil {
+			r.log.Info("recording closed")
+		}
+	})
+	return err
+}
+
+func (r *Recorder) write(rec Record) {
+	kind := metrics.RecordMarketData
+	if rec.Stream == "" {
+		kind = metrics.RecordOrderEvents
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		// the symbol manager cannot forward a payload that is not json either
+		r.metrics.RecorderDropped(kind, "encode_error")
+		return
+	}
+	line = append(line, '\n')
+	if r.file != nil && r.size+int64(len(line)) > r.cfg.MaxFileSize && r.size > 0 {
+		r.rotate(time.Now())
+	}
+	if r.file == nil {
+		// the last write or open failed , try a fresh file for every record until one works
+		if err := r.open(time.Now()); err != nil {
+			r.failed(kind, err)
+			return
+		}
+	}
+	n, err := r.w.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		r.failed(kind, err)
+		r.closeFile()
+		return
+	}
+	r.metrics.Recorded(kind)
+}
+
+func (r *Recorder) failed(kind string, err error) {
+	r.metrics.RecorderDropped(kind, "write_error")
+	if ok, skipped := r.errs.Allow(); ok {
+		r.log.Error("recording write failed", "err", err, "skipped", skipped)
+	}
+}
+
+func (r *Recorder) flush() {
+	if r.w == nil {
+		return
+	}
+	if err := r.w.Flush(); err != nil {
+		// the records in the buffer were counted as recorded already , the log is all there is
+		if ok, skipped := r.errs.Allow(); ok {
+			r.log.Error("recording flush failed", "err", err, "skipped", skipped)
+		}
+		r.closeFile()
+	}
+}
+
+func (r *Recorder) rotate(now time.Time) {
+	name := r.file.Name()
+	if err := r.closeFile(); err != nil {
+		r.log.Error("recording close failed", "file", name, "err", err)
+	}
+	if err := r.open(now); err != nil {
+		if ok, _ := r.errs.Allow(); ok {
+			r.log.Error("recording rotate failed", "err", err)
+		}
+		return
+	}
+	r.log.Info("recording rotated", "closed", name, "file", r.file.Name())
+	r.prune()
+}
+
+// open starts a new file with the header line , names sort by the time they were opened
+func (r *Recorder) open(now time.Time) error {
+	path := filepath.Join(r.cfg.Dir, FilePrefix+now.UTC().Format(fileTime)+FileSuffix)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("recording file: %w", err)
+	}
+	head, _ := json.Marshal(Record{Time: now.UnixNano(), Format: Format})
+	if _, err := f.Write(append(head, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("recording file %s: %w", path, err)
+	}
+	r.file, r.w, r.size, r.opened = f, bufio.NewWriterSize(f, 64<<10), int64(len(head)+1), now
+	return nil
+}
+
+func (r *Recorder) closeFile() error {
+	if r.file == nil {
+		return nil
+	}
+	err := errors.Join(r.w.Flush(), r.file.Sync(), r.file.Close())
+	r.file, r.w = nil, nil
+	return err
+}
+
+// prune deletes the oldest files beyond max_files , the current one always stays
+func (r *Recorder) prune() {
+	if r.cfg.MaxFiles == 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(r.cfg.Dir, FilePrefix+"*"+FileSuffix))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for len(files) > r.cfg.MaxFiles {
+		if files[0] != r.file.Name() {
+			if err := os.Remove(files[0]); err != nil {
+				r.log.Error("recording prune failed", "file", files[0], "err", err)
+			}
+		}
+		files = files[1:]
+	}
+}
+
+// MarketDataTee records every message on its way to next , for the upstream side of the symbol manager
+func (r *Recorder) MarketDataTee(next contracts.BroadCasterForPubSub) contracts.BroadCasterForPubSub {
+	return marketDataTee{r: r, next: next}
+}
+
+// OrderEventsTee records every batch on its way to next , for the order events poller
+func (r *Recorder) OrderEventsTee(next shm.BrodCaster) shm.BrodCaster {
+	return orderEventsTee{r: r, next: next}
+}
+
+type marketDataTee struct {
+	r    *Recorder
+	next contracts.BroadCasterForPubSub
+}
+
+func (t marketDataTee) BroadCasteFromRemote(msg contracts.MessageFromPubSubForUser) {
+	now := time.Now()
+	t.next.BroadCasteFromRemote(msg)
+	t.r.MarketData(now, msg)
+}
+
+type orderEventsTee struct {
+	r    *Recorder
+	next shm.BrodCaster
+}
+
+func (t orderEventsTee) BrodCast(event shm.OrderEvent) {
+	now := time.Now()
+	t.next.BrodCast(event)
+	t.r.OrderEvents(now, []shm.OrderEvent{event})
+}
+
+func (t orderEventsTee) BrodCastBatch(events []shm.OrderEvent) {
+	now := time.Now()
+	t.next.BrodCastBatch(events)
+	t.r.OrderEvents(now, events)
+}
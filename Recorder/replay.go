@@ -0,0 +1,153 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	shm "exchange/Shm"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sink is where a replay goes , *gateway.Gateway is one : market data reaches the symbol manager and
+// order events the hub exactly as if redis and the ring had delivered them
+type Sink interface {
+	PublishMarketData(stream string, data json.RawMessage)
+	PublishOrderEvents(events ...shm.OrderEvent)
+}
+
+type replayOptions struct {
+	speed   float64
+	maxGap  time.Duration
+	from    time.Time
+	to      time.Time
+	streams []string
+	users   []uint64
+	each    func(Record)
+}
+
+type ReplayOption func(*replayOptions)
+
+// WithSpeed plays the recording speed times faster than it was recorded , 1 is the original pace , 0 does not wait at all
+func WithSpeed(speed float64) ReplayOption {
+	return func(o *replayOptions) { o.speed = speed }
+}
+
+// WithMaxGap shortens quiet stretches longer than d to d , before speed is applied , 0 keeps them
+func WithMaxGap(d time.Duration) ReplayOption {
+	return func(o *replayOptions) { o.maxGap = d }
+}
+
+// WithWindow skips records received before from or after to , a zero time leaves that side open
+func WithWindow(from, to time.Time) ReplayOption {
+	return func(o *replayOptions) { o.from, o.to = from, to }
+}
+
+// WithStreams only replays market data streams starting with one of the prefixes , order events are not affected
+func WithStreams(prefixes ...string) ReplayOption {
+	return func(o *replayOptions) { o.streams = prefixes }
+}
+
+// WithUsers only replays the order events of these users , market data is not affected
+func WithUsers(ids ...uint64) ReplayOption {
+	return func(o *replayOptions) { o.users = ids }
+}
+
+// WithEach is called with every record right after it went to the sink , for progress or a dump
+func WithEach(fn func(Record)) ReplayOption {
+	return func(o *replayOptions) { o.each = fn }
+}
+
+type ReplayStats struct {
+	MarketData  int           // messages published
+	OrderEvents int           // events published
+	Batches     int           // order events records they came in , one per poller batch
+	Skipped     int           // records outside the window or filtered out
+	First, Last time.Time     // receive times of the first and last record replayed
+	Took        time.Duration // wall time of the replay
+}
+
+// Replay feeds every record of rd to sink , spaced like they were received (see WithSpeed) , until io.EOF or ctx is done
+func Replay(ctx context.Context, rd *Reader, sink Sink, opts ...ReplayOption) (st ReplayStats, err error) {
+	o := replayOptions{speed: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	started := time.Now()
+	defer func() { st.Took = time.Since(started) }()
+
+	var timer *time.Timer
+	var origin time.Time // when the first record was replayed
+	var prev int64       // receive time of the previous record replayed
+	var at time.Duration // where the replay is in recorded time since the first record , gaps already capped
+	for {
+		rec, err := rd.Next()
+		if errors.Is(err, io.EOF) {
+			return st, nil
+		}
+		if err != nil {
+			return st, err
+		}
+		if !o.keep(&rec) {
+			st.Skipped++
+			continue
+		}
+
+		if prev != 0 && o.speed > 0 {
+			gap := time.Duration(rec.Time - prev)
+			if o.maxGap > 0 && gap > o.maxGap {
+				gap = o.maxGap
+			}
+			at += max(gap, 0) // streams are recorded from several goroutines , times can step back a little
+			if wait := time.Until(origin.Add(time.Duration(float64(at) / o.speed))); wait > 0 {
+				if timer == nil {
+					timer = time.NewTimer(wait)
+					defer timer.Stop()
+				} else {
+					timer.Reset(wait)
+				}
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return st, ctx.Err()
+				}
+			}
+		} else if err := ctx.Err(); err != nil {
+			return st, err
+		}
+		if prev == 0 {
+			origin, st.First = time.Now(), time.Unix(0, rec.Time)
+		}
+		prev = rec.Time
+		st.Last = time.Unix(0, rec.Time)
+
+		if rec.IsMarketData() {
+			sink.PublishMarketData(rec.Stream, rec.Data)
+			st.MarketData++
+		} else {
+			sink.PublishOrderEvents(rec.Events...)
+			st.OrderEvents += len(rec.Events)
+			st.Batches++
+		}
+		if o.each != nil {
+			o.each(rec)
+		}
+	}
+}
+
+// keep applies the window and the filters , an order events batch keeps only the events of the users asked for
+func (o *replayOptions) keep(rec *Record) bool {
+	t := time.Unix(0, rec.Time)
+	if (!o.from.IsZero() && t.Before(o.from)) || (!o.to.IsZero() && t.After(o.to)) {
+		return false
+	}
+	if rec.IsMarketData() {
+		return len(o.streams) == 0 || slices.ContainsFunc(o.streams, func(p string) bool { return strings.HasPrefix(rec.Stream, p) })
+	}
+	if len(o.users) > 0 {
+		rec.Events = slices.DeleteFunc(rec.Events, func(ev shm.OrderEvent) bool { return !slices.Contains(o.users, ev.UserId) })
+	}
+	return len(rec.Events) > 0
+}
@@ -1,103 +1,409 @@
 package symbolmanager
 
 import (
+	"context"
 	"encoding/json"
-	contracts "exchange/Contracts"
+	"errors"
 	"fmt"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	logging "exchange/Logging"
+	metrics "exchange/Metrics"
+	wire "exchange/Wire"
+	"log/slog"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"github.com/gorilla/websocket"
 )
 
 // receives the message from the web socket go routine lanched oer client , message can be of two typs subscribe and unsubscribe
-// a singelton patteern of the symbol manager
-
-var SymbolManagerInstance *SymbolManager
-var once sync.Once
+// one per gateway , built with New and the options below , nothing is package level so several can run in one process
+//
+// streams are split over shards by a hash of the name , every shard has its own loop , command channel and
+// subscriber map so one stream is always handled by one goroutine and its messages stay in order
+// a connection can have streams on several shards , its write lock is shared so writes never interleave
 
 type Client struct {
 	Conn      *websocket.Conn
-	writeLock sync.Mutex
+	writeLock *sync.Mutex // per connection , not per subscription , see connState
+	sent      *atomic.Uint64 // bytes written to the connection , shared by all its streams , may be nil
+	timeout   time.Duration  // write deadline , a half open conn must not stall the manager loop
+	threshold int            // smaller frames go out uncompressed , deflate costs more than it saves on them
+	enc       contracts.Encoding
 }
 
+// compression only happens when the client negotiated permessage-deflate , otherwise the toggles are no ops
 func (c *Client) WriteMessage(messageType int, data []byte) error {
 	c.writeLock.Lock()
 	defer c.writeLock.Unlock()
-	return c.Conn.WriteMessage(messageType, data)
+	if c.timeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	c.Conn.EnableWriteCompression(len(data) >= c.threshold)
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	if c.sent != nil {
+		c.sent.Add(uint64(len(data)))
+	}
+	return nil
+}
+
+// WritePrepared writes a frame shared by every subscriber of a broadcast , gorilla keeps one encoding
+// per compression setting so a stream is framed and deflated once and not once per client , size is the payload length
+func (c *Client) WritePrepared(pm *websocket.PreparedMessage, size int) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	if c.timeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.timeout))
+	}
+	c.Conn.EnableWriteCompression(size >= c.threshold)
+	if err := c.Conn.WritePreparedMessage(pm); err != nil {
+		return err
+	}
+	if c.sent != nil {
+		c.sent.Add(uint64(size))
+	}
+	return nil
 }
 
 type SymbolManager struct {
+	shards            []*shard
+	upstream          contracts.UpstreamPubSub // nil means local streams only
+	done              chan struct{}            // closed when every shard loop has returned , later commands are dropped
+	metrics           *metrics.Metrics
+	log               *slog.Logger
+	broadcastSample   *logging.Sampler // one fan out line per interval , this runs for every market data message
+	encodeSample      *logging.Sampler // a stream the binary encoders do not know would fail on every message
+	writeTimeout      time.Duration
+	compressThreshold int // broadcasts at least this big are compressed for clients that negotiated it
+	connsLock         sync.Mutex
+	conns             map[*websocket.Conn]*connState
+}
+
+// one partition of the streams , only its loop touches the maps
+type shard struct {
+	sm                 *SymbolManager
+	id                 int
 	Symbol_method_subs map[string][]*Client // keeps a track of the different streams and the subscirbed clients
-	Subscriber         contracts.SubscriberToPubSub
-	Unsubscriber       contracts.UnSubscriberToPubSub
 	CommandChan        chan contracts.Command
+	retained           map[string]contracts.BroadcastCommand // last Retain broadcast per stream , sent to new subscribers
+	log                *slog.Logger
+}
+
+// what the manager knows about a market data connection outside the shards
+// created by the first Subscribe and dropped by CleanupConnection , both called from the conn handler
+type connState struct {
+	writeLock sync.Mutex
+	shards    uint64 // bit per shard the conn subscribed on , cleanup only goes to those
 }
 
-func CreateSymbolManagerSingleton() *SymbolManager {
-	once.Do(func() {
-		SymbolManagerInstance = &SymbolManager{
+type Option func(*SymbolManager)
+
+// WithUpstream is where streams not starting with ! come from , the manager subscribes on the first
+// subscriber of a stream and unsubscribes after the last one and is handed back every message
+func WithUpstream(u contracts.UpstreamPubSub) Option {
+	return func(sm *SymbolManager) { sm.upstream = u }
+}
+
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(sm *SymbolManager) { sm.metrics = m }
+}
+
+// WithLogger replaces slog.Default , the manager adds its component and shard
+func WithLogger(l *slog.Logger) Option {
+	return func(sm *SymbolManager) { sm.log = l.With("component", "symbol_manager") }
+}
+
+// WithSampleInterval is how often the broadcast and encode lines get through , 0 logs every one
+func WithSampleInterval(d time.Duration) Option {
+	return func(sm *SymbolManager) {
+		sm.broadcastSample = logging.NewSampler(d)
+		sm.encodeSample = logging.NewSampler(d)
+	}
+}
+
+func New(cfg config.SymbolManagerConfig, opts ...Option) *SymbolManager {
+	sm := &SymbolManager{
+		done:              make(chan struct{}),
+		log:               slog.With("component", "symbol_manager"),
+		broadcastSample:   logging.NewSampler(logging.DefaultSampleInterval),
+		encodeSample:      logging.NewSampler(logging.DefaultSampleInterval),
+		writeTimeout:      cfg.WriteTimeout,
+		compressThreshold: cfg.CompressionThreshold,
+		conns:             make(map[*websocket.Conn]*connState),
+	}
+	for _, opt := range opts {
+		opt(sm)
+	}
+	n := cfg.Shards
+	if n <= 0 {
+		n = min(runtime.GOMAXPROCS(0), config.MaxSymbolManagerShards)
+	}
+	for i := 0; i < n; i++ {
+		sm.shards = append(sm.shards, &shard{
+			sm:                 sm,
+			id:                 i,
 			Symbol_method_subs: make(map[string][]*Client),
-			Subscriber:         nil,
-			Unsubscriber:       nil,
-			CommandChan:        make(chan contracts.Command, 1000),
-		}
-	})
-	return SymbolManagerInstance
+			CommandChan:        make(chan contracts.Command, cfg.CommandChanSize),
+			retained:           make(map[string]contracts.BroadcastCommand),
+			log:                sm.log.With("shard", i),
+		})
+	}
+	return sm
+}
+
+func (sm *SymbolManager) newClient(conn *websocket.Conn, writeLock *sync.Mutex, sent *atomic.Uint64, enc contracts.Encoding) *Client {
+	return &Client{Conn: conn, writeLock: writeLock, sent: sent, timeout: sm.writeTimeout, threshold: sm.compressThreshold, enc: enc}
 }
 
-func GetSymbolManagerInstance() *SymbolManager {
-	return SymbolManagerInstance
+// Shards is the number of manager loops
+func (sm *SymbolManager) Shards() int {
+	return len(sm.shards)
+}
+
+// CommandQueueLen is what is waiting on one shard , for the channel gauges
+func (sm *SymbolManager) CommandQueueLen(shard int) int {
+	return len(sm.shards[shard].CommandChan)
+}
+
+func (sm *SymbolManager) CommandQueueCap() int {
+	return cap(sm.shards[0].CommandChan)
+}
+
+// shardOf picks the shard of a stream , fnv-1a inline so the broadcast path does not allocate a hasher
+func (sm *SymbolManager) shardOf(stream string) *shard {
+	h := uint32(2166136261)
+	for i := 0; i < len(stream); i++ {
+		h ^= uint32(stream[i])
+		h *= 16777619
+	}
+	return sm.shards[h%uint32(len(sm.shards))]
 }
 
 // methofs for ws handler
-func (sm *SymbolManager) Subscribe(StreamName string, conn *websocket.Conn) {
-	fmt.Println("passing command to channel")
-	sm.CommandChan <- contracts.SubscribeCommand{
+// bytesSent is optional , the manager adds every market data write on conn to it
+// enc is the encoding of conn , every stream of one conn must use the same
+// Subscribe , UnSubscribe and CleanupConnection of one conn must come from one goroutine , the conn handler
+func (sm *SymbolManager) Subscribe(StreamName string, conn *websocket.Conn, bytesSent *atomic.Uint64, enc contracts.Encoding) {
+	sh := sm.shardOf(StreamName)
+	sm.connsLock.Lock()
+	st, ok := sm.conns[conn]
+	if !ok {
+		st = &connState{}
+		sm.conns[conn] = st
+	}
+	st.shards |= 1 << sh.id
+	sm.connsLock.Unlock()
+	sh.send(contracts.SubscribeCommand{
 		StreamName: StreamName,
 		Conn:       conn,
-	}
+		BytesSent:  bytesSent,
+		Encoding:   enc,
+		WriteLock:  &st.writeLock,
+	})
 }
 
 func (sm *SymbolManager) UnSubscribe(StreamName string, conn *websocket.Conn) {
-	sm.CommandChan <- contracts.UnsubscribeCommand{
+	sm.shardOf(StreamName).send(contracts.UnsubscribeCommand{
 		StreamName: StreamName,
 		Conn:       conn,
-	}
+	})
 }
 
+// CleanupConnection drops conn from every shard it subscribed on , shards that never saw it are not bothered
 func (sm *SymbolManager) CleanupConnection(conn *websocket.Conn) {
-	sm.CommandChan <- contracts.CleanupConnectionCommand{
-		Conn: conn,
+	sm.connsLock.Lock()
+	st, ok := sm.conns[conn]
+	delete(sm.conns, conn)
+	sm.connsLock.Unlock()
+	if !ok {
+		return
+	}
+	for _, sh := range sm.shards {
+		if st.shards&(1<<sh.id) != 0 {
+			sh.send(contracts.CleanupConnectionCommand{
+				Conn: conn,
+			})
+		}
 	}
 }
 
 // for the pubsusb manager
 func (sm *SymbolManager) BroadCasteFromRemote(message contracts.MessageFromPubSubForUser) {
-	fmt.Println("received brodcast request sedning to channel ")
+	sm.metrics.MessagesIn(metrics.SourceRedis, 1)
 	data, _ := json.Marshal(message)// marshal means bytes -> struct 
-	sm.CommandChan <- contracts.BroadcastCommand{
+	sm.shardOf(message.Stream).send(contracts.BroadcastCommand{
 		StreamName: message.Stream,
 		Data:       data,
+		Payload:    message.Data,
+	})
+}
+
+// Ping waits until every shard loop has worked through everything queued before it , for /readyz
+// the pings are queued on all shards first so a slow shard does not add up with the others
+func (sm *SymbolManager) Ping(ctx context.Context) error {
+	replies := make([]chan struct{}, len(sm.shards))
+	for i, sh := range sm.shards {
+		replies[i] = make(chan struct{})
+		select {
+		case sh.CommandChan <- contracts.PingCommand{Reply: replies[i]}:
+		case <-sm.done:
+			return errors.New("symbol manager stopped")
+		case <-ctx.Done():
+			return fmt.Errorf("symbol manager shard %d command channel full", i)
+		}
 	}
+	for i, reply := range replies {
+		select {
+		case <-reply:
+		case <-sm.done:
+			return errors.New("symbol manager stopped")
+		case <-ctx.Done():
+			return fmt.Errorf("symbol manager shard %d loop not responding", i)
+		}
+	}
+	return nil
 }
 
-func (sm *SymbolManager) StartSymbolMnagaer() {
-	for command := range sm.CommandChan {
-		fmt.Println("sybol manager got the command")
-		fmt.Println(command)
+// StreamSubscribers returns the subscriber count of every stream , answered by the shard loops
+func (sm *SymbolManager) StreamSubscribers(ctx context.Context) (map[string]int, error) {
+	reply := make(chan map[string]int, len(sm.shards))
+	for _, sh := range sm.shards {
+		select {
+		case sh.CommandChan <- contracts.StreamStatsCommand{Reply: reply}:
+		case <-sm.done:
+			return nil, errors.New("symbol manager stopped")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	all := map[string]int{}
+	for range sm.shards {
+		select {
+		case stats := <-reply:
+			// a stream lives on one shard only , nothing to add up
+			for stream, n := range stats {
+				all[stream] = n
+			}
+		case <-sm.done:
+			return nil, errors.New("symbol manager stopped")
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return all, nil
+}
+
+// Reply writes data to one connection from a manager loop , the shard of the system stream which every conn is on
+// data must already be in enc , see wire.Message , a conn already cleaned up gets nothing
+func (sm *SymbolManager) Reply(conn *websocket.Conn, enc contracts.Encoding, data []byte) {
+	sm.connsLock.Lock()
+	st, ok := sm.conns[conn]
+	sm.connsLock.Unlock()
+	if !ok {
+		return
+	}
+	sm.shardOf(contracts.SystemStream).send(contracts.ReplyCommand{
+		Conn:      conn,
+		Data:      data,
+		Encoding:  enc,
+		WriteLock: &st.writeLock,
+	})
+}
+
+// BroadcastSystemStatus pushes a notice to every subscriber of contracts.SystemStream , which is every
+// market data connection unless it unsubscribed , retain keeps it for connections that join later
+// data is the json systemStatus object , the manager wraps it like any stream message
+func (sm *SymbolManager) BroadcastSystemStatus(data []byte, retain bool) {
+	envelope, err := json.Marshal(contracts.MessageFromPubSubForUser{
+		Stream: contracts.SystemStream,
+		Data:   data,
+	})
+	if err != nil {
+		sm.log.Error("system status marshal failed", "err", err)
+		return
+	}
+	sm.shardOf(contracts.SystemStream).send(contracts.BroadcastCommand{
+		StreamName: contracts.SystemStream,
+		Data:       envelope,
+		Payload:    data,
+		Retain:     retain,
+	})
+}
+
+// encodeBroadcast renders a broadcast for one encoding , json connections get the envelope as it came in
+func encodeBroadcast(cmd contracts.BroadcastCommand, enc contracts.Encoding) ([]byte, error) {
+	if enc == contracts.EncodingJSON {
+		return cmd.Data, nil
+	}
+	return wire.MarketData(enc, cmd.StreamName, cmd.Payload)
+}
+
+// streams starting with ! are produced by the gateway itself and never subscribed on redis
+func isLocalStream(stream string) bool {
+	return strings.HasPrefix(stream, "!")
+}
+
+// every public method goes through here so nothing blocks once the manager has stopped
+func (sh *shard) send(cmd contracts.Command) {
+	select {
+	case sh.CommandChan <- cmd:
+	case <-sh.sm.done:
+	}
+}
+
+// StartSymbolMnagaer runs every shard loop and returns once they all stopped
+func (sm *SymbolManager) StartSymbolMnagaer(ctx context.Context) {
+	defer close(sm.done)
+	sm.log.Info("starting", "shards", len(sm.shards))
+	var wg sync.WaitGroup
+	for _, sh := range sm.shards {
+		wg.Go(func() { sh.run(ctx) })
+	}
+	wg.Wait()
+}
+
+func (sh *shard) run(ctx context.Context) {
+	sm := sh.sm
+	for {
+		var command contracts.Command
+		select {
+		case <-ctx.Done():
+			return
+		case command = <-sh.CommandChan:
+		}
 		switch c := command.(type) {
 		case contracts.SubscribeCommand:
-			fmt.Println("sybol manager got the subsirbe command")
-			sm.handleSubscribeInternal(c)
+			sh.handleSubscribeInternal(c)
 
 		case contracts.UnsubscribeCommand:
-			sm.handleUnsubscribeInternal(c)
+			sh.handleUnsubscribeInternal(c)
 
 		case contracts.CleanupConnectionCommand:
-			sm.handleCleanupInternal(c)
+			sh.handleCleanupInternal(c)
 
 		case contracts.BroadcastCommand:
-			fmt.Println("sybol manager got the brodacast command")
-			sm.handleBroadcastInternal(c)
+			sh.handleBroadcastInternal(c)
+
+		case contracts.PingCommand:
+			close(c.Reply)
+
+		case contracts.ReplyCommand:
+			reply := sm.newClient(c.Conn, c.WriteLock, nil, c.Encoding)
+			if err := reply.WriteMessage(wire.FrameType(c.Encoding), c.Data); err != nil {
+				sm.metrics.Dropped(metrics.EndpointMarketData, "write_error")
+			}
+
+		case contracts.StreamStatsCommand:
+			stats := make(map[string]int, len(sh.Symbol_method_subs))
+			for stream, clients := range sh.Symbol_method_subs {
+				stats[stream] = len(clients)
+			}
+			c.Reply <- stats
 
 		}
 	}
@@ -105,27 +411,52 @@ func (sm *SymbolManager) StartSymbolMnagaer() {
 
 // internal subscribe amd unsbbsrcibe methods , that will be called when we recive commands from the channel
 
-func (sm *SymbolManager) handleSubscribeInternal(cmd contracts.SubscribeCommand) {
+func (sh *shard) handleSubscribeInternal(cmd contracts.SubscribeCommand) {
+	sm := sh.sm
 
-	clients, exists := sm.Symbol_method_subs[cmd.StreamName]
+	clients, exists := sh.Symbol_method_subs[cmd.StreamName]
+	client := sm.newClient(cmd.Conn, cmd.WriteLock, cmd.BytesSent, cmd.Encoding)
 
 	if !exists {
-		fmt.Println("initilising stream key in map calling creategrp")
 		// First subscriber
-		sm.Symbol_method_subs[cmd.StreamName] = []*Client{{Conn: cmd.Conn}}
-		// subscription can take time so spawned a go routine
-		fmt.Println("sbscrbing to pubsubs")
-		go sm.Subscriber.SubscribeToSymbolMethod(cmd.StreamName)
-		return
+		sh.Symbol_method_subs[cmd.StreamName] = []*Client{client}
+		sm.metrics.SetStreamSubscribers(cmd.StreamName, 1)
+		if sm.upstream != nil && !isLocalStream(cmd.StreamName) {
+			sh.log.Info("first subscriber , subscribing upstream", "stream", cmd.StreamName, "remote", cmd.Conn.RemoteAddr().String())
+			// subscription can take time so spawned a go routine
+			go sm.upstream.SubscribeToSymbolMethod(cmd.StreamName, sm)
+		}
 	} else {
-		sm.Symbol_method_subs[cmd.StreamName] = append(clients, &Client{Conn: cmd.Conn})
+		if isLocalStream(cmd.StreamName) {
+			// every conn is already on the system stream , an explicit subscribe must not double its notices
+			for _, c := range clients {
+				if c.Conn == cmd.Conn {
+					return
+				}
+			}
+		}
+		sh.Symbol_method_subs[cmd.StreamName] = append(clients, client)
+		sm.metrics.SetStreamSubscribers(cmd.StreamName, len(clients)+1)
+		sh.log.Debug("subscribed", "stream", cmd.StreamName, "remote", cmd.Conn.RemoteAddr().String(), "subscribers", len(clients)+1)
 	}
 
+	if retained, ok := sh.retained[cmd.StreamName]; ok {
+		data, err := encodeBroadcast(retained, client.enc)
+		if err != nil {
+			sm.metrics.Dropped(metrics.EndpointMarketData, "encode_error")
+			sh.log.Warn("retained message encode failed", "stream", cmd.StreamName, "encoding", client.enc.String(), "err", err)
+			return
+		}
+		if err := client.WriteMessage(wire.FrameType(client.enc), data); err != nil {
+			sm.metrics.Dropped(metrics.EndpointMarketData, "write_error")
+		}
+	}
 }
 
-func (sm *SymbolManager) handleUnsubscribeInternal(cmd contracts.UnsubscribeCommand) {
+func (sh *shard) handleUnsubscribeInternal(cmd contracts.UnsubscribeCommand) {
+	sm := sh.sm
 
-	clients, exists := sm.Symbol_method_subs[cmd.StreamName]
+	clients, exists := sh.Symbol_method_subs[cmd.StreamName]
 	if !exists {
 		return // Already unsubscribed
 	}
@@ -138,32 +469,99 @@ func (sm *SymbolManager) handleUnsubscribeInternal(cmd contracts.UnsubscribeComm
 		}
 	}
 
+	sm.metrics.SetStreamSubscribers(cmd.StreamName, len(new_clients))
 	if len(new_clients) == 0 {
 		// this was the last user , delrte the entry and unsbscribe
-		delete(sm.Symbol_method_subs, cmd.StreamName)
-		if sm.Unsubscriber != nil {
-			go sm.Unsubscriber.UnSubscribeToSymbolMethod(cmd.StreamName)
+		delete(sh.Symbol_method_subs, cmd.StreamName)
+		if sm.upstream != nil && !isLocalStream(cmd.StreamName) {
+			sh.log.Info("last subscriber left , unsubscribing upstream", "stream", cmd.StreamName, "remote", cmd.Conn.RemoteAddr().String())
+			go sm.upstream.UnSubscribeToSymbolMethod(cmd.StreamName)
 		}
 
 	} else {
-		sm.Symbol_method_subs[cmd.StreamName] = new_clients
+		sh.Symbol_method_subs[cmd.StreamName] = new_clients
+		sh.log.Debug("unsubscribed", "stream", cmd.StreamName, "remote", cmd.Conn.RemoteAddr().String(), "subscribers", len(new_clients))
 	}
 }
 
-func (sm *SymbolManager) handleBroadcastInternal(cmd contracts.BroadcastCommand) {
-	fmt.Println("inside internal brodacst ")
-	fmt.Println(sm.Symbol_method_subs)
-	
-    for _, client := range sm.Symbol_method_subs[cmd.StreamName] {
-		fmt.Println(client)
+func (sh *shard) handleBroadcastInternal(cmd contracts.BroadcastCommand) {
+	sm := sh.sm
+	if cmd.Retain {
+		sh.retained[cmd.StreamName] = cmd
+	} else if isLocalStream(cmd.StreamName) {
+		delete(sh.retained, cmd.StreamName)
+	}
+	clients := sh.Symbol_method_subs[cmd.StreamName]
+	if ok, skipped := sm.broadcastSample.Allow(); ok && sh.log.Enabled(context.Background(), slog.LevelDebug) {
+		sh.log.Debug("fan out", "stream", cmd.StreamName, "subscribers", len(clients), "bytes", len(cmd.Data), "skipped", skipped)
+	}
+
+	// encoded once per encoding in use on the stream , on the first subscriber that needs it
+	var frames [contracts.EncodingCount]broadcastFrame
+    for _, client := range clients {
+		f := &frames[client.enc]
+		if !f.built {
+			f.build(cmd, client.enc)
+			if f.err != nil {
+				if ok, skipped := sm.encodeSample.Allow(); ok {
+					sh.log.Warn("broadcast encode failed", "stream", cmd.StreamName, "encoding", client.enc.String(), "err", f.err, "skipped", skipped)
+				}
+			}
+		}
+		if f.err != nil {
+			sm.metrics.Dropped(metrics.EndpointMarketData, "encode_error")
+			continue
+		}
 		// important decision to write go or not here
-         client.WriteMessage(websocket.TextMessage, cmd.Data)
+		var err error
+		if pm := f.shared(sm.compressThreshold); pm != nil {
+			err = client.WritePrepared(pm, len(f.data))
+		} else {
+			err = client.WriteMessage(f.frameType, f.data)
+		}
+         if err != nil {
+			sm.metrics.Dropped(metrics.EndpointMarketData, "write_error")
+			sh.log.Debug("market data write failed", "stream", cmd.StreamName, "remote", client.Conn.RemoteAddr().String(), "err", err)
+			continue
+		}
+		sm.metrics.MessageOut(metrics.EndpointMarketData)
     }
 }
 
-func (s *SymbolManager) handleCleanupInternal(cmd contracts.CleanupConnectionCommand) {
+// one broadcast in one encoding , every subscriber after the first writes the same prepared frame
+// so the framing and the deflate happen once per stream and not once per client
+type broadcastFrame struct {
+	built     bool
+	data      []byte
+	frameType int
+	writes    int
+	prepared  *websocket.PreparedMessage
+	err       error
+}
+
+func (f *broadcastFrame) build(cmd contracts.BroadcastCommand, enc contracts.Encoding) {
+	f.built = true
+	f.frameType = wire.FrameType(enc)
+	f.data, f.err = encodeBroadcast(cmd, enc)
+}
 
-	for key, clients := range s.Symbol_method_subs {
+// shared returns the prepared frame for the next write , nil means write f.data directly
+// a stream with a single small subscriber skips the extra copy , anything compressible is prepared
+// straight away so even one client does not deflate the same bytes twice
+func (f *broadcastFrame) shared(compressThreshold int) *websocket.PreparedMessage {
+	f.writes++
+	if f.prepared == nil && (f.writes > 1 || len(f.data) >= compressThreshold) {
+		if pm, err := websocket.NewPreparedMessage(f.frameType, f.data); err == nil {
+			f.prepared = pm
+		}
+	}
+	return f.prepared
+}
+
+func (sh *shard) handleCleanupInternal(cmd contracts.CleanupConnectionCommand) {
+	s := sh.sm
+
+	for key, clients := range sh.Symbol_method_subs {
 		newClients := []*Client{}
 		for _, client := range clients {
 			if client.Conn != cmd.Conn {
@@ -171,13 +569,17 @@ func (s *SymbolManager) handleCleanupInternal(cmd contracts.CleanupConnectionCom
 			}
 		}
 
+		if len(newClients) != len(clients) {
+			s.metrics.SetStreamSubscribers(key, len(newClients))
+		}
 		if len(newClients) == 0 {
-			delete(s.Symbol_method_subs, key)
-			if s.Unsubscriber != nil {
-				go s.Unsubscriber.UnSubscribeToSymbolMethod(key)
+			delete(sh.Symbol_method_subs, key)
+			if s.upstream != nil && !isLocalStream(key) {
+				sh.log.Info("last subscriber left , unsubscribing upstream", "stream", key, "remote", cmd.Conn.RemoteAddr().String())
+				go s.upstream.UnSubscribeToSymbolMethod(key)
 			}
 		} else if len(newClients) != len(clients) {
-			s.Symbol_method_subs[key] = newClients
+			sh.Symbol_method_subs[key] = newClients
 		}
 	}
 }
@@ -0,0 +1,187 @@
+package symbolmanager
+
+import (
+	"context"
+	"encoding/json"
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// hammers the sharded manager from many goroutines , meant for go test -race
+// publishers broadcast numbered messages on local streams while connection handlers subscribe , unsubscribe ,
+// ask for replies and clean up , the clients check that every stream arrives in order
+
+type stressCounters struct {
+	received   atomic.Uint64
+	replies    atomic.Uint64
+	outOfOrder atomic.Uint64
+	subscribes atomic.Uint64
+}
+
+func TestConcurrentSubscriptionsKeepStreamOrder(t *testing.T) {
+	shards, streams, clients, messages := 8, 32, 40, 200
+	if testing.Short() {
+		streams, clients, messages = 16, 10, 50
+	}
+
+	sm := New(config.SymbolManagerConfig{
+		Shards:          shards,
+		CommandChanSize: 256, // small so the publishers and handlers block on full shards too
+		WriteTimeout:    10 * time.Second,
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sm.StartSymbolMnagaer(ctx)
+
+	names := make([]string, streams)
+	for i := range names {
+		names[i] = fmt.Sprintf("!stress.%d", i) // local , the manager does not go to redis for these
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cnt stressCounters
+	publishing := make(chan struct{})
+	var handlers sync.WaitGroup
+	upgrader := websocket.Upgrader{}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.Add(1) // before the 101 goes out , the dial below returns only after it
+		defer handlers.Done()
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		churn(sm, conn, names, publishing, &cnt)
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	var readers sync.WaitGroup
+	for range clients {
+		c, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		readers.Go(func() { readInOrder(c, &cnt) })
+	}
+
+	var publishers sync.WaitGroup
+	for _, name := range names {
+		publishers.Go(func() {
+			for seq := 1; seq <= messages; seq++ {
+				sm.BroadCasteFromRemote(contracts.MessageFromPubSubForUser{
+					Stream: name,
+					Data:   json.RawMessage(fmt.Sprintf(`{"e":"trade","seq":%d}`, seq)),
+				})
+			}
+		})
+	}
+	// the admin and readiness paths run next to everything else
+	var stats sync.WaitGroup
+	stats.Go(func() {
+		for {
+			select {
+			case <-publishing:
+				return
+			default:
+			}
+			if err := sm.Ping(ctx); err != nil {
+				t.Errorf("ping: %v", err)
+			}
+			if _, err := sm.StreamSubscribers(ctx); err != nil {
+				t.Errorf("stream subscribers: %v", err)
+			}
+		}
+	})
+	publishers.Wait()
+	close(publishing)
+	stats.Wait()
+	handlers.Wait()
+	readers.Wait()
+
+	if err := sm.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	left, err := sm.StreamSubscribers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("subscribes %d , delivered %d , replies %d", cnt.subscribes.Load(), cnt.received.Load(), cnt.replies.Load())
+	if n := cnt.outOfOrder.Load(); n != 0 {
+		t.Errorf("%d messages out of order", n)
+	}
+	if len(left) != 0 {
+		t.Errorf("streams still subscribed after every connection was cleaned up: %v", left)
+	}
+	if cnt.received.Load() == 0 {
+		t.Error("nothing was delivered")
+	}
+}
+
+// churn plays the ws handler , every call for one conn comes from this goroutine like in the gateway
+func churn(sm *SymbolManager, conn *websocket.Conn, names []string, publishing chan struct{}, cnt *stressCounters) {
+	var sent atomic.Uint64
+	subscribed := map[string]bool{}
+	for {
+		select {
+		case <-publishing:
+			// same order as the gateway , shards still holding the conn get write errors until the cleanup reaches them
+			conn.Close()
+			sm.CleanupConnection(conn)
+			return
+		default:
+		}
+		name := names[rand.IntN(len(names))]
+		switch {
+		case rand.IntN(20) == 0:
+			sm.Reply(conn, contracts.EncodingJSON, []byte(`{"id":1,"result":"pong"}`))
+		case subscribed[name]:
+			sm.UnSubscribe(name, conn)
+			delete(subscribed, name)
+		default:
+			sm.Subscribe(name, conn, &sent, contracts.EncodingJSON)
+			subscribed[name] = true
+			cnt.subscribes.Add(1)
+		}
+		time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+	}
+}
+
+// readInOrder checks that the numbers of every stream only go up , gaps are fine since the handler churns
+func readInOrder(c *websocket.Conn, cnt *stressCounters) {
+	defer c.Close()
+	last := map[string]int{}
+	for {
+		_, p, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg struct {
+			Stream string `json:"stream"`
+			Data   struct {
+				Seq int `json:"seq"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(p, &msg); err != nil || msg.Stream == "" {
+			cnt.replies.Add(1)
+			continue
+		}
+		cnt.received.Add(1)
+		if msg.Data.Seq <= last[msg.Stream] {
+			cnt.outOfOrder.Add(1)
+		}
+		last[msg.Stream] = msg.Data.Seq
+	}
+}
@@ -0,0 +1,150 @@
+package wire_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "exchange/Config"
+	contracts "exchange/Contracts"
+	symbolmanager "exchange/SymbolManager"
+
+	"github.com/gorilla/websocket"
+)
+
+// bandwidth and cpu of the market data fan out , the real symbol manager on a local stream with websocket
+// clients on loopback , one op is one depth update broadcast to every client
+//
+//	off         clients do not negotiate permessage-deflate , the symbol manager frames each broadcast once
+//	loop        clients do not negotiate it , every client write frames the envelope on its own , the old fan out
+//	shared      clients negotiate it , the symbol manager compresses each broadcast once for all of them
+//	per_client  clients negotiate it , every client write deflates on its own , what a plain WriteMessage loop costs
+//
+// clients read the raw socket and never inflate , wire-B/op is what went on the sockets and ratio the share of the payload
+//
+//	go test ./Wire -run - -bench Fanout -benchtime 500x
+
+const (
+	fanoutStream  = "!bench.depth" // local stream , the symbol manager does not go to redis for it
+	fanoutClients = 200
+	fanoutLevels  = 50
+)
+
+func BenchmarkFanout(b *testing.B) {
+	for _, mode := range []string{"off", "loop", "shared", "per_client"} {
+		b.Run(mode, func(b *testing.B) { benchFanout(b, mode) })
+	}
+}
+
+func benchFanout(b *testing.B, mode string) {
+	sm := symbolmanager.New(config.SymbolManagerConfig{
+		CommandChanSize:      4096,
+		WriteTimeout:         10 * time.Second,
+		CompressionThreshold: 512,
+	}, symbolmanager.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sm.StartSymbolMnagaer(ctx)
+
+	var written atomic.Uint64
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	accepted := make(chan *websocket.Conn, fanoutClients)
+	upgrader := websocket.Upgrader{EnableCompression: true}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.SetCompressionLevel(1)
+		accepted <- conn
+	})}
+	go srv.Serve(countingListener{Listener: ln, written: &written})
+	defer srv.Close()
+
+	dialer := websocket.Dialer{EnableCompression: mode == "shared" || mode == "per_client"}
+	conns := make([]*websocket.Conn, 0, fanoutClients)
+	for range fanoutClients {
+		c, _, err := dialer.Dial("ws://"+ln.Addr().String()+"/", nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer c.Close()
+		// drain the socket without parsing frames
+		go io.Copy(io.Discard, c.NetConn())
+		conn := <-accepted
+		defer conn.Close()
+		conns = append(conns, conn)
+		sm.Subscribe(fanoutStream, conn, nil, contracts.EncodingJSON)
+	}
+	if err := sm.Ping(ctx); err != nil {
+		b.Fatal(err)
+	}
+
+	updates := depthUpdates(100, fanoutLevels)
+	envelopes := make([][]byte, len(updates))
+	for i, data := range updates {
+		envelopes[i], _ = json.Marshal(contracts.MessageFromPubSubForUser{Stream: fanoutStream, Data: data})
+	}
+	var payload uint64
+	written.Store(0)
+	b.ResetTimer()
+	for i := range b.N {
+		data, envelope := updates[i%len(updates)], envelopes[i%len(updates)]
+		payload += uint64(len(envelope) * len(conns))
+		if mode == "off" || mode == "shared" {
+			sm.BroadCasteFromRemote(contracts.MessageFromPubSubForUser{Stream: fanoutStream, Data: data})
+			continue
+		}
+		for _, conn := range conns {
+			conn.EnableWriteCompression(mode == "per_client")
+			if err := conn.WriteMessage(websocket.TextMessage, envelope); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	// queued behind every broadcast on the shard
+	if err := sm.Ping(ctx); err != nil {
+		b.Fatal(err)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(written.Load())/float64(b.N), "wire-B/op")
+	b.ReportMetric(float64(written.Load())/float64(payload), "ratio")
+
+	for _, conn := range conns {
+		sm.CleanupConnection(conn)
+	}
+}
+
+// countingListener counts what the server writes , gorilla hijacks these conns so websocket frames are included
+type countingListener struct {
+	net.Listener
+	written *atomic.Uint64
+}
+
+type countingConn struct {
+	net.Conn
+	written *atomic.Uint64
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{Conn: c, written: l.written}, nil
+}
+
+func (c countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.written.Add(uint64(n))
+	return n, err
+}
@@ -0,0 +1,132 @@
+package wire
+
+import (
+	contracts "exchange/Contracts"
+)
+
+// one wrapper per contract type , fields are written in schema order
+// protobuf tags and sbe field order must match gateway.proto and sbe.xml , json keys match the contract tags
+
+type depth contracts.DepthData
+
+func (depth) template() uint16 { return templateDepth }
+func (m depth) write(w writer) {
+	w.event(m.Event)
+	w.u32(1, "s", m.Symbol)
+	w.i64(2, "E", m.EventTime)
+	w.i64(3, "T", m.TradeTime)
+	w.i64(4, "U", m.FirstID)
+	w.i64(5, "u", m.LastID)
+	w.levels(6, "b", m.Bids)
+	w.levels(7, "a", m.Asks)
+}
+
+type bookTicker contracts.BookTickerData
+
+func (bookTicker) template() uint16 { return templateBookTicker }
+func (m bookTicker) write(w writer) {
+	w.event(m.Event)
+	w.u32(1, "s", m.Symbol)
+	w.i64(2, "E", m.EventTime)
+	w.i64(3, "T", m.TradeTime)
+	w.decimal(4, "b", m.BestBid)
+	w.decimal(5, "B", m.BestBidQty)
+	w.decimal(6, "a", m.BestAsk)
+	w.decimal(7, "A", m.BestAskQty)
+	w.i64(8, "u", m.UpdateID)
+}
+
+type trade contracts.TradeData
+
+func (trade) template() uint16 { return templateTrade }
+func (m trade) write(w writer) {
+	w.event(m.Event)
+	w.u32(1, "s", m.Symbol)
+	w.i64(2, "E", m.EventTime)
+	w.i64(3, "T", m.TradeTime)
+	w.i64(4, "t", m.TradeID)
+	w.u64(5, "p", m.Price)
+	w.u32(6, "q", m.Quantity)
+	w.boolean(9, "m", m.IsBuyerMaker)
+	w.str(7, "a", m.BuyerOrderID)
+	w.str(8, "b", m.SellerOrderID)
+}
+
+type ticker contracts.TickerData
+
+func (ticker) template() uint16 { return templateTicker }
+func (m ticker) write(w writer) {
+	w.event(m.Event)
+	w.u32(1, "s", m.Symbol)
+	w.i64(2, "E", m.EventTime)
+	w.u64(3, "p", m.Price)
+}
+
+type systemStatus contracts.SystemStatusData
+
+func (systemStatus) template() uint16 { return templateSystemStatus }
+func (m systemStatus) write(w writer) {
+	w.event(m.Event)
+	w.i64(1, "E", m.EventTime)
+	w.i64(5, "startsAt", m.StartsAt)
+	w.i64(6, "endsAt", m.EndsAt)
+	w.u32s(4, "symbols", m.Symbols)
+	w.str(2, "status", string(m.Status))
+	w.str(3, "message", m.Message)
+}
+
+// order events keep the field names of the json they always had , Seq came later and is last
+type orderEvent contracts.SequencedOrderEvent
+
+func (orderEvent) template() uint16 { return templateOrderEvent }
+func (m orderEvent) write(w writer) {
+	w.u64(1, "UserId", m.UserId)
+	w.u64(2, "OrderId", m.OrderId)
+	w.u32(3, "Symbol", m.Symbol)
+	w.u32(4, "EventKind", m.EventKind)
+	w.u32(5, "FilledQty", m.FilledQty)
+	w.u32(6, "RemainingQty", m.RemainingQty)
+	w.u32(7, "OriginalQty", m.OriginalQty)
+	w.u32(8, "ErrorCode", m.ErrorCode)
+	w.u64(9, "Seq", m.Seq)
+}
+
+type orderEventsSession contracts.OrderEventsSessionData
+
+func (orderEventsSession) template() uint16 { return templateOrderEventsSession }
+func (m orderEventsSession) write(w writer) {
+	w.event(m.Event)
+	w.i64(1, "E", m.EventTime)
+	w.u64(2, "epoch", m.Epoch)
+	w.u64(3, "seq", m.Seq)
+	w.boolean(4, "gap", m.Gap)
+}
+
+type pong contracts.PongMessage
+
+func (pong) template() uint16 { return templatePong }
+func (m pong) write(w writer) {
+	w.i64(1, "id", int64(m.ID))
+	w.i64(3, "time", m.Time)
+	w.str(2, "result", m.Result)
+}
+
+type errorMessage contracts.ErrorMessage
+
+func (errorMessage) template() uint16 { return templateError }
+func (m errorMessage) write(w writer) {
+	w.i64(1, "id", int64(m.ID))
+	w.object(2, "error", func(w writer) {
+		w.str(1, "code", m.Error.Code)
+		w.str(2, "msg", m.Error.Msg)
+	})
+}
+
+type connectionExpiring contracts.ConnectionExpiringData
+
+func (connectionExpiring) template() uint16 { return templateConnectionExpiring }
+func (m connectionExpiring) write(w writer) {
+	w.event(m.Event)
+	w.i64(1, "E", m.EventTime)
+	w.i64(2, "closeAt", m.CloseAt)
+}
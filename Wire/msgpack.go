@@ -0,0 +1,176 @@
+package wire
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// msgpack , every message is a map keyed like its json , every key is always present
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) encode(stream string, m message) ([]byte, error) {
+	body := &msgpackWriter{}
+	m.write(body)
+	if stream == "" {
+		return body.bytes(nil), nil
+	}
+	env := &msgpackWriter{}
+	env.key("stream")
+	env.buf = appendMsgpackStr(env.buf, stream)
+	env.key("data")
+	env.buf = body.bytes(env.buf)
+	return env.bytes(nil), nil
+}
+
+// msgpackWriter collects the entries of one map , the header needs the count so it is written last
+type msgpackWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *msgpackWriter) bytes(dst []byte) []byte {
+	if w.n < 16 {
+		dst = append(dst, 0x80|byte(w.n))
+	} else {
+		dst = append(dst, 0xde)
+		dst = binary.BigEndian.AppendUint16(dst, uint16(w.n))
+	}
+	return append(dst, w.buf...)
+}
+
+func (w *msgpackWriter) key(k string) {
+	w.n++
+	w.buf = appendMsgpackStr(w.buf, k)
+}
+
+func (w *msgpackWriter) event(name string) {
+	w.key("e")
+	w.buf = appendMsgpackStr(w.buf, name)
+}
+
+func (w *msgpackWriter) str(_ int, key string, v string) {
+	w.key(key)
+	w.buf = appendMsgpackStr(w.buf, v)
+}
+
+func (w *msgpackWriter) u32(_ int, key string, v uint32) {
+	w.key(key)
+	w.buf = appendMsgpackUint(w.buf, uint64(v))
+}
+
+func (w *msgpackWriter) u64(_ int, key string, v uint64) {
+	w.key(key)
+	w.buf = appendMsgpackUint(w.buf, v)
+}
+
+func (w *msgpackWriter) i64(_ int, key string, v int64) {
+	w.key(key)
+	w.buf = appendMsgpackInt(w.buf, v)
+}
+
+func (w *msgpackWriter) boolean(_ int, key string, v bool) {
+	w.key(key)
+	if v {
+		w.buf = append(w.buf, 0xc3)
+	} else {
+		w.buf = append(w.buf, 0xc2)
+	}
+}
+
+func (w *msgpackWriter) decimal(tag int, key string, v string) {
+	w.str(tag, key, v)
+}
+
+func (w *msgpackWriter) levels(_ int, key string, v [][]string) {
+	w.key(key)
+	w.buf = appendMsgpackArray(w.buf, len(v))
+	for _, level := range v {
+		w.buf = appendMsgpackArray(w.buf, len(level))
+		for _, s := range level {
+			w.buf = appendMsgpackStr(w.buf, s)
+		}
+	}
+}
+
+func (w *msgpackWriter) u32s(_ int, key string, v []uint32) {
+	w.key(key)
+	w.buf = appendMsgpackArray(w.buf, len(v))
+	for _, n := range v {
+		w.buf = appendMsgpackUint(w.buf, uint64(n))
+	}
+}
+
+func (w *msgpackWriter) object(_ int, key string, fn func(w writer)) {
+	child := &msgpackWriter{}
+	fn(child)
+	w.key(key)
+	w.buf = child.bytes(w.buf)
+}
+
+func appendMsgpackStr(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackArray(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xdc)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdd)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+}
+
+func appendMsgpackUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		b = append(b, 0xcd)
+		return binary.BigEndian.AppendUint16(b, uint16(v))
+	case v <= math.MaxUint32:
+		b = append(b, 0xce)
+		return binary.BigEndian.AppendUint32(b, uint32(v))
+	default:
+		b = append(b, 0xcf)
+		return binary.BigEndian.AppendUint64(b, v)
+	}
+}
+
+func appendMsgpackInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		b = append(b, 0xd1)
+		return binary.BigEndian.AppendUint16(b, uint16(v))
+	case v >= math.MinInt32:
+		b = append(b, 0xd2)
+		return binary.BigEndian.AppendUint32(b, uint32(v))
+	default:
+		b = append(b, 0xd3)
+		return binary.BigEndian.AppendUint64(b, uint64(v))
+	}
+}
@@ -0,0 +1,95 @@
+package wire
+
+import "google.golang.org/protobuf/encoding/protowire"
+
+// protobuf , proto3 rules : zero values are left out , repeated numbers are packed
+// every frame is a Frame with the stream in field 1 and the payload in field 10 + template id
+
+type protobufCodec struct{}
+
+func (protobufCodec) encode(stream string, m message) ([]byte, error) {
+	body := &protobufWriter{}
+	m.write(body)
+	var b []byte
+	if stream != "" {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, stream)
+	}
+	b = protowire.AppendTag(b, protowire.Number(10+m.template()), protowire.BytesType)
+	return protowire.AppendBytes(b, body.buf), nil
+}
+
+type protobufWriter struct {
+	buf []byte
+}
+
+func (w *protobufWriter) event(string) {}
+
+func (w *protobufWriter) str(tag int, _ string, v string) {
+	if v == "" {
+		return
+	}
+	w.buf = protowire.AppendTag(w.buf, protowire.Number(tag), protowire.BytesType)
+	w.buf = protowire.AppendString(w.buf, v)
+}
+
+func (w *protobufWriter) u32(tag int, key string, v uint32) {
+	w.u64(tag, key, uint64(v))
+}
+
+func (w *protobufWriter) u64(tag int, _ string, v uint64) {
+	if v == 0 {
+		return
+	}
+	w.buf = protowire.AppendTag(w.buf, protowire.Number(tag), protowire.VarintType)
+	w.buf = protowire.AppendVarint(w.buf, v)
+}
+
+func (w *protobufWriter) i64(tag int, key string, v int64) {
+	// int64 in the schema , negative values take ten bytes which timestamps and ids never are
+	w.u64(tag, key, uint64(v))
+}
+
+func (w *protobufWriter) boolean(tag int, key string, v bool) {
+	if v {
+		w.u64(tag, key, 1)
+	}
+}
+
+func (w *protobufWriter) decimal(tag int, key string, v string) {
+	w.str(tag, key, v)
+}
+
+// each level is a Level message , price in field 1 and quantity in field 2
+func (w *protobufWriter) levels(tag int, _ string, v [][]string) {
+	for _, level := range v {
+		entry := &protobufWriter{}
+		if len(level) > 0 {
+			entry.str(1, "", level[0])
+		}
+		if len(level) > 1 {
+			entry.str(2, "", level[1])
+		}
+		w.buf = protowire.AppendTag(w.buf, protowire.Number(tag), protowire.BytesType)
+		w.buf = protowire.AppendBytes(w.buf, entry.buf)
+	}
+}
+
+func (w *protobufWriter) u32s(tag int, _ string, v []uint32) {
+	if len(v) == 0 {
+		return
+	}
+	var packed []byte
+	for _, n := range v {
+		packed = protowire.AppendVarint(packed, uint64(n))
+	}
+	w.buf = protowire.AppendTag(w.buf, protowire.Number(tag), protowire.BytesType)
+	w.buf = protowire.AppendBytes(w.buf, packed)
+}
+
+func (w *protobufWriter) object(tag int, _ string, fn func(w writer)) {
+	child := &protobufWriter{}
+	fn(child)
+	w.buf = protowire.AppendTag(w.buf, protowire.Number(tag), protowire.BytesType)
+	w.buf = protowire.AppendBytes(w.buf, child.buf)
+}
@@ -0,0 +1,159 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sbe , little endian , layout per template in sbe.xml
+//
+//	header     blockLength u16 , templateId u16 , schemaId u16 , version u16
+//	block      the fixed fields of the template in schema order
+//	groups     per group blockLength u16 , numInGroup u16 , then the entries
+//	var data   per field length u16 then the bytes , the first one is always the stream , empty outside market data
+//
+// prices and quantities are decimals : mantissa i64 then exponent i8 , a null decimal has mantissa math.MinInt64
+
+const (
+	sbeSchemaID      = 1
+	sbeSchemaVersion = 2 // 2 appended seq to OrderEvent and added OrderEventsSession
+	sbeDecimalSize   = 9
+)
+
+var errDecimal = errors.New("invalid decimal")
+
+type sbeCodec struct{}
+
+func (sbeCodec) encode(stream string, m message) ([]byte, error) {
+	w := &sbeWriter{}
+	w.varData(stream)
+	m.write(w)
+	if w.err != nil {
+		return nil, w.err
+	}
+	b := make([]byte, 0, 8+len(w.block)+len(w.groups)+len(w.vars))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(w.block)))
+	b = binary.LittleEndian.AppendUint16(b, m.template())
+	b = binary.LittleEndian.AppendUint16(b, sbeSchemaID)
+	b = binary.LittleEndian.AppendUint16(b, sbeSchemaVersion)
+	b = append(b, w.block...)
+	b = append(b, w.groups...)
+	return append(b, w.vars...), nil
+}
+
+type sbeWriter struct {
+	block  []byte
+	groups []byte
+	vars   []byte
+	err    error // first failure , the rest of the message is still walked but not sent
+}
+
+func (w *sbeWriter) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+func (w *sbeWriter) varData(v string) {
+	if len(v) > math.MaxUint16 {
+		w.fail(fmt.Errorf("sbe var data of %d bytes is too long", len(v)))
+		return
+	}
+	w.vars = binary.LittleEndian.AppendUint16(w.vars, uint16(len(v)))
+	w.vars = append(w.vars, v...)
+}
+
+func (w *sbeWriter) event(string) {}
+
+func (w *sbeWriter) str(_ int, _ string, v string) {
+	w.varData(v)
+}
+
+func (w *sbeWriter) u32(_ int, _ string, v uint32) {
+	w.block = binary.LittleEndian.AppendUint32(w.block, v)
+}
+
+func (w *sbeWriter) u64(_ int, _ string, v uint64) {
+	w.block = binary.LittleEndian.AppendUint64(w.block, v)
+}
+
+func (w *sbeWriter) i64(_ int, _ string, v int64) {
+	w.block = binary.LittleEndian.AppendUint64(w.block, uint64(v))
+}
+
+func (w *sbeWriter) boolean(_ int, _ string, v bool) {
+	if v {
+		w.block = append(w.block, 1)
+	} else {
+		w.block = append(w.block, 0)
+	}
+}
+
+func (w *sbeWriter) decimal(_ int, key string, v string) {
+	var err error
+	w.block, err = appendSBEDecimal(w.block, v)
+	if err != nil {
+		w.fail(fmt.Errorf("%s: %w", key, err))
+	}
+}
+
+// a group entry is a price and a quantity decimal
+func (w *sbeWriter) levels(_ int, key string, v [][]string) {
+	w.groupHeader(2*sbeDecimalSize, len(v))
+	for _, level := range v {
+		if len(level) != 2 {
+			w.fail(fmt.Errorf("%s: level with %d values", key, len(level)))
+			return
+		}
+		var err error
+		for _, s := range level {
+			if w.groups, err = appendSBEDecimal(w.groups, s); err != nil {
+				w.fail(fmt.Errorf("%s: %w", key, err))
+				return
+			}
+		}
+	}
+}
+
+func (w *sbeWriter) u32s(_ int, _ string, v []uint32) {
+	w.groupHeader(4, len(v))
+	for _, n := range v {
+		w.groups = binary.LittleEndian.AppendUint32(w.groups, n)
+	}
+}
+
+func (w *sbeWriter) groupHeader(blockLength, n int) {
+	if n > math.MaxUint16 {
+		w.fail(fmt.Errorf("sbe group of %d entries is too long", n))
+		n = 0
+	}
+	w.groups = binary.LittleEndian.AppendUint16(w.groups, uint16(blockLength))
+	w.groups = binary.LittleEndian.AppendUint16(w.groups, uint16(n))
+}
+
+// nested objects are flattened into the enclosing message
+func (w *sbeWriter) object(_ int, _ string, fn func(w writer)) {
+	fn(w)
+}
+
+// appendSBEDecimal parses "6500.25" into mantissa 650025 and exponent -2 , an empty string is the null decimal
+func appendSBEDecimal(b []byte, s string) ([]byte, error) {
+	if s == "" {
+		b = binary.LittleEndian.AppendUint64(b, uint64(1)<<63) // math.MinInt64
+		return append(b, 0), nil
+	}
+	intPart, frac, _ := strings.Cut(s, ".")
+	if len(frac) > math.MaxInt8 || strings.ContainsAny(frac, "+-") {
+		return b, fmt.Errorf("%w %q", errDecimal, s)
+	}
+	mantissa, err := strconv.ParseInt(intPart+frac, 10, 64)
+	if err != nil {
+		return b, fmt.Errorf("%w %q", errDecimal, s)
+	}
+	b = binary.LittleEndian.AppendUint64(b, uint64(mantissa))
+	return append(b, byte(int8(-len(frac)))), nil
+}
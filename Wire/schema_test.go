@@ -0,0 +1,206 @@
+package wire_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	contracts "exchange/Contracts"
+	shm "exchange/Shm"
+	wire "exchange/Wire"
+	"exchange/Wire/wiretest"
+)
+
+// every message in messages.go once , encoded by Wire and decoded by the reference decoders in wiretest
+// protobuf and sbe fields are written out by their schema names , msgpack has to decode to the same value as the json
+// every field is nonzero , proto3 leaves zero values out and json drops the omitempty ones
+
+const (
+	eventTime = int64(1760867227123)
+	tradeTime = int64(1760867227120)
+)
+
+type schemaCase struct {
+	name   string
+	stream string          // market data goes through wire.MarketData with this stream
+	data   json.RawMessage // the market data payload as published on redis
+	v      any             // anything else goes through wire.Message
+
+	protobuf wiretest.Frame // Stream is set from stream by the test
+	sbe      wiretest.Frame
+}
+
+var schemaCases = []schemaCase{
+	{
+		name:   "depth",
+		stream: "depth.1",
+		data:   marshal(contracts.DepthData{Event: "depth", Symbol: 1, EventTime: eventTime, TradeTime: tradeTime, FirstID: 100, LastID: 109, Bids: [][]string{{"6500.25", "0.0010"}, {"6499.50", "2"}}, Asks: [][]string{{"6501.00", "1.5"}}}),
+		protobuf: wiretest.Frame{Message: "depth", Fields: map[string]any{
+			"symbol": uint32(1), "event_time": eventTime, "trade_time": tradeTime, "first_update_id": int64(100), "last_update_id": int64(109),
+			"bids": []any{level("6500.25", "0.0010"), level("6499.50", "2")},
+			"asks": []any{level("6501.00", "1.5")},
+		}},
+		sbe: wiretest.Frame{Message: "Depth", Fields: map[string]any{
+			"symbol": uint32(1), "eventTime": eventTime, "tradeTime": tradeTime, "firstUpdateId": int64(100), "lastUpdateId": int64(109),
+			"bids": []any{level("6500.25", "0.0010"), level("6499.50", "2")},
+			"asks": []any{level("6501.00", "1.5")},
+		}},
+	},
+	{
+		name:   "bookTicker",
+		stream: "bookTicker.2",
+		data:   marshal(contracts.BookTickerData{Event: "bookTicker", Symbol: 2, EventTime: eventTime, TradeTime: tradeTime, BestBid: "6500.25", BestBidQty: "0.5", BestAsk: "6500.50", BestAskQty: "12", UpdateID: 77}),
+		protobuf: wiretest.Frame{Message: "book_ticker", Fields: map[string]any{
+			"symbol": uint32(2), "event_time": eventTime, "trade_time": tradeTime,
+			"best_bid": "6500.25", "best_bid_qty": "0.5", "best_ask": "6500.50", "best_ask_qty": "12", "update_id": int64(77),
+		}},
+		sbe: wiretest.Frame{Message: "BookTicker", Fields: map[string]any{
+			"symbol": uint32(2), "eventTime": eventTime, "tradeTime": tradeTime,
+			"bestBid": "6500.25", "bestBidQty": "0.5", "bestAsk": "6500.50", "bestAskQty": "12", "updateId": int64(77),
+		}},
+	},
+	{
+		name:   "trade",
+		stream: "trade.1",
+		data:   marshal(contracts.TradeData{Event: "trade", Symbol: 1, EventTime: eventTime, TradeTime: tradeTime, TradeID: 12345, Price: 6500025, Quantity: 15, BuyerOrderID: "1001", SellerOrderID: "1002", IsBuyerMaker: true}),
+		protobuf: wiretest.Frame{Message: "trade", Fields: map[string]any{
+			"symbol": uint32(1), "event_time": eventTime, "trade_time": tradeTime, "trade_id": int64(12345),
+			"price": uint64(6500025), "quantity": uint32(15), "buyer_order_id": "1001", "seller_order_id": "1002", "is_buyer_maker": true,
+		}},
+		sbe: wiretest.Frame{Message: "Trade", Fields: map[string]any{
+			"symbol": uint32(1), "eventTime": eventTime, "tradeTime": tradeTime, "tradeId": int64(12345),
+			"price": uint64(6500025), "quantity": uint32(15), "buyerOrderId": "1001", "sellerOrderId": "1002", "isBuyerMaker": true,
+		}},
+	},
+	{
+		name:     "ticker",
+		stream:   "ticker.3",
+		data:     marshal(contracts.TickerData{Event: "ticker", Symbol: 3, EventTime: eventTime, Price: 6500025}),
+		protobuf: wiretest.Frame{Message: "ticker", Fields: map[string]any{"symbol": uint32(3), "event_time": eventTime, "price": uint64(6500025)}},
+		sbe:      wiretest.Frame{Message: "Ticker", Fields: map[string]any{"symbol": uint32(3), "eventTime": eventTime, "price": uint64(6500025)}},
+	},
+	{
+		name:   "systemStatus",
+		stream: "systemStatus",
+		data:   marshal(contracts.SystemStatusData{Event: "systemStatus", EventTime: eventTime, Status: contracts.SystemStatus("maintenance"), Message: "upgrade", Symbols: []uint32{1, 300}, StartsAt: eventTime + 1000, EndsAt: eventTime + 2000}),
+		protobuf: wiretest.Frame{Message: "system_status", Fields: map[string]any{
+			"event_time": eventTime, "status": "maintenance", "message": "upgrade", "symbols": []any{uint32(1), uint32(300)},
+			"starts_at": eventTime + 1000, "ends_at": eventTime + 2000,
+		}},
+		sbe: wiretest.Frame{Message: "SystemStatus", Fields: map[string]any{
+			"eventTime": eventTime, "status": "maintenance", "message": "upgrade",
+			"symbols":  []any{map[string]any{"symbol": uint32(1)}, map[string]any{"symbol": uint32(300)}},
+			"startsAt": eventTime + 1000, "endsAt": eventTime + 2000,
+		}},
+	},
+	{
+		name: "orderEvent",
+		v:    contracts.SequencedOrderEvent{OrderEvent: shm.OrderEvent{UserId: 7, OrderId: 8, Symbol: 1, EventKind: 2, FilledQty: 3, RemainingQty: 4, OriginalQty: 7, ErrorCode: 5}, Seq: 9},
+		protobuf: wiretest.Frame{Message: "order_event", Fields: map[string]any{
+			"user_id": uint64(7), "order_id": uint64(8), "symbol": uint32(1), "event_kind": uint32(2), "filled_qty": uint32(3),
+			"remaining_qty": uint32(4), "original_qty": uint32(7), "error_code": uint32(5), "seq": uint64(9),
+		}},
+		sbe: wiretest.Frame{Message: "OrderEvent", Fields: map[string]any{
+			"userId": uint64(7), "orderId": uint64(8), "symbol": uint32(1), "eventKind": uint32(2), "filledQty": uint32(3),
+			"remainingQty": uint32(4), "originalQty": uint32(7), "errorCode": uint32(5), "seq": uint64(9),
+		}},
+	},
+	{
+		name:     "pong",
+		v:        contracts.PongMessage{ID: 4, Result: "pong", Time: eventTime},
+		protobuf: wiretest.Frame{Message: "pong", Fields: map[string]any{"id": int64(4), "result": "pong", "time": eventTime}},
+		sbe:      wiretest.Frame{Message: "Pong", Fields: map[string]any{"id": int64(4), "result": "pong", "time": eventTime}},
+	},
+	{
+		name: "error",
+		v:    contracts.ErrorMessage{ID: 5, Error: contracts.ErrorBody{Code: "invalid_stream", Msg: "no such stream"}},
+		protobuf: wiretest.Frame{Message: "error", Fields: map[string]any{
+			"id": int64(5), "error": map[string]any{"code": "invalid_stream", "msg": "no such stream"},
+		}},
+		// sbe flattens the error body into the message
+		sbe: wiretest.Frame{Message: "Error", Fields: map[string]any{"id": int64(5), "code": "invalid_stream", "msg": "no such stream"}},
+	},
+	{
+		name:     "connectionExpiring",
+		v:        contracts.ConnectionExpiringData{Event: "connectionExpiring", EventTime: eventTime, CloseAt: eventTime + 60000},
+		protobuf: wiretest.Frame{Message: "connection_expiring", Fields: map[string]any{"event_time": eventTime, "close_at": eventTime + 60000}},
+		sbe:      wiretest.Frame{Message: "ConnectionExpiring", Fields: map[string]any{"eventTime": eventTime, "closeAt": eventTime + 60000}},
+	},
+	{
+		name:     "orderEventsSession",
+		v:        contracts.OrderEventsSessionData{Event: "session", EventTime: eventTime, Epoch: 11, Seq: 12, Gap: true},
+		protobuf: wiretest.Frame{Message: "order_events_session", Fields: map[string]any{"event_time": eventTime, "epoch": uint64(11), "seq": uint64(12), "gap": true}},
+		sbe:      wiretest.Frame{Message: "OrderEventsSession", Fields: map[string]any{"eventTime": eventTime, "epoch": uint64(11), "seq": uint64(12), "gap": true}},
+	},
+}
+
+func marshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func level(price, qty string) map[string]any {
+	return map[string]any{"price": price, "qty": qty}
+}
+
+func (tc schemaCase) encode(t *testing.T, enc contracts.Encoding) []byte {
+	t.Helper()
+	var frame []byte
+	var err error
+	if tc.data != nil {
+		frame, err = wire.MarketData(enc, tc.stream, tc.data)
+	} else {
+		frame, err = wire.Message(enc, tc.v)
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", enc, err)
+	}
+	return frame
+}
+
+func TestSchemasCoverEveryMessage(t *testing.T) {
+	schemas, err := wiretest.Load(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range schemaCases {
+		t.Run(tc.name, func(t *testing.T) {
+			checkFrame := func(enc contracts.Encoding, decode func([]byte) (wiretest.Frame, error), want wiretest.Frame) {
+				got, err := decode(tc.encode(t, enc))
+				if err != nil {
+					t.Fatalf("%s: %v", enc, err)
+				}
+				want.Stream = tc.stream
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("%s decoded\n%#v\nwant\n%#v", enc, got, want)
+				}
+			}
+			checkFrame(contracts.EncodingProtobuf, schemas.Protobuf, tc.protobuf)
+			checkFrame(contracts.EncodingSBE, schemas.SBE, tc.sbe)
+
+			got, err := wiretest.Msgpack(tc.encode(t, contracts.EncodingMsgPack))
+			if err != nil {
+				t.Fatalf("msgpack: %v", err)
+			}
+			if got, want := normalize(t, marshal(got)), normalize(t, tc.encode(t, contracts.EncodingJSON)); !reflect.DeepEqual(got, want) {
+				t.Errorf("msgpack decoded\n%v\njson is\n%v", got, want)
+			}
+		})
+	}
+}
+
+// normalize decodes json keeping numbers exact , msgpack and json frames compare equal after it
+func normalize(t *testing.T, data []byte) any {
+	t.Helper()
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	var v any
+	if err := d.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
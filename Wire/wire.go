@@ -0,0 +1,178 @@
+package wire
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	contracts "exchange/Contracts"
+	shm "exchange/Shm"
+
+	"github.com/gorilla/websocket"
+)
+
+// encoders for every message the gateway sends , one per contracts.Encoding
+// json keeps the frames exactly as they always were , the binary encodings are hand written
+// against the schemas next to this file so the wire format is pinned down here and not by a library
+//
+//   msgpack   maps with the json keys , market data is {"stream":..,"data":{..}} like in json
+//   protobuf  every frame is one Frame message , see gateway.proto
+//   sbe       fixed layout little endian with a message header , see sbe.xml
+//
+// the fan out calls these once per message per encoding , never per client
+
+var ErrUnknownEvent = errors.New("unknown market data event")
+
+// template ids , also the sbe templateId and the protobuf Frame field number minus 10
+const (
+	templateDepth uint16 = iota + 1
+	templateBookTicker
+	templateTrade
+	templateTicker
+	templateSystemStatus
+	templateOrderEvent
+	templatePong
+	templateError
+	templateConnectionExpiring
+	templateOrderEventsSession
+)
+
+// message is implemented by a thin wrapper per contract type , see messages.go
+type message interface {
+	template() uint16
+	write(w writer)
+}
+
+// writer is what a message writes its fields to , tag is the protobuf field number and key the json key
+// the sbe writer puts numbers in the fixed block , repeated values in groups and strings in the var data
+type writer interface {
+	event(name string) // the json "e" , implied by the message type in protobuf and sbe
+	str(tag int, key string, v string)
+	u32(tag int, key string, v uint32)
+	u64(tag int, key string, v uint64)
+	i64(tag int, key string, v int64)
+	boolean(tag int, key string, v bool)
+	decimal(tag int, key string, v string) // price or quantity string , a mantissa and exponent in sbe
+	levels(tag int, key string, v [][]string)
+	u32s(tag int, key string, v []uint32)
+	object(tag int, key string, fn func(w writer))
+}
+
+type codec interface {
+	// stream is empty for anything that is not market data
+	encode(stream string, m message) ([]byte, error)
+}
+
+var codecs = [contracts.EncodingCount]codec{
+	contracts.EncodingMsgPack:  msgpackCodec{},
+	contracts.EncodingProtobuf: protobufCodec{},
+	contracts.EncodingSBE:      sbeCodec{},
+}
+
+// FrameType is the websocket message type for an encoding
+func FrameType(enc contracts.Encoding) int {
+	if enc == contracts.EncodingJSON {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+// MarketData encodes one stream message , data is the json payload as published on redis
+func MarketData(enc contracts.Encoding, stream string, data json.RawMessage) ([]byte, error) {
+	if enc == contracts.EncodingJSON {
+		return json.Marshal(contracts.MessageFromPubSubForUser{Stream: stream, Data: data})
+	}
+	m, err := decodeMarketData(data)
+	if err != nil {
+		return nil, err
+	}
+	return encode(enc, stream, m)
+}
+
+// Message encodes anything sent outside a stream : order events , pongs , errors and notices
+func Message(enc contracts.Encoding, v any) ([]byte, error) {
+	if enc == contracts.EncodingJSON {
+		return json.Marshal(v)
+	}
+	m, err := toMessage(v)
+	if err != nil {
+		return nil, err
+	}
+	return encode(enc, "", m)
+}
+
+func encode(enc contracts.Encoding, stream string, m message) ([]byte, error) {
+	if enc >= contracts.EncodingCount || codecs[enc] == nil {
+		return nil, fmt.Errorf("no encoder for %s", enc)
+	}
+	return codecs[enc].encode(stream, m)
+}
+
+// decodeMarketData turns the json payload into its contract type by the "e" field
+func decodeMarketData(data json.RawMessage) (message, error) {
+	// json matches keys without case , "E" needs its own field or it lands in Event
+	var head struct {
+		Event     string          `json:"e"`
+		EventTime json.RawMessage `json:"E"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return nil, err
+	}
+	var v any
+	switch head.Event {
+	case "depth":
+		v = &contracts.DepthData{}
+	case "bookTicker":
+		v = &contracts.BookTickerData{}
+	case "trade":
+		v = &contracts.TradeData{}
+	case "ticker":
+		v = &contracts.TickerData{}
+	case "systemStatus":
+		v = &contracts.SystemStatusData{}
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownEvent, head.Event)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+	return toMessage(v)
+}
+
+func toMessage(v any) (message, error) {
+	switch m := v.(type) {
+	case contracts.DepthData:
+		return depth(m), nil
+	case *contracts.DepthData:
+		return depth(*m), nil
+	case contracts.BookTickerData:
+		return bookTicker(m), nil
+	case *contracts.BookTickerData:
+		return bookTicker(*m), nil
+	case contracts.TradeData:
+		return trade(m), nil
+	case *contracts.TradeData:
+		return trade(*m), nil
+	case contracts.TickerData:
+		return ticker(m), nil
+	case *contracts.TickerData:
+		return ticker(*m), nil
+	case contracts.SystemStatusData:
+		return systemStatus(m), nil
+	case *contracts.SystemStatusData:
+		return systemStatus(*m), nil
+	case shm.OrderEvent:
+		return orderEvent{OrderEvent: m}, nil
+	case contracts.SequencedOrderEvent:
+		return orderEvent(m), nil
+	case contracts.OrderEventsSessionData:
+		return orderEventsSession(m), nil
+	case contracts.PongMessage:
+		return pong(m), nil
+	case contracts.ErrorMessage:
+		return errorMessage(m), nil
+	case contracts.ConnectionExpiringData:
+		return connectionExpiring(m), nil
+	}
+	return nil, fmt.Errorf("no wire schema for %T", v)
+}
@@ -0,0 +1,67 @@
+package wire_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	contracts "exchange/Contracts"
+	wire "exchange/Wire"
+)
+
+// cost of encoding one market data message per encoding , the fan out pays it once per message and encoding
+//
+//	go test ./Wire -run - -bench MarketData -benchmem
+
+func BenchmarkMarketData(b *testing.B) {
+	payloads := map[string]json.RawMessage{
+		"trade":    json.RawMessage(`{"e":"trade","E":1760867227123,"s":1,"t":12345,"p":6500025,"q":15,"T":1760867227120,"a":"1001","b":"1002","m":true}`),
+		"depth_10": depthUpdates(1, 10)[0],
+		"depth_50": depthUpdates(1, 50)[0],
+	}
+	for _, name := range []string{"trade", "depth_10", "depth_50"} {
+		for enc := contracts.Encoding(0); enc < contracts.EncodingCount; enc++ {
+			b.Run(fmt.Sprintf("%s/%s", name, enc), func(b *testing.B) {
+				var size int
+				for b.Loop() {
+					data, err := wire.MarketData(enc, "depth.1", payloads[name])
+					if err != nil {
+						b.Fatal(err)
+					}
+					size = len(data)
+				}
+				b.ReportMetric(float64(size), "frame-B")
+			})
+		}
+	}
+}
+
+// depthUpdates builds books that move a little between updates , like a real depth stream
+func depthUpdates(n, levels int) []json.RawMessage {
+	updates := make([]json.RawMessage, 0, n)
+	for i := range n {
+		d := contracts.DepthData{
+			Event:     "depth",
+			Symbol:    1,
+			EventTime: time.Now().UnixMilli(),
+			TradeTime: time.Now().UnixMilli(),
+			FirstID:   int64(i * 10),
+			LastID:    int64(i*10 + 9),
+		}
+		mid := 6500000 + (i%40)*25
+		for l := range levels {
+			qty := strconv.Itoa(1000 + (i*7+l*13)%9000)
+			d.Bids = append(d.Bids, []string{price(mid - 25*(l+1)), "0." + qty})
+			d.Asks = append(d.Asks, []string{price(mid + 25*(l+1)), "0." + qty})
+		}
+		data, _ := json.Marshal(d)
+		updates = append(updates, data)
+	}
+	return updates
+}
+
+func price(ticks int) string {
+	return fmt.Sprintf("%d.%02d", ticks/100, ticks%100)
+}
@@ -0,0 +1,427 @@
+// Package wiretest decodes gateway frames without the Wire package , for tests of its hand written encoders
+// msgpack goes through a third party decoder , protobuf through a descriptor built from gateway.proto and
+// sbe through the layout in sbe.xml , so a wrong tag , field number or offset in Wire fails here
+// only tests import it
+package wiretest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Frame is one decoded frame , fields are keyed by their schema names
+// numbers keep the type the schema gives them , uint32 , uint64 or int64 , sbe decimals come back as strings
+type Frame struct {
+	Stream  string         // empty outside market data
+	Message string         // the protobuf payload field or the sbe message name
+	Fields  map[string]any // repeated fields and groups are []any , nested messages map[string]any
+}
+
+// Msgpack decodes one frame , bytes after the first value are an error
+func Msgpack(frame []byte) (any, error) {
+	r := bytes.NewReader(frame)
+	var v any
+	if err := msgpack.NewDecoder(r).Decode(&v); err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%d bytes after the msgpack value", r.Len())
+	}
+	return v, nil
+}
+
+// Schemas are gateway.proto and sbe.xml as loaded by Load
+type Schemas struct {
+	frame protoreflect.MessageDescriptor
+	sbe   sbeSchema
+}
+
+// Load reads gateway.proto and sbe.xml from dir , the Wire directory
+func Load(dir string) (*Schemas, error) {
+	src, err := os.ReadFile(filepath.Join(dir, "gateway.proto"))
+	if err != nil {
+		return nil, err
+	}
+	frame, err := protoSchema(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("gateway.proto: %w", err)
+	}
+	src, err = os.ReadFile(filepath.Join(dir, "sbe.xml"))
+	if err != nil {
+		return nil, err
+	}
+	sbe, err := parseSBE(src)
+	if err != nil {
+		return nil, fmt.Errorf("sbe.xml: %w", err)
+	}
+	return &Schemas{frame: frame, sbe: sbe}, nil
+}
+
+// protobuf
+
+var (
+	protoComment = regexp.MustCompile(`//[^\n]*`)
+	protoPackage = regexp.MustCompile(`^package\s+([\w.]+);$`)
+	protoOpen    = regexp.MustCompile(`^(message|oneof)\s+(\w+)\s*\{$`)
+	protoField   = regexp.MustCompile(`^(repeated\s+)?(\w+)\s+(\w+)\s*=\s*(\d+);$`)
+)
+
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"uint32": descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64": descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"int64":  descriptorpb.FieldDescriptorProto_TYPE_INT64,
+}
+
+// protoSchema reads the subset of proto3 gateway.proto is written in , messages , oneofs and plain fields
+func protoSchema(src string) (protoreflect.MessageDescriptor, error) {
+	fd := &descriptorpb.FileDescriptorProto{Name: proto.String("gateway.proto"), Syntax: proto.String("proto3")}
+	var msg *descriptorpb.DescriptorProto
+	oneof := int32(-1)
+	for n, line := range strings.Split(protoComment.ReplaceAllString(src, ""), "\n") {
+		line = strings.TrimSpace(line)
+		switch m := protoOpen.FindStringSubmatch(line); {
+		case line == "" || strings.HasPrefix(line, "syntax"):
+		case protoPackage.MatchString(line):
+			fd.Package = proto.String(protoPackage.FindStringSubmatch(line)[1])
+		case m != nil && m[1] == "message" && msg == nil:
+			msg = &descriptorpb.DescriptorProto{Name: proto.String(m[2])}
+			fd.MessageType = append(fd.MessageType, msg)
+		case m != nil && m[1] == "oneof" && msg != nil && oneof < 0:
+			oneof = int32(len(msg.OneofDecl))
+			msg.OneofDecl = append(msg.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(m[2])})
+		case line == "}" && oneof >= 0:
+			oneof = -1
+		case line == "}" && msg != nil:
+			msg = nil
+		case protoField.MatchString(line) && msg != nil:
+			f := protoField.FindStringSubmatch(line)
+			num, _ := strconv.Atoi(f[4])
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(f[3]),
+				JsonName: proto.String(f[3]),
+				Number:   proto.Int32(int32(num)),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if f[1] != "" {
+				field.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+			}
+			if t, ok := protoScalars[f[2]]; ok {
+				field.Type = t.Enum()
+			} else {
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + fd.GetPackage() + "." + f[2])
+			}
+			if oneof >= 0 {
+				field.OneofIndex = proto.Int32(oneof)
+			}
+			msg.Field = append(msg.Field, field)
+		default:
+			return nil, fmt.Errorf("line %d not understood: %q", n+1, line)
+		}
+	}
+	file, err := protodesc.NewFile(fd, nil)
+	if err != nil {
+		return nil, err
+	}
+	frame := file.Messages().ByName("Frame")
+	if frame == nil {
+		return nil, errors.New("no Frame message")
+	}
+	return frame, nil
+}
+
+// Protobuf decodes one Frame , fields the schema does not know or with the wrong wire type are an error
+func (s *Schemas) Protobuf(frame []byte) (Frame, error) {
+	m := dynamicpb.NewMessage(s.frame)
+	if err := proto.Unmarshal(frame, m); err != nil {
+		return Frame{}, err
+	}
+	if err := noUnknown(m); err != nil {
+		return Frame{}, err
+	}
+	f := Frame{Stream: m.Get(s.frame.Fields().ByName("stream")).String()}
+	payload := m.WhichOneof(s.frame.Oneofs().ByName("payload"))
+	if payload == nil {
+		return Frame{}, errors.New("frame without a payload")
+	}
+	f.Message = string(payload.Name())
+	f.Fields = protoFields(m.Get(payload).Message())
+	return f, nil
+}
+
+func noUnknown(m protoreflect.Message) error {
+	if u := m.GetUnknown(); len(u) > 0 {
+		return fmt.Errorf("%s has fields the schema does not know: % x", m.Descriptor().Name(), []byte(u))
+	}
+	var err error
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.Message() == nil:
+		case fd.IsList():
+			for i := 0; i < v.List().Len() && err == nil; i++ {
+				err = noUnknown(v.List().Get(i).Message())
+			}
+		default:
+			err = noUnknown(v.Message())
+		}
+		return err == nil
+	})
+	return err
+}
+
+func protoFields(m protoreflect.Message) map[string]any {
+	fields := map[string]any{}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		fields[string(fd.Name())] = protoValue(fd, v)
+		return true
+	})
+	return fields
+}
+
+func protoValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) any {
+	if fd.IsList() {
+		list := []any{}
+		for i := 0; i < v.List().Len(); i++ {
+			if fd.Message() != nil {
+				list = append(list, protoFields(v.List().Get(i).Message()))
+			} else {
+				list = append(list, v.List().Get(i).Interface())
+			}
+		}
+		return list
+	}
+	if fd.Message() != nil {
+		return protoFields(v.Message())
+	}
+	return v.Interface()
+}
+
+// sbe
+
+type sbeSchema struct {
+	ID         uint16       `xml:"id,attr"`
+	Version    uint16       `xml:"version,attr"`
+	Composites []sbeType    `xml:"types>composite"`
+	Enums      []sbeType    `xml:"types>enum"`
+	Messages   []sbeMessage `xml:"message"`
+
+	sizes map[string]int // every field type by name , filled by parseSBE
+}
+
+type sbeType struct {
+	Name         string    `xml:"name,attr"`
+	EncodingType string    `xml:"encodingType,attr"`
+	Types        []sbeType `xml:"type"`
+	Primitive    string    `xml:"primitiveType,attr"`
+}
+
+type sbeMessage struct {
+	Name   string     `xml:"name,attr"`
+	ID     uint16     `xml:"id,attr"`
+	Fields []sbeField `xml:"field"`
+	Groups []struct {
+		Name   string     `xml:"name,attr"`
+		Fields []sbeField `xml:"field"`
+	} `xml:"group"`
+	Data []sbeField `xml:"data"`
+}
+
+type sbeField struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+var sbePrimitives = map[string]int{"int8": 1, "uint8": 1, "uint16": 2, "uint32": 4, "int64": 8, "uint64": 8}
+
+func parseSBE(src []byte) (sbeSchema, error) {
+	var s sbeSchema
+	if err := xml.Unmarshal(src, &s); err != nil {
+		return s, err
+	}
+	s.sizes = map[string]int{}
+	for name, size := range sbePrimitives {
+		s.sizes[name] = size
+	}
+	for _, e := range s.Enums {
+		s.sizes[e.Name] = sbePrimitives[e.EncodingType]
+	}
+	for _, c := range s.Composites {
+		for _, t := range c.Types {
+			s.sizes[c.Name] += sbePrimitives[t.Primitive]
+		}
+	}
+	// decimals are read as mantissa and exponent , bools as 0 or 1 , anything else about them is a schema change
+	if d := s.composite("decimal"); len(d.Types) != 2 || d.Types[0].Primitive != "int64" || d.Types[1].Primitive != "int8" {
+		return s, errors.New("decimal is not mantissa int64 , exponent int8")
+	}
+	for _, m := range s.Messages {
+		fields := append([]sbeField{}, m.Fields...)
+		for _, g := range m.Groups {
+			fields = append(fields, g.Fields...)
+		}
+		for _, f := range fields {
+			if s.sizes[f.Type] == 0 {
+				return s, fmt.Errorf("%s.%s: unknown type %q", m.Name, f.Name, f.Type)
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *sbeSchema) composite(name string) sbeType {
+	for _, c := range s.Composites {
+		if c.Name == name {
+			return c
+		}
+	}
+	return sbeType{}
+}
+
+func (s *sbeSchema) blockLength(fields []sbeField) int {
+	n := 0
+	for _, f := range fields {
+		n += s.sizes[f.Type]
+	}
+	return n
+}
+
+// SBE decodes one frame by the layout in sbe.xml , the header block length and every group block length must match
+// the schema and the frame must end right after the last var data
+// the var data named stream goes to Frame.Stream
+func (s *Schemas) SBE(frame []byte) (Frame, error) {
+	r := &sbeReader{b: frame}
+	blockLength, template, schemaID, version := r.u16(), r.u16(), r.u16(), r.u16()
+	if r.err != nil {
+		return Frame{}, fmt.Errorf("message header: %w", r.err)
+	}
+	if schemaID != s.sbe.ID || version != s.sbe.Version {
+		return Frame{}, fmt.Errorf("schema %d version %d , sbe.xml is %d version %d", schemaID, version, s.sbe.ID, s.sbe.Version)
+	}
+	var msg *sbeMessage
+	for i := range s.sbe.Messages {
+		if s.sbe.Messages[i].ID == template {
+			msg = &s.sbe.Messages[i]
+		}
+	}
+	if msg == nil {
+		return Frame{}, fmt.Errorf("template %d not in sbe.xml", template)
+	}
+	if want := s.sbe.blockLength(msg.Fields); int(blockLength) != want {
+		return Frame{}, fmt.Errorf("%s block length %d , sbe.xml says %d", msg.Name, blockLength, want)
+	}
+
+	f := Frame{Message: msg.Name, Fields: map[string]any{}}
+	for _, field := range msg.Fields {
+		f.Fields[field.Name] = r.value(field.Type)
+	}
+	for _, g := range msg.Groups {
+		entryLength, n := r.u16(), r.u16()
+		if want := s.sbe.blockLength(g.Fields); r.err == nil && int(entryLength) != want {
+			return Frame{}, fmt.Errorf("%s.%s block length %d , sbe.xml says %d", msg.Name, g.Name, entryLength, want)
+		}
+		entries := []any{}
+		for range n {
+			entry := map[string]any{}
+			for _, field := range g.Fields {
+				entry[field.Name] = r.value(field.Type)
+			}
+			entries = append(entries, entry)
+		}
+		f.Fields[g.Name] = entries
+	}
+	for _, data := range msg.Data {
+		v := string(r.next(int(r.u16())))
+		if data.Name == "stream" {
+			f.Stream = v
+		} else {
+			f.Fields[data.Name] = v
+		}
+	}
+	if r.err != nil {
+		return Frame{}, fmt.Errorf("%s: %w", msg.Name, r.err)
+	}
+	if len(r.b) > 0 {
+		return Frame{}, fmt.Errorf("%s: %d bytes after the last var data", msg.Name, len(r.b))
+	}
+	return f, nil
+}
+
+type sbeReader struct {
+	b   []byte
+	err error
+}
+
+var errShort = errors.New("frame too short")
+
+func (r *sbeReader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errShort
+		return make([]byte, n)
+	}
+	p := r.b[:n]
+	r.b = r.b[n:]
+	return p
+}
+
+func (r *sbeReader) u16() uint16 { return binary.LittleEndian.Uint16(r.next(2)) }
+
+func (r *sbeReader) value(typ string) any {
+	switch typ {
+	case "uint32":
+		return binary.LittleEndian.Uint32(r.next(4))
+	case "uint64":
+		return binary.LittleEndian.Uint64(r.next(8))
+	case "int64":
+		return int64(binary.LittleEndian.Uint64(r.next(8)))
+	case "bool":
+		switch b := r.next(1)[0]; b {
+		case 0, 1:
+			return b == 1
+		default:
+			r.err = fmt.Errorf("bool of %d", b)
+			return false
+		}
+	case "decimal":
+		mantissa := int64(binary.LittleEndian.Uint64(r.next(8)))
+		return decimalString(mantissa, int8(r.next(1)[0]))
+	}
+	r.err = fmt.Errorf("no decoder for type %q", typ)
+	return nil
+}
+
+// decimalString is the inverse of the sbe encoder , mantissa 650025 exponent -2 is "6500.25" , null is ""
+func decimalString(mantissa int64, exponent int8) string {
+	if mantissa == math.MinInt64 {
+		return ""
+	}
+	if exponent >= 0 {
+		return strconv.FormatInt(mantissa, 10) + strings.Repeat("0", int(exponent))
+	}
+	sign, digits := "", strconv.FormatInt(mantissa, 10)
+	if mantissa < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	frac := int(-exponent)
+	if len(digits) <= frac {
+		digits = strings.Repeat("0", frac-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-frac] + "." + digits[len(digits)-frac:]
+}
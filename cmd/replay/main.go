@@ -0,0 +1,213 @@
+// replay plays a gateway recording (record.dir) back , into an embedded gateway clients can connect to ,
+// or as text with -dump
+//
+// the embedded gateway runs on its own rings in a temp dir with no engine behind them , the recording reaches its
+// symbol manager and order events hub the way redis and the ring delivered it , so a client sees what the customer saw
+// it still needs a redis to start (-redis) , any scratch server does , nothing of the recording goes through it
+// market data only goes to streams someone subscribed , -delay is the time to connect and subscribe before it starts
+// order events connections pick their user with the X-User header
+//
+//	go run ./cmd/replay -addr 127.0.0.1:8090 -redis 127.0.0.1:6379 -delay 10s -speed 4 /var/lib/gateway/recordings
+//	go run ./cmd/replay -dump -users 1001 -from 2026-10-19T09:40:00Z -to 2026-10-19T09:45:00Z recording-20261019T090000.000000000Z.jsonl
+package main
+
+import (
+	"context"
+	"encoding/json"
+	config "exchange/Config"
+	gateway "exchange/Gateway"
+	recorder "exchange/Recorder"
+	shm "exchange/Shm"
+	ws "exchange/Ws"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	addr := flag.String("addr", "127.0.0.1:8090", "where the embedded gateway listens")
+	redisAddr := flag.String("redis", "127.0.0.1:6379", "redis the embedded gateway connects to")
+	speed := flag.Float64("speed", 1, "times faster than recorded , 0 replays without waiting")
+	maxGap := flag.Duration("max-gap", 0, "shorten quiet stretches to this , 0 keeps them")
+	from := flag.String("from", "", "skip records received before this RFC3339 time")
+	to := flag.String("to", "", "skip records received after this RFC3339 time")
+	streams := flag.String("streams", "", "comma separated stream prefixes to replay , empty is every stream")
+	users := flag.String("users", "", "comma separated user ids whose order events to replay , empty is every user")
+	delay := flag.Duration("delay", 5*time.Second, "wait this long after the gateway is up before replaying")
+	hold := flag.Bool("hold", false, "keep the gateway up after the replay until interrupted")
+	dump := flag.Bool("dump", false, "print the records instead of serving them")
+	verbose := flag.Bool("v", false, "print the gateway log")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] <recording dir or file>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return 2
+	}
+
+	opts, err := replayOptions(*speed, *maxGap, *from, *to, *streams, *users)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	rd, err := recorder.Open(flag.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer rd.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *dump {
+		st, err := recorder.Replay(ctx, rd, discard{}, append(opts, recorder.WithSpeed(0), recorder.WithEach(printRecord))...)
+		return report(st, err)
+	}
+
+	g, closeGateway, err := embedded(ctx, *addr, *redisAddr, *verbose)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "embedded gateway:", err)
+		return 1
+	}
+	defer closeGateway()
+	url := "ws://" + g.Addr().String()
+	fmt.Printf("gateway on %s , %d recording files\n", url, len(rd.Files()))
+	fmt.Printf("  market data   %s/ws/marketData\n", url)
+	fmt.Printf("  order events  %s/ws/OrderEvents with %s: <user id>\n", url, userHeader)
+	fmt.Printf("replaying in %v\n", *delay)
+	select {
+	case <-time.After(*delay):
+	case <-ctx.Done():
+		return 0
+	}
+
+	st, err := recorder.Replay(ctx, rd, g, opts...)
+	code := report(st, err)
+	if *hold && ctx.Err() == nil {
+		fmt.Println("replay done , still serving , ctrl-c to stop")
+		<-ctx.Done()
+	}
+	return code
+}
+
+const userHeader = "X-User"
+
+// embedded starts a gateway on fresh rings in a temp dir , the returned func shuts it down and removes the dir
+func embedded(ctx context.Context, addr, redisAddr string, verbose bool) (*gateway.Gateway, func(), error) {
+	dir, err := os.MkdirTemp("", "gateway-replay-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg := config.Default()
+	cfg.Server.Addr = addr
+	cfg.Shm.Dir = dir
+	cfg.Redis.Addr = redisAddr
+	var out io.Writer = io.Discard
+	if verbose {
+		out = os.Stderr
+	}
+	logger := slog.New(slog.NewTextHandler(out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	fail := func(err error) (*gateway.Gateway, func(), error) {
+		os.RemoveAll(dir)
+		return nil, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fail(err)
+	}
+	if err := gateway.CreateRings(cfg); err != nil {
+		return fail(err)
+	}
+	g, err := gateway.New(cfg, gateway.WithLogger(logger), gateway.WithAuthenticator(ws.HeaderAuthenticator(userHeader)))
+	if err != nil {
+		return fail(err)
+	}
+	if err := g.Start(ctx); err != nil {
+		return fail(err)
+	}
+	return g, func() {
+		sctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := g.Shutdown(sctx); err != nil {
+			fmt.Fprintln(os.Stderr, "shutdown:", err)
+		}
+		os.RemoveAll(dir)
+	}, nil
+}
+
+func replayOptions(speed float64, maxGap time.Duration, from, to, streams, users string) ([]recorder.ReplayOption, error) {
+	if speed < 0 {
+		return nil, fmt.Errorf("-speed must not be negative")
+	}
+	opts := []recorder.ReplayOption{recorder.WithSpeed(speed), recorder.WithMaxGap(maxGap)}
+	var window [2]time.Time
+	for i, s := range []string{from, to} {
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("-from / -to: %w", err)
+		}
+		window[i] = t
+	}
+	opts = append(opts, recorder.WithWindow(window[0], window[1]))
+	if streams != "" {
+		opts = append(opts, recorder.WithStreams(strings.Split(streams, ",")...))
+	}
+	if users != "" {
+		var ids []uint64
+		for _, s := range strings.Split(users, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("-users: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		opts = append(opts, recorder.WithUsers(ids...))
+	}
+	return opts, nil
+}
+
+// one line per market data message and one per order event
+func printRecord(rec recorder.Record) {
+	at := time.Unix(0, rec.Time).UTC().Format("2006-01-02T15:04:05.000000Z")
+	if rec.IsMarketData() {
+		fmt.Printf("%s md %s %s\n", at, rec.Stream, rec.Data)
+		return
+	}
+	for _, ev := range rec.Events {
+		fmt.Printf("%s oe user=%d order=%d symbol=%d kind=%d filled=%d remaining=%d original=%d error=%d\n",
+			at, ev.UserId, ev.OrderId, ev.Symbol, ev.EventKind, ev.FilledQty, ev.RemainingQty, ev.OriginalQty, ev.ErrorCode)
+	}
+}
+
+// report prints the stats and returns the exit code , an interrupt is not a failure
+func report(st recorder.ReplayStats, err error) int {
+	fmt.Fprintf(os.Stderr, "%d market data messages , %d order events in %d batches , %d records skipped , recorded %s .. %s , took %v\n",
+		st.MarketData, st.OrderEvents, st.Batches, st.Skipped,
+		st.First.UTC().Format(time.RFC3339Nano), st.Last.UTC().Format(time.RFC3339Nano), st.Took.Round(time.Millisecond))
+	if err != nil && err != context.Canceled {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+type discard struct{}
+
+func (discard) PublishMarketData(string, json.RawMessage) {}
+func (discard) PublishOrderEvents(...shm.OrderEvent)      {}
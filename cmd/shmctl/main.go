@@ -0,0 +1,236 @@
+// shmctl looks inside the shm rings shared with the engine
+//
+//	shmctl info     [-kind K] <path>           header fields , positions and depth
+//	shmctl validate [-kind K] <path>...        file size , magic , capacity and layout checks
+//	shmctl dump     [-kind K] [-from N] [-n N] <path>   decoded entries as json lines
+//	shmctl tail     [-kind K] [-interval D] <path>      follow new entries as the producer publishes
+//	shmctl create   -kind K <path> | -all -dir D        fresh rings for local testing
+//
+// kinds: orders cancels queries events balances holdings , detected from the magic when -kind is omitted
+// everything except create maps the file read only and never moves the consumer tail
+package main
+
+import (
+	"encoding/json"
+	shm "exchange/Shm"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// file names main.go opens under /tmp/trading
+var defaultRingFiles = map[shm.RingKind]string{
+	shm.RingOrders:   "IncomingOrdersForMe",
+	shm.RingCancels:  "CancelOrders",
+	shm.RingQueries:  "Queries",
+	shm.RingEvents:   "OrderEvents",
+	shm.RingBalances: "BalanceResponse",
+	shm.RingHoldings: "HoldingsResponse",
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: shmctl <info|validate|dump|tail|create> [flags] <path>")
+	fmt.Fprintln(os.Stderr, "run shmctl <command> -h for the flags of a command")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, args := os.Args[1], os.Args[2:]
+
+	var err error
+	switch cmd {
+	case "info":
+		err = runInfo(args)
+	case "validate":
+		err = runValidate(args)
+	case "dump":
+		err = runDump(args)
+	case "tail":
+		err = runTail(args)
+	case "create":
+		err = runCreate(args)
+	default:
+		usage()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "shmctl:", err)
+		os.Exit(1)
+	}
+}
+
+func openArg(fs *flag.FlagSet, kind string) (*shm.RingInspector, error) {
+	if fs.NArg() != 1 {
+		return nil, fmt.Errorf("%s needs exactly one ring path", fs.Name())
+	}
+	return shm.InspectRing(fs.Arg(0), shm.RingKind(kind))
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	return enc.Encode(v)
+}
+
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	kind := fs.String("kind", "", "ring kind , detected from the magic when empty")
+	fs.Parse(args)
+
+	r, err := openArg(fs, *kind)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	info := r.Info()
+	fmt.Printf("kind              %s\n", info.Kind)
+	fmt.Printf("path              %s\n", info.Path)
+	fmt.Printf("file size         %d (expected %d)\n", info.FileSize, info.ExpectedSize)
+	fmt.Printf("magic             %#x (expected %#x)\n", info.Magic, info.ExpectedMagic)
+	fmt.Printf("capacity          %d\n", info.Capacity)
+	fmt.Printf("layout hash       %#x\n", info.LayoutHash)
+	fmt.Printf("producer head     %d\n", info.ProducerHead)
+	fmt.Printf("consumer tail     %d\n", info.ConsumerTail)
+	fmt.Printf("consumer reserved %d\n", info.ConsumerReserved)
+	fmt.Printf("depth             %d\n", info.Depth)
+	return nil
+}
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	kind := fs.String("kind", "", "ring kind , detected from the magic when empty")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("validate needs at least one ring path")
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		r, err := shm.InspectRing(path, shm.RingKind(*kind))
+		if err != nil {
+			fmt.Printf("FAIL %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		problems := r.Validate()
+		r.Close()
+		if len(problems) == 0 {
+			fmt.Printf("OK   %s (%s)\n", path, r.Kind())
+			continue
+		}
+		failed++
+		for _, p := range problems {
+			fmt.Printf("FAIL %s (%s): %s\n", path, r.Kind(), p)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rings failed validation", failed, fs.NArg())
+	}
+	return nil
+}
+
+type dumpedEntry struct {
+	Seq   uint64 `json:"seq"`
+	Entry any    `json:"entry"`
+}
+
+func runDump(args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ExitOnError)
+	kind := fs.String("kind", "", "ring kind , detected from the magic when empty")
+	from := fs.Int64("from", -1, "first sequence number , defaults to the consumer tail")
+	n := fs.Uint64("n", 0, "max entries , 0 dumps everything up to the producer head")
+	fs.Parse(args)
+
+	r, err := openArg(fs, *kind)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	info := r.Info()
+	start := info.ConsumerTail
+	if *from >= 0 {
+		start = uint64(*from)
+	}
+	end := info.ProducerHead
+	if *n > 0 && start+*n < end {
+		end = start + *n
+	}
+	for seq := start; seq < end; seq++ {
+		entry, ok := r.Entry(seq)
+		if !ok {
+			return fmt.Errorf("slot for seq %d is past the end of the file", seq)
+		}
+		if err := printJSON(dumpedEntry{Seq: seq, Entry: entry}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	kind := fs.String("kind", "", "ring kind , detected from the magic when empty")
+	from := fs.Int64("from", -1, "first sequence number , defaults to the current producer head")
+	interval := fs.Duration("interval", 10*time.Millisecond, "how often the producer head is polled")
+	fs.Parse(args)
+
+	r, err := openArg(fs, *kind)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	next := r.Info().ProducerHead
+	if *from >= 0 {
+		next = uint64(*from)
+	}
+	for {
+		head := r.Info().ProducerHead
+		for ; next < head; next++ {
+			entry, ok := r.Entry(next)
+			if !ok {
+				return fmt.Errorf("slot for seq %d is past the end of the file", next)
+			}
+			if err := printJSON(dumpedEntry{Seq: next, Entry: entry}); err != nil {
+				return err
+			}
+		}
+		time.Sleep(*interval)
+	}
+}
+
+func runCreate(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ExitOnError)
+	kind := fs.String("kind", "", "ring kind to create")
+	all := fs.Bool("all", false, "create all six rings under -dir with the file names main.go opens")
+	dir := fs.String("dir", "/tmp/trading", "directory used with -all")
+	fs.Parse(args)
+
+	if *all {
+		if err := os.MkdirAll(*dir, 0o777); err != nil {
+			return err
+		}
+		for _, k := range shm.RingKinds() {
+			path := filepath.Join(*dir, defaultRingFiles[k])
+			if err := shm.CreateRing(k, path); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			fmt.Printf("created %s (%s)\n", path, k)
+		}
+		return nil
+	}
+
+	if *kind == "" || fs.NArg() != 1 {
+		return fmt.Errorf("create needs -kind and one path , or -all")
+	}
+	if err := shm.CreateRing(shm.RingKind(*kind), fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Printf("created %s (%s)\n", fs.Arg(0), *kind)
+	return nil
+}
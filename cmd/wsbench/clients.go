@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	contracts "exchange/Contracts"
+	metrics "exchange/Metrics"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// order events connections name their user in this header , the embedded gateway trusts it , see ws.HeaderAuthenticator
+const userHeader = "X-User"
+
+type client struct {
+	endpoint string
+	conn     *websocket.Conn
+	user     uint64 // order events only
+	lat      hist   // owned by the read loop until done is closed
+	done     chan struct{}
+}
+
+// connect dials every connection with dialWorkers in parallel and starts their read loops , failures are counted
+func (b *bench) connect() {
+	type spec struct {
+		endpoint string
+		user     uint64
+	}
+	specs := make(chan spec)
+	go func() {
+		for range b.s.md {
+			specs <- spec{endpoint: metrics.EndpointMarketData}
+		}
+		for i := range b.s.oe {
+			specs <- spec{endpoint: metrics.EndpointOrderEvents, user: b.s.userBase + uint64(i%max(b.s.users, 1))}
+		}
+		close(specs)
+	}()
+
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for range max(b.s.dialWorkers, 1) {
+		wg.Go(func() {
+			for sp := range specs {
+				path, header := "/ws/marketData", http.Header(nil)
+				if sp.endpoint == metrics.EndpointOrderEvents {
+					path, header = "/ws/OrderEvents", http.Header{userHeader: {strconv.FormatUint(sp.user, 10)}}
+				}
+				conn, _, err := dialer.Dial(b.url+path, header)
+				mu.Lock()
+				if err != nil {
+					b.dialFailures.Add(1)
+					if firstErr == nil {
+						firstErr = err
+						fmt.Printf("dial failed: %v\n", err)
+					}
+					mu.Unlock()
+					continue
+				}
+				c := &client{endpoint: sp.endpoint, conn: conn, user: sp.user, done: make(chan struct{})}
+				b.clients = append(b.clients, c)
+				mu.Unlock()
+				go b.read(c)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// subscribe sends the market data subscriptions and returns subscribers per stream and order events connections per user
+func (b *bench) subscribe() (map[string]int, map[uint64]int) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	pick := symbolPicker(rng, b.s.symbols, b.s.skew)
+	kinds := weightedKinds(b.s.mix)
+	perClient := min(b.s.subs, len(kinds)*b.s.symbols)
+
+	subscribers := map[string]int{}
+	users := map[uint64]int{}
+	for _, c := range b.clients {
+		if c.endpoint == metrics.EndpointOrderEvents {
+			users[c.user]++
+			continue
+		}
+		chosen := map[string]bool{}
+		for len(chosen) < perClient {
+			chosen[streamName(kinds[rng.IntN(len(kinds))], pick())] = true
+		}
+		id := 0
+		for stream := range chosen {
+			id++
+			err := c.conn.WriteJSON(contracts.MessageFromUser{Method: contracts.SUBSCRIBE, Params: []string{stream}, ID: id})
+			if err != nil {
+				break
+			}
+			subscribers[stream]++
+		}
+	}
+	return subscribers, users
+}
+
+// waitUpstream waits until the gateway holds a redis subscription for every subscribed stream
+func (b *bench) waitUpstream(subscribers map[string]int) error {
+	if b.rdb == nil || len(subscribers) == 0 {
+		return nil
+	}
+	streams := make([]string, 0, len(subscribers))
+	for s := range subscribers {
+		streams = append(streams, s)
+	}
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		counts, err := b.rdb.PubSubNumSub(context.Background(), streams...).Result()
+		if err != nil {
+			return fmt.Errorf("redis: %w", err)
+		}
+		missing := 0
+		for _, s := range streams {
+			if counts[s] == 0 {
+				missing++
+			}
+		}
+		if missing == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d of %d streams never got a redis subscription", missing, len(streams))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// frame is the part of a message the bench needs , the sequence rides in the trade id or the last depth update id
+type frame struct {
+	Stream string `json:"stream"`
+	Data   struct {
+		Trade int64 `json:"t"`
+		Last  int64 `json:"u"`
+		// json matches keys without case , "T" and "U" need their own fields or they land in the two above
+		TradeTime int64 `json:"T"`
+		First     int64 `json:"U"`
+	} `json:"data"`
+	OrderId uint64 // order events are sent bare
+}
+
+func (b *bench) read(c *client) {
+	defer close(c.done)
+	var f frame
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if !b.stopping.Load() {
+				b.disconnected(c.endpoint, err)
+			}
+			return
+		}
+		now := time.Now().UnixNano()
+		f = frame{}
+		if json.Unmarshal(data, &f) != nil {
+			continue
+		}
+		if c.endpoint == metrics.EndpointOrderEvents {
+			if f.OrderId == 0 || f.OrderId >= uint64(len(b.oeSentAt)) {
+				continue
+			}
+			c.lat.record(time.Duration(now - loadSent(b.oeSentAt, int(f.OrderId))))
+			b.oeIn.Add(1)
+			continue
+		}
+		seq := f.Data.Trade
+		if strings.HasPrefix(f.Stream, "depth.") {
+			seq = f.Data.Last
+		}
+		if seq <= 0 || seq >= int64(len(b.mdSentAt)) {
+			continue
+		}
+		c.lat.record(time.Duration(now - loadSent(b.mdSentAt, int(seq))))
+		b.mdIn.Add(1)
+	}
+}
+
+func (b *bench) disconnected(endpoint string, err error) {
+	reason := "read error"
+	var ce *websocket.CloseError
+	if errors.As(err, &ce) {
+		reason = fmt.Sprintf("close %d %s", ce.Code, ce.Text)
+	}
+	b.mu.Lock()
+	b.disconnects[endpoint+" "+reason]++
+	b.mu.Unlock()
+}
+
+// scrape sums the gateway counters the report shows , nil when /metrics is not reachable
+func (b *bench) scrape() map[string]float64 {
+	base := strings.Replace(strings.Replace(b.url, "wss://", "https://", 1), "ws://", "http://", 1)
+	resp, err := http.Get(base + "/metrics")
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	sums := map[string]float64{}
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, _, _ := strings.Cut(line, "{")
+		name, _, _ = strings.Cut(name, " ")
+		i := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if i < 0 || err != nil {
+			continue
+		}
+		sums[name] += v
+	}
+	return sums
+}
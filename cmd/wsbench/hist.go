@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/bits"
+	"time"
+)
+
+// hist is a log linear latency histogram , every power of two is split in 16 buckets so a percentile is off
+// by at most ~6% , each client keeps its own and they are merged at the end so reads never share a cache line
+type hist struct {
+	counts [64 * subBuckets]uint64
+	n      uint64
+	max    time.Duration
+}
+
+const subBits = 4
+const subBuckets = 1 << subBits
+
+func bucketOf(d time.Duration) int {
+	v := uint64(max(d, 0))
+	if v < subBuckets {
+		return int(v)
+	}
+	exp := bits.Len64(v) - subBits - 1
+	return (exp+1)*subBuckets + int(v>>exp)&(subBuckets-1)
+}
+
+// lowest value of a bucket , the inverse of bucketOf
+func bucketFloor(i int) time.Duration {
+	if i < subBuckets {
+		return time.Duration(i)
+	}
+	exp := i/subBuckets - 1
+	return time.Duration((uint64(subBuckets) | uint64(i%subBuckets)) << exp)
+}
+
+func (h *hist) record(d time.Duration) {
+	h.counts[bucketOf(d)]++
+	h.n++
+	h.max = max(h.max, d)
+}
+
+func (h *hist) merge(o *hist) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.n += o.n
+	h.max = max(h.max, o.max)
+}
+
+func (h *hist) quantile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(h.n-1))
+	var seen uint64
+	for i, c := range h.counts {
+		seen += c
+		if seen > rank {
+			return min(bucketFloor(i), h.max)
+		}
+	}
+	return h.max
+}
@@ -0,0 +1,361 @@
+// wsbench load tests a gateway from one box , it opens market data and order event connections ,
+// publishes synthetic trades and depth to redis and order events to the shm ring at a fixed rate
+// and reports throughput , end to end latency percentiles , drops and disconnects
+//
+// by default the gateway is embedded , limits off , on its own rings in a temp dir with wsbench producing the
+// order events ring , market data goes through the redis in -redis
+//
+//	go run ./cmd/wsbench -redis 127.0.0.1:6379 -md 2000 -oe 200 -rate 20000 -oe-rate 5000 -duration 10s
+//
+// -gateway points it at a running gateway instead , market data then goes through -redis and order events
+// through the ring in -shm , wsbench becomes the producer of that ring so the engine must not be running ,
+// the gateway limits (max_conns_per_ip , max_streams ...) have to allow the load and ulimit -n has to allow
+// the connections on both sides , a real gateway does not trust the X-User header wsbench sends so start it
+// with -server.dev_user 1001 and run wsbench with -users 1
+//
+//	go run ./cmd/wsbench -gateway ws://127.0.0.1:8080 -redis 127.0.0.1:6379 -shm /dev/shm -md 5000 -oe 0
+package main
+
+import (
+	"context"
+	config "exchange/Config"
+	gateway "exchange/Gateway"
+	metrics "exchange/Metrics"
+	shm "exchange/Shm"
+	ws "exchange/Ws"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type settings struct {
+	gateway     string
+	redis       string
+	shmDir      string
+	md          int
+	oe          int
+	users       int
+	userBase    uint64
+	symbols     int
+	mix         []kindWeight
+	subs        int
+	skew        float64
+	depthLevels int
+	rate        int
+	oeRate      int
+	duration    time.Duration
+	warmup      time.Duration
+	drain       time.Duration
+	dialWorkers int
+	interval    time.Duration
+}
+
+type bench struct {
+	s    settings
+	url  string // ws://host:port
+	rdb  *redis.Client
+	sink func([]shm.OrderEvent)
+
+	mdSentAt []int64 // unix nano publish time by sequence , sequence 0 is never used
+	oeSentAt []int64
+
+	mdPublished, oePublished atomic.Uint64
+	mdExpected, oeExpected   atomic.Uint64 // deliveries the publishes should cause , subscribers times messages
+	mdIn, oeIn               atomic.Uint64
+	dialFailures             atomic.Uint64
+	stopping                 atomic.Bool
+
+	clients []*client
+
+	mu          sync.Mutex
+	disconnects map[string]int // "endpoint reason" , only counted before the bench closes the connections itself
+}
+
+func main() {
+	var s settings
+	var mix string
+	flag.StringVar(&s.gateway, "gateway", "", "ws://host:port of a running gateway , empty embeds one")
+	flag.StringVar(&s.redis, "redis", "", "redis the gateway subscribes to , required with -gateway , the embedded one defaults to 127.0.0.1:6379")
+	flag.StringVar(&s.shmDir, "shm", "", "shm dir of a running gateway , wsbench produces its order events ring")
+	flag.IntVar(&s.md, "md", 1000, "market data connections")
+	flag.IntVar(&s.oe, "oe", 100, "order events connections")
+	flag.IntVar(&s.users, "users", 100, "order events users , connections are spread over them")
+	flag.Uint64Var(&s.userBase, "user-base", 1001, "first order events user id")
+	flag.IntVar(&s.symbols, "symbols", 50, "symbols per stream kind")
+	flag.StringVar(&mix, "mix", "trade=3,depth=1", "stream kinds and their weights , for subscriptions and publishes")
+	flag.IntVar(&s.subs, "subs", 5, "streams per market data connection")
+	flag.Float64Var(&s.skew, "skew", 1.2, "zipf exponent of symbol popularity for subscriptions , <= 1 is uniform")
+	flag.IntVar(&s.depthLevels, "depth-levels", 10, "levels per side in a depth message")
+	flag.IntVar(&s.rate, "rate", 10000, "market data messages per second published to redis")
+	flag.IntVar(&s.oeRate, "oe-rate", 2000, "order events per second written to the ring")
+	flag.DurationVar(&s.duration, "duration", 10*time.Second, "how long to publish")
+	flag.DurationVar(&s.warmup, "warmup", time.Second, "pause between the last subscription and the first publish")
+	flag.DurationVar(&s.drain, "drain", 3*time.Second, "how long to wait for stragglers after the last publish")
+	flag.IntVar(&s.dialWorkers, "dial-workers", 64, "connections dialled in parallel")
+	flag.DurationVar(&s.interval, "interval", time.Second, "progress line interval , 0 disables")
+	flag.Parse()
+
+	var err error
+	if s.mix, err = parseMix(mix); err != nil {
+		fail(2, err)
+	}
+	if s.gateway != "" && s.rate > 0 && s.md > 0 && s.redis == "" {
+		fail(2, fmt.Errorf("-gateway needs -redis to publish market data"))
+	}
+	if s.gateway != "" && s.oeRate > 0 && s.oe > 0 && s.shmDir == "" {
+		fail(2, fmt.Errorf("-gateway needs -shm to publish order events"))
+	}
+
+	b := &bench{s: s, disconnects: map[string]int{}}
+	closeTarget, err := b.target()
+	if err != nil {
+		fail(1, err)
+	}
+	defer closeTarget()
+
+	if err := b.run(); err != nil {
+		closeTarget()
+		fail(1, err)
+	}
+}
+
+func fail(code int, err error) {
+	fmt.Fprintln(os.Stderr, "wsbench:", err)
+	os.Exit(code)
+}
+
+// target sets up url , rdb and sink , either against -gateway or an embedded one
+func (b *bench) target() (func(), error) {
+	if b.s.gateway != "" {
+		b.url = strings.TrimSuffix(b.s.gateway, "/")
+		closers := []func(){}
+		if b.s.redis != "" {
+			b.rdb = redis.NewClient(&redis.Options{Addr: b.s.redis})
+			closers = append(closers, func() { b.rdb.Close() })
+		}
+		if b.s.shmDir != "" {
+			q, err := shm.OpenOrderEventQueue(filepath.Join(b.s.shmDir, config.Default().Shm.OrderEvents))
+			if err != nil {
+				return func() {}, fmt.Errorf("order events ring: %w", err)
+			}
+			b.sink = ringSink(q)
+			closers = append(closers, func() { q.Close() })
+		}
+		return func() {
+			for _, c := range closers {
+				c()
+			}
+		}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "gateway-wsbench-")
+	if err != nil {
+		return func() {}, err
+	}
+	g, q, err := b.embedded(dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return func() {}, fmt.Errorf("embedded gateway: %w", err)
+	}
+	b.url = "ws://" + g.Addr().String()
+	b.rdb = redis.NewClient(&redis.Options{Addr: b.s.redis})
+	b.sink = ringSink(q)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.rdb.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			g.Shutdown(ctx)
+			q.Close()
+			os.RemoveAll(dir)
+		})
+	}, nil
+}
+
+// embedded starts a gateway on fresh rings in dir and opens the producer side of its order events ring
+func (b *bench) embedded(dir string) (*gateway.Gateway, *shm.OrderEventQueue, error) {
+	if b.s.redis == "" {
+		b.s.redis = "127.0.0.1:6379"
+	}
+	cfg := config.Default()
+	cfg.Server.Addr = "127.0.0.1:0"
+	cfg.Shm.Dir = dir
+	cfg.Redis.Addr = b.s.redis
+	cfg.Limits = config.LimitsConfig{} // every limit off , the bench is the only client
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if err := gateway.CreateRings(cfg); err != nil {
+		return nil, nil, err
+	}
+	q, err := shm.OpenOrderEventQueue(cfg.ShmPath(cfg.Shm.OrderEvents))
+	if err != nil {
+		return nil, nil, err
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+	g, err := gateway.New(cfg, gateway.WithLogger(logger), gateway.WithAuthenticator(ws.HeaderAuthenticator(userHeader)))
+	if err == nil {
+		err = g.Start(context.Background())
+	}
+	if err != nil {
+		q.Close()
+		return nil, nil, err
+	}
+	return g, q, nil
+}
+
+func (b *bench) run() error {
+	s := b.s
+	mdTotal := int(s.duration.Seconds() * float64(s.rate))
+	oeTotal := int(s.duration.Seconds() * float64(s.oeRate))
+	b.mdSentAt = make([]int64, mdTotal+1)
+	b.oeSentAt = make([]int64, oeTotal+1)
+
+	fmt.Printf("target %s , dialling %d market data and %d order events connections\n", b.url, s.md, s.oe)
+	start := time.Now()
+	b.connect()
+	var mdUp, oeUp int
+	for _, c := range b.clients {
+		if c.endpoint == metrics.EndpointMarketData {
+			mdUp++
+		} else {
+			oeUp++
+		}
+	}
+	fmt.Printf("connected %d/%d market data , %d/%d order events in %s\n", mdUp, s.md, oeUp, s.oe, time.Since(start).Round(time.Millisecond))
+
+	subscribers, users := b.subscribe()
+	if err := b.waitUpstream(subscribers); err != nil {
+		return err
+	}
+	time.Sleep(s.warmup)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if s.interval > 0 {
+		go b.progress(ctx)
+	}
+
+	startCPU := cpuTime()
+	start = time.Now()
+	var wg sync.WaitGroup
+	var pubErr error
+	if mdTotal > 0 && b.rdb != nil {
+		wg.Go(func() { pubErr = b.publishMarketData(ctx, mdTotal, subscribers) })
+	}
+	if oeTotal > 0 && b.sink != nil && len(users) > 0 {
+		wg.Go(func() { b.publishOrderEvents(ctx, oeTotal, users) })
+	}
+	wg.Wait()
+	published := time.Since(start)
+	if pubErr != nil {
+		return pubErr
+	}
+
+	// stragglers , stop early once everything expected arrived
+	deadline := time.Now().Add(s.drain)
+	for time.Now().Before(deadline) && (b.mdIn.Load() < b.mdExpected.Load() || b.oeIn.Load() < b.oeExpected.Load()) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	wall := time.Since(start)
+	cpu := cpuTime() - startCPU
+	cancel()
+
+	gw := b.scrape()
+	b.stopping.Store(true)
+	for _, c := range b.clients {
+		c.conn.Close()
+	}
+	for _, c := range b.clients {
+		<-c.done
+	}
+	b.report(published, wall, cpu, gw)
+	return nil
+}
+
+func (b *bench) progress(ctx context.Context) {
+	t := time.NewTicker(b.s.interval)
+	defer t.Stop()
+	start := time.Now()
+	var lastMd, lastOe uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		md, oe := b.mdIn.Load(), b.oeIn.Load()
+		b.mu.Lock()
+		dis := 0
+		for _, n := range b.disconnects {
+			dis += n
+		}
+		b.mu.Unlock()
+		secs := b.s.interval.Seconds()
+		fmt.Printf("%6s  md out %8d  in %9.0f/s  |  oe out %8d  in %8.0f/s  |  disconnects %d\n",
+			time.Since(start).Round(time.Second), b.mdPublished.Load(), float64(md-lastMd)/secs,
+			b.oePublished.Load(), float64(oe-lastOe)/secs, dis)
+		lastMd, lastOe = md, oe
+	}
+}
+
+func (b *bench) report(published, wall, cpu time.Duration, gw map[string]float64) {
+	var mdLat, oeLat hist
+	for _, c := range b.clients {
+		if c.endpoint == metrics.EndpointMarketData {
+			mdLat.merge(&c.lat)
+		} else {
+			oeLat.merge(&c.lat)
+		}
+	}
+	fmt.Printf("\npublished for %s , %s including drain\n\n", published.Round(time.Millisecond), wall.Round(time.Millisecond))
+	fmt.Printf("%-13s %10s %10s %10s %10s %12s %9s %9s %9s %9s %9s\n",
+		"", "published", "expected", "received", "missing", "delivered/s", "p50", "p90", "p99", "p99.9", "max")
+	// missing is expected minus received , what the gateway dropped and what was still queued when the drain ended
+	us := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	line := func(name string, pub, exp, in uint64, lat *hist) {
+		fmt.Printf("%-13s %10d %10d %10d %10d %12.0f %9s %9s %9s %9s %9s\n", name, pub, exp, in, exp-min(in, exp),
+			float64(in)/wall.Seconds(), us(lat.quantile(0.50)), us(lat.quantile(0.90)), us(lat.quantile(0.99)), us(lat.quantile(0.999)), us(lat.max))
+	}
+	line("market data", b.mdPublished.Load(), b.mdExpected.Load(), b.mdIn.Load(), &mdLat)
+	line("order events", b.oePublished.Load(), b.oeExpected.Load(), b.oeIn.Load(), &oeLat)
+
+	fmt.Printf("\ndial failures %d\n", b.dialFailures.Load())
+	reasons := make([]string, 0, len(b.disconnects))
+	for r := range b.disconnects {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		fmt.Printf("disconnects   %-40s %d\n", r, b.disconnects[r])
+	}
+	if gw != nil {
+		fmt.Printf("gateway       dropped %.0f , slow consumer disconnects %.0f , limit rejections %.0f\n",
+			gw["gateway_dropped_messages_total"], gw["gateway_slow_consumer_disconnects_total"], gw["gateway_limit_rejections_total"])
+	}
+	who := "wsbench"
+	if b.s.gateway == "" {
+		who = "wsbench and the embedded gateway"
+	}
+	fmt.Printf("cpu           %.2f cores for %s\n", cpu.Seconds()/wall.Seconds(), who)
+}
+
+// user + system time of the process
+func cpuTime() time.Duration {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+}
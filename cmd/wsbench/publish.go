@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	shm "exchange/Shm"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type kindWeight struct {
+	kind   string
+	weight int
+}
+
+// parseMix reads "trade=3,depth=1"
+func parseMix(s string) ([]kindWeight, error) {
+	var mix []kindWeight
+	for _, part := range strings.Split(s, ",") {
+		kind, w, ok := strings.Cut(strings.TrimSpace(part), "=")
+		weight, err := strconv.Atoi(w)
+		if !ok || err != nil || weight < 0 {
+			return nil, fmt.Errorf("bad -mix entry %q , want kind=weight", part)
+		}
+		if kind != "trade" && kind != "depth" {
+			return nil, fmt.Errorf("unknown stream kind %q in -mix , want trade or depth", kind)
+		}
+		if weight > 0 {
+			mix = append(mix, kindWeight{kind: kind, weight: weight})
+		}
+	}
+	if len(mix) == 0 {
+		return nil, fmt.Errorf("-mix has no stream kind with a weight")
+	}
+	return mix, nil
+}
+
+// weightedKinds repeats each kind by its weight , indexing it round robin or at random follows the mix
+func weightedKinds(mix []kindWeight) []string {
+	var kinds []string
+	for _, kw := range mix {
+		for range kw.weight {
+			kinds = append(kinds, kw.kind)
+		}
+	}
+	return kinds
+}
+
+func streamName(kind string, symbol int) string {
+	return kind + "." + strconv.Itoa(symbol)
+}
+
+// symbolPicker returns symbols 1..n , zipf distributed when skew > 1 so a few symbols get most subscribers
+func symbolPicker(rng *rand.Rand, n int, skew float64) func() int {
+	if skew <= 1 || n < 2 {
+		return func() int { return 1 + rng.IntN(n) }
+	}
+	z := rand.NewZipf(rng, skew, 1, uint64(n-1))
+	return func() int { return 1 + int(z.Uint64()) }
+}
+
+func storeSent(sentAt []int64, seq int, at int64) { atomic.StoreInt64(&sentAt[seq], at) }
+func loadSent(sentAt []int64, seq int) int64      { return atomic.LoadInt64(&sentAt[seq]) }
+
+// paced calls send every millisecond with how many messages are due to hold rate , until total were sent
+func paced(ctx context.Context, rate, total int, send func(n int) error) error {
+	start := time.Now()
+	t := time.NewTicker(time.Millisecond)
+	defer t.Stop()
+	sent := 0
+	for sent < total {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		due := min(int(time.Since(start).Seconds()*float64(rate)), total) - sent
+		if due <= 0 {
+			continue
+		}
+		if err := send(due); err != nil {
+			return err
+		}
+		sent += due
+	}
+	return nil
+}
+
+// publishMarketData publishes round robin over every stream of the mix , one redis pipeline per tick
+func (b *bench) publishMarketData(ctx context.Context, total int, subscribers map[string]int) error {
+	kinds := weightedKinds(b.s.mix)
+	var streams []string
+	for sym := 1; sym <= b.s.symbols; sym++ {
+		for _, k := range kinds {
+			streams = append(streams, streamName(k, sym))
+		}
+	}
+	levels := depthLevels(b.s.depthLevels)
+	seq, next := 0, 0
+	return paced(ctx, b.s.rate, total, func(n int) error {
+		pipe := b.rdb.Pipeline()
+		now := time.Now()
+		ms := now.UnixMilli()
+		var expected uint64
+		for range n {
+			seq++
+			stream := streams[next]
+			next = (next + 1) % len(streams)
+			var msg string
+			if strings.HasPrefix(stream, "depth.") {
+				msg = fmt.Sprintf(`{"e":"depth","E":%d,"s":%s,"T":%d,"U":%d,"u":%d,%s}`, ms, stream[len("depth."):], ms, seq, seq, levels)
+			} else {
+				msg = fmt.Sprintf(`{"e":"trade","E":%d,"s":%s,"T":%d,"t":%d,"p":100,"q":1,"a":"","b":"","m":false}`, ms, stream[len("trade."):], ms, seq)
+			}
+			storeSent(b.mdSentAt, seq, now.UnixNano())
+			pipe.Publish(ctx, stream, msg)
+			expected += uint64(subscribers[stream])
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("redis publish: %w", err)
+		}
+		b.mdPublished.Add(uint64(n))
+		b.mdExpected.Add(expected)
+		return nil
+	})
+}
+
+func depthLevels(n int) string {
+	var bids, asks []string
+	for i := range n {
+		bids = append(bids, fmt.Sprintf(`["%d","1"]`, 100-i))
+		asks = append(asks, fmt.Sprintf(`["%d","1"]`, 101+i))
+	}
+	return `"b":[` + strings.Join(bids, ",") + `],"a":[` + strings.Join(asks, ",") + `]`
+}
+
+// publishOrderEvents spreads events round robin over the users that have connections , the sequence is the order id
+func (b *bench) publishOrderEvents(ctx context.Context, total int, users map[uint64]int) {
+	ids := make([]uint64, 0, len(users))
+	for id := range users {
+		ids = append(ids, id)
+	}
+	seq, next := 0, 0
+	paced(ctx, b.s.oeRate, total, func(n int) error {
+		// the embedded engine keeps the slice until it is on the ring , every tick needs a fresh one
+		evs := make([]shm.OrderEvent, n)
+		now := time.Now().UnixNano()
+		var expected uint64
+		for i := range evs {
+			seq++
+			user := ids[next]
+			next = (next + 1) % len(ids)
+			evs[i] = shm.OrderEvent{UserId: user, OrderId: uint64(seq), Symbol: 1, EventKind: eventPartiallyFilled, FilledQty: 1, RemainingQty: 1, OriginalQty: 2}
+			storeSent(b.oeSentAt, seq, now)
+			expected += uint64(users[user])
+		}
+		b.sink(evs)
+		b.oePublished.Add(uint64(n))
+		b.oeExpected.Add(expected)
+		return nil
+	})
+}
+
+// the gateway routes order events without looking at the kind
+const eventPartiallyFilled uint32 = 2
+
+// ringSink writes to the order events ring of the gateway , a full ring is retried like the engine would
+func ringSink(q *shm.OrderEventQueue) func([]shm.OrderEvent) {
+	return func(evs []shm.OrderEvent) {
+		for len(evs) > 0 {
+			n, _ := q.EnqueueBatch(evs)
+			evs = evs[n:]
+			if len(evs) > 0 {
+				time.Sleep(50 * time.Microsecond)
+			}
+		}
+	}
+}
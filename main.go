@@ -1,73 +1,42 @@
 package main
 
 import (
-	pubsubmanager "exchange/PubSubManager"
-	symbolmanager "exchange/SymbolManager"
-	ws "exchange/Ws"
-	shm "exchange/Shm"
-	hub "exchange/Hub"
+	"context"
+	config "exchange/Config"
+	gateway "exchange/Gateway"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
 
 )
 
+// the binary is a thin wrapper around Gateway , see Gateway/gateway.go for the wiring and shutdown order
 func main() {
-	balance_Response_queue , berr := shm.OpenBalanceResponseQueue("/tmp/trading/BalanceResponse")
-	if berr!=nil{
-		panic(fmt.Errorf("BalanceResponseQueue error: %w", berr))
+	cfg , cfgerr := config.Load(os.Args[1:])
+	if cfgerr!=nil{
+		fmt.Fprintln(os.Stderr, cfgerr)
+		os.Exit(2)
 	}
-	cancel_order_queue , cerr := shm.OpenCancelOrderQueue("/tmp/trading/CancelOrders")
-	if cerr!=nil{
-		panic(fmt.Errorf("OpenCancelOrderQueue error: %w", berr))
+	g , gerr := gateway.New(cfg)
+	if gerr!=nil{
+		panic(gerr)
 	}
-	holdings_response_queue , herr := shm.OpenHoldingResponseQueue("/tmp/trading/HoldingsResponse")
-	if herr!=nil{
-		panic(fmt.Errorf("OpenHoldingResponseQueue error: %w", berr))
+	slog.SetDefault(g.Logger())
+	if serr := g.Start(context.Background()); serr != nil {
+		panic(serr)
 	}
-	order_events_queue , oerr := shm.OpenOrderEventQueue("/tmp/trading/OrderEvents")
-	if oerr!=nil{
-		panic(fmt.Errorf("OpenOrderEventQueue error: %w", berr))
-	}
-	post_order_queue , qerr := shm.OpenQueue("/tmp/trading/IncomingOrdersForMe")
-	if qerr!=nil{
-		panic(fmt.Errorf("OpenQueue error: %w", berr))
-	}
-	queries_queue , querr := shm.OpenQueryQueue("/tmp/trading/Queries")
-	if querr!=nil{
-		panic(fmt.Errorf("OpenQueryQueue error: %w", berr))
-	}
-
-	sm := symbolmanager.CreateSymbolManagerSingleton()
-	pubsubm := pubsubmanager.CreateSingletonInstance(sm)
-	sm.Subscriber = pubsubm
-	sm.Unsubscriber = pubsubm
-	go sm.StartSymbolMnagaer()
-
-
-	order_event_hub := hub.NewOrderEventHub()
-	go order_event_hub.Start()
-	wsServer := ws.NewServer(sm , order_event_hub)
-	go wsServer.CreateServer()
-	
-	
-	
-
-	shmmanager:= shm.ShmManager{
-		Balance_Response_queue: balance_Response_queue,
-		CancelOrderQueue: cancel_order_queue,
-		Holding_Response_queue: holdings_response_queue,
-		Order_Events_queue: order_events_queue,
-		Post_Order_queue: post_order_queue,
-		Query_queue: queries_queue,
-	}
-	shmmanager.BrodCaster = order_event_hub
-	go shmmanager.PollOrderEvents()
-
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
-	fmt.Println("Shutting down gracefully...")
+	slog.Info("shutdown requested", "timeout", cfg.Server.ShutdownTimeout.String())
+
+	// everything below shares one deadline , whatever is left when it expires is dropped by the exit
+	ctx , cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := g.Shutdown(ctx); err != nil {
+		slog.Error("shutdown failed", "err", err)
+	}
 }
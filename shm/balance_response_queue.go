@@ -34,6 +34,10 @@ type BalanceResponseHeader struct {
 	_      [56]byte // Padding
 	Magic        uint32   // Offset 128
 	Capacity     uint32   // Offset 132
+	LayoutHash   uint64   // Offset 136
+	Doorbell     uint32   // Offset 144
+	Waiters      uint32   // Offset 148
+	ConsumerReserved uint64 // Offset 152 , read but not yet committed (see recovery.go)
 }
 
 const (
@@ -83,6 +87,7 @@ func CreateBalanceResponseQueue(path string) (*BalanceResponseQueue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, BQueueMagic)
 	atomic.StoreUint32(&header.Capacity, BQueueCapacity)
+	atomic.StoreUint64(&header.LayoutHash, BalanceResponseLayoutHash)
 
 	respData := m[BalanceResponseHeaderSize:BalanceResponseTotalSize]
 	response := unsafe.Slice(
@@ -127,8 +132,17 @@ func OpenBalanceResponseQueue(path string) (*BalanceResponseQueue, error) {
 
 	header := (*BalanceResponseHeader)(unsafe.Pointer(&m[0]))
 	if atomic.LoadUint32(&header.Magic) != BQueueMagic {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
 		return nil, fmt.Errorf("invalid magic")
 	}
+	if err := checkLayoutHash(atomic.LoadUint64(&header.LayoutHash), BalanceResponseLayoutHash); err != nil {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
 
 	respData := m[BalanceResponseHeaderSize:BalanceResponseTotalSize]
 	response := unsafe.Slice(
@@ -157,6 +171,7 @@ func (q *BalanceResponseQueue) Enqueue(resp BalanceResponse) error {
 	q.response[pos] = resp
 
 	atomic.StoreUint64(&q.header.ProducerHead, producer+1)
+	q.Doorbell().Ring()
 	return nil
 }
 
@@ -177,11 +192,116 @@ func (q *BalanceResponseQueue) Dequeue() (*BalanceResponse, error) {
 }
 
 
+// EnqueueBatch writes as many entries as fit and publishes them with a single head store
+// returns how many were written , with an error when the ring could not take all of them
+func (q *BalanceResponseQueue) EnqueueBatch(resps []BalanceResponse) (int, error) {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+
+	n := uint64(len(resps))
+	if free := BQueueCapacity - (producer - consumer); n > free {
+		n = free
+	}
+	if n > 0 {
+		pos := producer % BQueueCapacity
+		first := copy(q.response[pos:], resps[:n])
+		copy(q.response, resps[first:n])
+
+		atomic.StoreUint64(&q.header.ProducerHead, producer+n)
+		q.Doorbell().Ring()
+	}
+	if n < uint64(len(resps)) {
+		return int(n), fmt.Errorf("queue full")
+	}
+	return int(n), nil
+}
+
+// DequeueBatch copies up to len(dst) entries into dst and releases them with a single tail store
+func (q *BalanceResponseQueue) DequeueBatch(dst []BalanceResponse) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % BQueueCapacity
+	first := copy(dst[:n], q.response[pos:])
+	copy(dst[first:n], q.response)
+
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+n)
+	return int(n)
+}
+
+// PeekBatch copies up to len(dst) entries starting at the committed tail without releasing them
+// the slots stay in flight until Commit , a crash before that delivers them again after restart
+func (q *BalanceResponseQueue) PeekBatch(dst []BalanceResponse) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % BQueueCapacity
+	first := copy(dst[:n], q.response[pos:])
+	copy(dst[first:n], q.response)
+
+	atomic.StoreUint64(&q.header.ConsumerReserved, consumer+n)
+	return int(n)
+}
+
+// Commit releases the first n entries returned by the last PeekBatch , more than are in flight is refused
+func (q *BalanceResponseQueue) Commit(n int) error {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	if err := checkCommit(consumer, atomic.LoadUint64(&q.header.ConsumerReserved), n); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+uint64(n))
+	return nil
+}
+
+// Recover reports what the previous consumer left behind , call it once right after Open
+func (q *BalanceResponseQueue) Recover(mode RecoveryMode) (RecoveryReport, error) {
+	report, tail, err := recoverPositions(
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail),
+		atomic.LoadUint64(&q.header.ConsumerReserved),
+		BQueueCapacity, mode)
+	if err != nil {
+		return report, err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	atomic.StoreUint64(&q.header.ConsumerReserved, tail)
+	return report, nil
+}
+
 func (q *BalanceResponseQueue) Depth() uint64 {
 	return atomic.LoadUint64(&q.header.ProducerHead) -
 		atomic.LoadUint64(&q.header.ConsumerTail)
 }
 
+// doorbell in the header , rung by Enqueue and waited on by pollers
+func (q *BalanceResponseQueue) Doorbell() Doorbell {
+	return Doorbell{seq: &q.header.Doorbell, waiters: &q.header.Waiters}
+}
+
+// Status snapshots the header for readiness checks , see health.go
+func (q *BalanceResponseQueue) Status() RingStatus {
+	headerOK := atomic.LoadUint32(&q.header.Magic) == BQueueMagic &&
+		atomic.LoadUint32(&q.header.Capacity) == BQueueCapacity &&
+		atomic.LoadUint64(&q.header.LayoutHash) == BalanceResponseLayoutHash
+	return ringStatus(q.file, headerOK,
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail))
+}
+
 func (q *BalanceResponseQueue) Flush() error {
 	return q.mmap.Flush()
 }
@@ -22,6 +22,10 @@ type CancelOrderQueueHeader struct {
 	_      [56]byte // Padding
 	Magic        uint32   // Offset 128
 	Capacity     uint32   // Offset 132
+	LayoutHash   uint64   // Offset 136
+	Doorbell     uint32   // Offset 144
+	Waiters      uint32   // Offset 148
+	ConsumerReserved uint64 // Offset 152 , read but not yet committed (see recovery.go)
 }
 
 const (
@@ -74,6 +78,7 @@ func CreateCancelOrderQueue(path string) (*CancelOrderQueue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, CancelQueueMagic)
 	atomic.StoreUint32(&header.Capacity, CancelQueueCapacity)
+	atomic.StoreUint64(&header.LayoutHash, CancelOrderLayoutHash)
 
 	data := m[CancelHeaderSize:CancelQueueTotalSize]
 	orders := unsafe.Slice(
@@ -118,8 +123,17 @@ func OpenCancelOrderQueue(path string) (*CancelOrderQueue, error) {
 
 	header := (*CancelOrderQueueHeader)(unsafe.Pointer(&m[0]))
 	if atomic.LoadUint32(&header.Magic) != CancelQueueMagic {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
 		return nil, fmt.Errorf("invalid cancel queue magic")
 	}
+	if err := checkLayoutHash(atomic.LoadUint64(&header.LayoutHash), CancelOrderLayoutHash); err != nil {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
 
 	data := m[CancelHeaderSize:CancelQueueTotalSize]
 	orders := unsafe.Slice(
@@ -148,6 +162,7 @@ func (q *CancelOrderQueue) Enqueue(order OrderToBeCanceled) error {
 	q.orders[pos] = order
 
 	atomic.StoreUint64(&q.header.ProducerHead, producer+1)
+	q.Doorbell().Ring()
 	return nil
 }
 
@@ -168,11 +183,116 @@ func (q *CancelOrderQueue) Dequeue() (*OrderToBeCanceled, error) {
 }
 
 
+// EnqueueBatch writes as many entries as fit and publishes them with a single head store
+// returns how many were written , with an error when the ring could not take all of them
+func (q *CancelOrderQueue) EnqueueBatch(orders []OrderToBeCanceled) (int, error) {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+
+	n := uint64(len(orders))
+	if free := CancelQueueCapacity - (producer - consumer); n > free {
+		n = free
+	}
+	if n > 0 {
+		pos := producer % CancelQueueCapacity
+		first := copy(q.orders[pos:], orders[:n])
+		copy(q.orders, orders[first:n])
+
+		atomic.StoreUint64(&q.header.ProducerHead, producer+n)
+		q.Doorbell().Ring()
+	}
+	if n < uint64(len(orders)) {
+		return int(n), fmt.Errorf("cancel queue full")
+	}
+	return int(n), nil
+}
+
+// DequeueBatch copies up to len(dst) entries into dst and releases them with a single tail store
+func (q *CancelOrderQueue) DequeueBatch(dst []OrderToBeCanceled) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % CancelQueueCapacity
+	first := copy(dst[:n], q.orders[pos:])
+	copy(dst[first:n], q.orders)
+
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+n)
+	return int(n)
+}
+
+// PeekBatch copies up to len(dst) entries starting at the committed tail without releasing them
+// the slots stay in flight until Commit , a crash before that delivers them again after restart
+func (q *CancelOrderQueue) PeekBatch(dst []OrderToBeCanceled) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % CancelQueueCapacity
+	first := copy(dst[:n], q.orders[pos:])
+	copy(dst[first:n], q.orders)
+
+	atomic.StoreUint64(&q.header.ConsumerReserved, consumer+n)
+	return int(n)
+}
+
+// Commit releases the first n entries returned by the last PeekBatch , more than are in flight is refused
+func (q *CancelOrderQueue) Commit(n int) error {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	if err := checkCommit(consumer, atomic.LoadUint64(&q.header.ConsumerReserved), n); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+uint64(n))
+	return nil
+}
+
+// Recover reports what the previous consumer left behind , call it once right after Open
+func (q *CancelOrderQueue) Recover(mode RecoveryMode) (RecoveryReport, error) {
+	report, tail, err := recoverPositions(
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail),
+		atomic.LoadUint64(&q.header.ConsumerReserved),
+		CancelQueueCapacity, mode)
+	if err != nil {
+		return report, err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	atomic.StoreUint64(&q.header.ConsumerReserved, tail)
+	return report, nil
+}
+
 func (q *CancelOrderQueue) Depth() uint64 {
 	return atomic.LoadUint64(&q.header.ProducerHead) -
 		atomic.LoadUint64(&q.header.ConsumerTail)
 }
 
+// doorbell in the header , rung by Enqueue and waited on by pollers
+func (q *CancelOrderQueue) Doorbell() Doorbell {
+	return Doorbell{seq: &q.header.Doorbell, waiters: &q.header.Waiters}
+}
+
+// Status snapshots the header for readiness checks , see health.go
+func (q *CancelOrderQueue) Status() RingStatus {
+	headerOK := atomic.LoadUint32(&q.header.Magic) == CancelQueueMagic &&
+		atomic.LoadUint32(&q.header.Capacity) == CancelQueueCapacity &&
+		atomic.LoadUint64(&q.header.LayoutHash) == CancelOrderLayoutHash
+	return ringStatus(q.file, headerOK,
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail))
+}
+
 func (q *CancelOrderQueue) Capacity() uint64 {
 	return CancelQueueCapacity
 }
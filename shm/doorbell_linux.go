@@ -0,0 +1,27 @@
+//go:build linux
+
+package shm
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// shared (non private) futex ops so the wake crosses the process boundary with the engine
+const (
+	futexWaitOp = 0
+	futexWakeOp = 1
+)
+
+func futexWait(addr *uint32, val uint32, timeout time.Duration) {
+	ts := syscall.NsecToTimespec(int64(timeout))
+	// EAGAIN (value already changed) , ETIMEDOUT and EINTR all mean go back and poll
+	_, _, _ = syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), futexWaitOp,
+		uintptr(val), uintptr(unsafe.Pointer(&ts)), 0, 0)
+}
+
+func futexWake(addr *uint32) {
+	_, _, _ = syscall.Syscall6(syscall.SYS_FUTEX, uintptr(unsafe.Pointer(addr)), futexWakeOp,
+		1, 0, 0, 0)
+}
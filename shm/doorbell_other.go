@@ -0,0 +1,18 @@
+//go:build !linux
+
+package shm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// no futex outside linux , poll the sequence word with short sleeps until it moves or the timeout expires
+func futexWait(addr *uint32, val uint32, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadUint32(addr) == val && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Microsecond)
+	}
+}
+
+func futexWake(addr *uint32) {}
@@ -0,0 +1,94 @@
+package shm
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// readiness of a mapped ring , used by the /readyz checks in main
+// a ring is usable when its header still matches this build and the file at its path is the one we mapped ,
+// Create* removes and recreates the file so an engine restart leaves us on an unlinked ring nobody produces into
+// on top of that a RingMonitor notices a consumer that stopped draining
+
+type RingStatus struct {
+	HeaderOK     bool   // magic , capacity and layout hash match
+	Problem      string // why the header or the file is not ok , empty when both are
+	ProducerHead uint64
+	ConsumerTail uint64
+}
+
+func (s RingStatus) Depth() uint64 {
+	return s.ProducerHead - s.ConsumerTail
+}
+
+// ringStatus fills the file part of a status , every queue calls it from Status
+func ringStatus(file *os.File, headerOK bool, head, tail uint64) RingStatus {
+	status := RingStatus{HeaderOK: headerOK, ProducerHead: head, ConsumerTail: tail}
+	if !headerOK {
+		status.Problem = "header no longer matches magic , capacity or layout hash"
+		return status
+	}
+	mapped, err := file.Stat()
+	if err != nil {
+		status.Problem = fmt.Sprintf("stat of mapped file failed: %v", err)
+		return status
+	}
+	onDisk, err := os.Stat(file.Name())
+	if err != nil {
+		status.Problem = fmt.Sprintf("ring file gone: %v", err)
+		return status
+	}
+	if !os.SameFile(mapped, onDisk) {
+		status.Problem = "ring file was recreated , the producer restarted and this mapping is stale"
+	}
+	return status
+}
+
+// RingMonitor turns a status into a readiness check
+// with watchConsumer set , entries waiting longer than stallAfter without the tail moving fail the check ,
+// a producer that is idle is fine as long as its file is still the one we mapped
+type RingMonitor struct {
+	status        func() RingStatus
+	watchConsumer bool
+	stallAfter    time.Duration
+
+	mu        sync.Mutex
+	seen      bool
+	lastTail  uint64
+	lastEmpty bool
+	tailMoved time.Time // last time the tail moved or entries started waiting
+}
+
+func NewRingMonitor(status func() RingStatus, watchConsumer bool, stallAfter time.Duration) *RingMonitor {
+	return &RingMonitor{status: status, watchConsumer: watchConsumer, stallAfter: stallAfter}
+}
+
+func (m *RingMonitor) Check(ctx context.Context) error {
+	s := m.status()
+	if s.Problem != "" {
+		return fmt.Errorf("%s", s.Problem)
+	}
+	if s.ConsumerTail > s.ProducerHead {
+		return fmt.Errorf("corrupt positions head=%d tail=%d", s.ProducerHead, s.ConsumerTail)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	// entries that showed up since an empty check only start the clock now
+	if !m.seen || s.ConsumerTail != m.lastTail || m.lastEmpty || s.Depth() == 0 {
+		m.seen = true
+		m.lastTail = s.ConsumerTail
+		m.lastEmpty = s.Depth() == 0
+		m.tailMoved = now
+		return nil
+	}
+	if m.watchConsumer && now.Sub(m.tailMoved) > m.stallAfter {
+		return fmt.Errorf("consumer stalled: depth %d , tail stuck at %d for %s",
+			s.Depth(), s.ConsumerTail, now.Sub(m.tailMoved).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -32,6 +32,10 @@ type HoldingResponseQueueHeader struct {
 	_pad2        [56]byte
 	Magic        uint32
 	Capacity     uint32
+	LayoutHash   uint64   // Offset 136
+	Doorbell     uint32   // Offset 144
+	Waiters      uint32   // Offset 148
+	ConsumerReserved uint64 // Offset 152 , read but not yet committed (see recovery.go)
 }
 
 const (
@@ -82,6 +86,7 @@ func CreateHoldingResponseQueue(path string) (*HoldingResponseQueue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, HoldingsQueueMagic)
 	atomic.StoreUint32(&header.Capacity, HoldingsQueueCapacity)
+	atomic.StoreUint64(&header.LayoutHash, HoldingResponseLayoutHash)
 
 	data := m[HoldingsHeaderSize:HoldingsQueueTotalSize]
 	response := unsafe.Slice(
@@ -126,8 +131,17 @@ func OpenHoldingResponseQueue(path string) (*HoldingResponseQueue, error) {
 
 	header := (*HoldingResponseQueueHeader)(unsafe.Pointer(&m[0]))
 	if atomic.LoadUint32(&header.Magic) != HoldingsQueueMagic {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
 		return nil, fmt.Errorf("invalid holdings queue magic")
 	}
+	if err := checkLayoutHash(atomic.LoadUint64(&header.LayoutHash), HoldingResponseLayoutHash); err != nil {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
 
 	data := m[HoldingsHeaderSize:HoldingsQueueTotalSize]
 	response := unsafe.Slice(
@@ -156,6 +170,7 @@ func (q *HoldingResponseQueue) Enqueue(resp HoldingResponse) error {
 	q.response[pos] = resp
 
 	atomic.StoreUint64(&q.header.ProducerHead, producer+1)
+	q.Doorbell().Ring()
 	return nil
 }
 
@@ -175,11 +190,116 @@ func (q *HoldingResponseQueue) Dequeue() (*HoldingResponse, error) {
 	return &resp, nil
 }
 
+// EnqueueBatch writes as many entries as fit and publishes them with a single head store
+// returns how many were written , with an error when the ring could not take all of them
+func (q *HoldingResponseQueue) EnqueueBatch(resps []HoldingResponse) (int, error) {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+
+	n := uint64(len(resps))
+	if free := HoldingsQueueCapacity - (producer - consumer); n > free {
+		n = free
+	}
+	if n > 0 {
+		pos := producer % HoldingsQueueCapacity
+		first := copy(q.response[pos:], resps[:n])
+		copy(q.response, resps[first:n])
+
+		atomic.StoreUint64(&q.header.ProducerHead, producer+n)
+		q.Doorbell().Ring()
+	}
+	if n < uint64(len(resps)) {
+		return int(n), fmt.Errorf("holdings response queue full")
+	}
+	return int(n), nil
+}
+
+// DequeueBatch copies up to len(dst) entries into dst and releases them with a single tail store
+func (q *HoldingResponseQueue) DequeueBatch(dst []HoldingResponse) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % HoldingsQueueCapacity
+	first := copy(dst[:n], q.response[pos:])
+	copy(dst[first:n], q.response)
+
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+n)
+	return int(n)
+}
+
+// PeekBatch copies up to len(dst) entries starting at the committed tail without releasing them
+// the slots stay in flight until Commit , a crash before that delivers them again after restart
+func (q *HoldingResponseQueue) PeekBatch(dst []HoldingResponse) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % HoldingsQueueCapacity
+	first := copy(dst[:n], q.response[pos:])
+	copy(dst[first:n], q.response)
+
+	atomic.StoreUint64(&q.header.ConsumerReserved, consumer+n)
+	return int(n)
+}
+
+// Commit releases the first n entries returned by the last PeekBatch , more than are in flight is refused
+func (q *HoldingResponseQueue) Commit(n int) error {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	if err := checkCommit(consumer, atomic.LoadUint64(&q.header.ConsumerReserved), n); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+uint64(n))
+	return nil
+}
+
+// Recover reports what the previous consumer left behind , call it once right after Open
+func (q *HoldingResponseQueue) Recover(mode RecoveryMode) (RecoveryReport, error) {
+	report, tail, err := recoverPositions(
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail),
+		atomic.LoadUint64(&q.header.ConsumerReserved),
+		HoldingsQueueCapacity, mode)
+	if err != nil {
+		return report, err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	atomic.StoreUint64(&q.header.ConsumerReserved, tail)
+	return report, nil
+}
+
 func (q *HoldingResponseQueue) Depth() uint64 {
 	return atomic.LoadUint64(&q.header.ProducerHead) -
 		atomic.LoadUint64(&q.header.ConsumerTail)
 }
 
+// doorbell in the header , rung by Enqueue and waited on by pollers
+func (q *HoldingResponseQueue) Doorbell() Doorbell {
+	return Doorbell{seq: &q.header.Doorbell, waiters: &q.header.Waiters}
+}
+
+// Status snapshots the header for readiness checks , see health.go
+func (q *HoldingResponseQueue) Status() RingStatus {
+	headerOK := atomic.LoadUint32(&q.header.Magic) == HoldingsQueueMagic &&
+		atomic.LoadUint32(&q.header.Capacity) == HoldingsQueueCapacity &&
+		atomic.LoadUint64(&q.header.LayoutHash) == HoldingResponseLayoutHash
+	return ringStatus(q.file, headerOK,
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail))
+}
+
 func (q *HoldingResponseQueue) Flush() error {
 	return q.mmap.Flush()
 }
@@ -0,0 +1,235 @@
+package shm
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"unsafe"
+
+	"github.com/edsrzf/mmap-go"
+)
+
+// read only view over any of the six rings , used by cmd/shmctl
+// every ring header has the same layout as QueueHeader so the header is read through that type
+
+type RingKind string
+
+const (
+	RingOrders   RingKind = "orders"
+	RingCancels  RingKind = "cancels"
+	RingQueries  RingKind = "queries"
+	RingEvents   RingKind = "events"
+	RingBalances RingKind = "balances"
+	RingHoldings RingKind = "holdings"
+)
+
+type ringSpec struct {
+	magic      uint32
+	capacity   uint64
+	headerSize uintptr
+	entrySize  uintptr
+	totalSize  uintptr
+	layoutHash uint64
+	decode     func(p unsafe.Pointer) any
+	create     func(path string) (interface{ Close() error }, error)
+}
+
+var ringSpecs = map[RingKind]ringSpec{
+	RingOrders: {
+		magic: QueueMagic, capacity: QueueCapacity,
+		headerSize: HeaderSize, entrySize: OrderSize, totalSize: TotalSize,
+		layoutHash: OrderLayoutHash,
+		decode:     func(p unsafe.Pointer) any { return *(*Order)(p) },
+		create:     func(path string) (interface{ Close() error }, error) { return CreateQueue(path) },
+	},
+	RingCancels: {
+		magic: CancelQueueMagic, capacity: CancelQueueCapacity,
+		headerSize: CancelHeaderSize, entrySize: CancelOrderSize, totalSize: CancelQueueTotalSize,
+		layoutHash: CancelOrderLayoutHash,
+		decode:     func(p unsafe.Pointer) any { return *(*OrderToBeCanceled)(p) },
+		create:     func(path string) (interface{ Close() error }, error) { return CreateCancelOrderQueue(path) },
+	},
+	RingQueries: {
+		magic: QueryQueueMagic, capacity: QueryQueueCapacity,
+		headerSize: QueryHeaderSize, entrySize: QuerySize, totalSize: QueryTotalSize,
+		layoutHash: QueryLayoutHash,
+		decode:     func(p unsafe.Pointer) any { return *(*Query)(p) },
+		create:     func(path string) (interface{ Close() error }, error) { return CreateQueryQueue(path) },
+	},
+	RingEvents: {
+		magic: OrderEventQueueMagic, capacity: OrderEventQueueCapacity,
+		headerSize: OrderEventHeaderSize, entrySize: OrderEventSize, totalSize: OrderEventTotalSize,
+		layoutHash: OrderEventLayoutHash,
+		decode:     func(p unsafe.Pointer) any { return *(*OrderEvent)(p) },
+		create:     func(path string) (interface{ Close() error }, error) { return CreateOrderEventQueue(path) },
+	},
+	RingBalances: {
+		magic: BQueueMagic, capacity: BQueueCapacity,
+		headerSize: BalanceResponseHeaderSize, entrySize: BalanceResponseSize, totalSize: BalanceResponseTotalSize,
+		layoutHash: BalanceResponseLayoutHash,
+		decode:     func(p unsafe.Pointer) any { return *(*BalanceResponse)(p) },
+		create:     func(path string) (interface{ Close() error }, error) { return CreateBalanceResponseQueue(path) },
+	},
+	RingHoldings: {
+		magic: HoldingsQueueMagic, capacity: HoldingsQueueCapacity,
+		headerSize: HoldingsHeaderSize, entrySize: HoldingResponseSize, totalSize: HoldingsQueueTotalSize,
+		layoutHash: HoldingResponseLayoutHash,
+		decode:     func(p unsafe.Pointer) any { return *(*HoldingResponse)(p) },
+		create:     func(path string) (interface{ Close() error }, error) { return CreateHoldingResponseQueue(path) },
+	},
+}
+
+// RingKinds lists every kind in a stable order
+func RingKinds() []RingKind {
+	return []RingKind{RingOrders, RingCancels, RingQueries, RingEvents, RingBalances, RingHoldings}
+}
+
+// CreateRing creates a fresh ring of the given kind with the matching Create* function
+func CreateRing(kind RingKind, path string) error {
+	spec, ok := ringSpecs[kind]
+	if !ok {
+		return fmt.Errorf("unknown ring kind %q", kind)
+	}
+	q, err := spec.create(path)
+	if err != nil {
+		return err
+	}
+	return q.Close()
+}
+
+type RingInfo struct {
+	Kind             RingKind `json:"kind"`
+	Path             string   `json:"path"`
+	FileSize         int64    `json:"file_size"`
+	ExpectedSize     int64    `json:"expected_size"`
+	Magic            uint32   `json:"magic"`
+	ExpectedMagic    uint32   `json:"expected_magic"`
+	Capacity         uint32   `json:"capacity"`
+	LayoutHash       uint64   `json:"layout_hash"`
+	ProducerHead     uint64   `json:"producer_head"`
+	ConsumerTail     uint64   `json:"consumer_tail"`
+	ConsumerReserved uint64   `json:"consumer_reserved"`
+	Depth            uint64   `json:"depth"`
+}
+
+type RingInspector struct {
+	kind   RingKind
+	spec   ringSpec
+	path   string
+	file   *os.File
+	mmap   mmap.MMap
+	header *QueueHeader
+}
+
+// InspectRing maps a ring read only , nothing is validated here so broken files can still be looked at
+// an empty kind detects the ring from the magic in the header
+func InspectRing(path string, kind RingKind) (*RingInspector, error) {
+	file, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if stat.Size() < int64(HeaderSize) {
+		file.Close()
+		return nil, fmt.Errorf("file too small for a ring header: %d bytes", stat.Size())
+	}
+
+	m, err := mmap.Map(file, mmap.RDONLY, 0)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to mmap: %w", err)
+	}
+	header := (*QueueHeader)(unsafe.Pointer(&m[0]))
+
+	if kind == "" {
+		magic := atomic.LoadUint32(&header.Magic)
+		for k, spec := range ringSpecs {
+			if spec.magic == magic {
+				kind = k
+			}
+		}
+		if kind == "" {
+			m.Unmap()
+			file.Close()
+			return nil, fmt.Errorf("unknown magic %#x , pass the ring kind explicitly", magic)
+		}
+	}
+	spec, ok := ringSpecs[kind]
+	if !ok {
+		m.Unmap()
+		file.Close()
+		return nil, fmt.Errorf("unknown ring kind %q", kind)
+	}
+
+	return &RingInspector{
+		kind:   kind,
+		spec:   spec,
+		path:   path,
+		file:   file,
+		mmap:   m,
+		header: header,
+	}, nil
+}
+
+func (r *RingInspector) Kind() RingKind {
+	return r.kind
+}
+
+func (r *RingInspector) Info() RingInfo {
+	head := atomic.LoadUint64(&r.header.ProducerHead)
+	tail := atomic.LoadUint64(&r.header.ConsumerTail)
+	return RingInfo{
+		Kind:             r.kind,
+		Path:             r.path,
+		FileSize:         int64(len(r.mmap)),
+		ExpectedSize:     int64(r.spec.totalSize),
+		Magic:            atomic.LoadUint32(&r.header.Magic),
+		ExpectedMagic:    r.spec.magic,
+		Capacity:         atomic.LoadUint32(&r.header.Capacity),
+		LayoutHash:       atomic.LoadUint64(&r.header.LayoutHash),
+		ProducerHead:     head,
+		ConsumerTail:     tail,
+		ConsumerReserved: atomic.LoadUint64(&r.header.ConsumerReserved),
+		Depth:            head - tail,
+	}
+}
+
+// Validate runs the same checks as Open* and returns every problem instead of stopping at the first
+func (r *RingInspector) Validate() []string {
+	info := r.Info()
+	problems := []string{}
+	if info.FileSize != info.ExpectedSize {
+		problems = append(problems, fmt.Sprintf("file size %d , expected %d", info.FileSize, info.ExpectedSize))
+	}
+	if info.Magic != info.ExpectedMagic {
+		problems = append(problems, fmt.Sprintf("magic %#x , expected %#x", info.Magic, info.ExpectedMagic))
+	}
+	if uint64(info.Capacity) != r.spec.capacity {
+		problems = append(problems, fmt.Sprintf("capacity %d , expected %d", info.Capacity, r.spec.capacity))
+	}
+	if err := checkLayoutHash(info.LayoutHash, r.spec.layoutHash); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if info.ConsumerTail > info.ProducerHead || info.Depth > r.spec.capacity {
+		problems = append(problems, fmt.Sprintf("corrupt positions head=%d tail=%d", info.ProducerHead, info.ConsumerTail))
+	}
+	return problems
+}
+
+// Entry decodes the slot that holds sequence number seq , ok is false if the file is too short for it
+func (r *RingInspector) Entry(seq uint64) (any, bool) {
+	off := r.spec.headerSize + uintptr(seq%r.spec.capacity)*r.spec.entrySize
+	if off+r.spec.entrySize > uintptr(len(r.mmap)) {
+		return nil, false
+	}
+	return r.spec.decode(unsafe.Pointer(&r.mmap[off])), true
+}
+
+func (r *RingInspector) Close() error {
+	_ = r.mmap.Unmap()
+	return r.file.Close()
+}
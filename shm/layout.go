@@ -0,0 +1,228 @@
+package shm
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// layout descriptors for every struct that lives in shared memory
+// the rust engine emits the same descriptor for its #[repr(C)] types so both sides can be diffed field by field
+
+type FieldLayout struct {
+	Name   string  `json:"name"`
+	Offset uintptr `json:"offset"`
+	Size   uintptr `json:"size"`
+	Align  uintptr `json:"align"`
+}
+
+type StructLayout struct {
+	Name   string        `json:"name"`
+	Size   uintptr       `json:"size"`
+	Align  uintptr       `json:"align"`
+	Fields []FieldLayout `json:"fields"`
+}
+
+type LayoutDescriptor struct {
+	Structs []StructLayout `json:"structs"`
+}
+
+// names used in the descriptor , the rust side must use the same ones
+// every ring has its own header type , they are identical today but each is described so a change to one shows up
+const (
+	LayoutQueueHeader                = "QueueHeader"
+	LayoutCancelOrderQueueHeader     = "CancelOrderQueueHeader"
+	LayoutQueryQueueHeader           = "QueryQueueHeader"
+	LayoutOrderEventQueueHeader      = "OrderEventQueueHeader"
+	LayoutBalanceResponseHeader      = "BalanceResponseHeader"
+	LayoutHoldingResponseQueueHeader = "HoldingResponseQueueHeader"
+	LayoutOrder                      = "Order"
+	LayoutOrderToBeCanceled          = "OrderToBeCanceled"
+	LayoutQuery                      = "Query"
+	LayoutOrderEvent                 = "OrderEvent"
+	LayoutBalanceResponse            = "BalanceResponse"
+	LayoutHoldingResponse            = "HoldingResponse"
+)
+
+// a ring file is its header followed by its entries
+type ringLayout struct {
+	header StructLayout
+	entry  StructLayout
+}
+
+var ringLayouts = []ringLayout{
+	{DescribeLayout(LayoutQueueHeader, QueueHeader{}), DescribeLayout(LayoutOrder, Order{})},
+	{DescribeLayout(LayoutCancelOrderQueueHeader, CancelOrderQueueHeader{}), DescribeLayout(LayoutOrderToBeCanceled, OrderToBeCanceled{})},
+	{DescribeLayout(LayoutQueryQueueHeader, QueryQueueHeader{}), DescribeLayout(LayoutQuery, Query{})},
+	{DescribeLayout(LayoutOrderEventQueueHeader, OrderEventQueueHeader{}), DescribeLayout(LayoutOrderEvent, OrderEvent{})},
+	{DescribeLayout(LayoutBalanceResponseHeader, BalanceResponseHeader{}), DescribeLayout(LayoutBalanceResponse, BalanceResponse{})},
+	{DescribeLayout(LayoutHoldingResponseQueueHeader, HoldingResponseQueueHeader{}), DescribeLayout(LayoutHoldingResponse, HoldingResponse{})},
+}
+
+// hashes written into the LayoutHash header field , computed once from the go types
+var (
+	OrderLayoutHash           = layoutHash(ringLayouts[0])
+	CancelOrderLayoutHash     = layoutHash(ringLayouts[1])
+	QueryLayoutHash           = layoutHash(ringLayouts[2])
+	OrderEventLayoutHash      = layoutHash(ringLayouts[3])
+	BalanceResponseLayoutHash = layoutHash(ringLayouts[4])
+	HoldingResponseLayoutHash = layoutHash(ringLayouts[5])
+)
+
+// DescribeLayout walks a struct with reflection and returns its memory layout
+// nested structs are flattened as Parent.Child , padding fields (names starting with _) are skipped
+func DescribeLayout(name string, v any) StructLayout {
+	t := reflect.TypeOf(v)
+	layout := StructLayout{
+		Name:  name,
+		Size:  t.Size(),
+		Align: uintptr(t.Align()),
+	}
+	layout.Fields = describeFields(t, "", 0)
+	return layout
+}
+
+func describeFields(t reflect.Type, prefix string, base uintptr) []FieldLayout {
+	fields := []FieldLayout{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if strings.HasPrefix(f.Name, "_") {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct {
+			fields = append(fields, describeFields(f.Type, prefix+f.Name+".", base+f.Offset)...)
+			continue
+		}
+		fields = append(fields, FieldLayout{
+			Name:   prefix + f.Name,
+			Offset: base + f.Offset,
+			Size:   f.Type.Size(),
+			Align:  uintptr(f.Type.Align()),
+		})
+	}
+	return fields
+}
+
+// Layouts returns the descriptor for every ring , its header then its entry type
+func Layouts() LayoutDescriptor {
+	structs := []StructLayout{}
+	for _, r := range ringLayouts {
+		structs = append(structs, r.header, r.entry)
+	}
+	return LayoutDescriptor{Structs: structs}
+}
+
+// go uses User_id / OrderID , rust uses user_id / order_id , compare them as userid / orderid
+func normalizeFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+// layoutHash is FNV-1a 64 over the canonical form of the ring's header followed by its entry
+// canonical form per struct is "size:<n>;" then "<normalized name>:<offset>:<size>;" for every field in order
+// the rust side hashes the exact same string
+func layoutHash(r ringLayout) uint64 {
+	h := fnv.New64a()
+	for _, l := range []StructLayout{r.header, r.entry} {
+		fmt.Fprintf(h, "size:%d;", l.Size)
+		for _, f := range l.Fields {
+			fmt.Fprintf(h, "%s:%d:%d;", normalizeFieldName(f.Name), f.Offset, f.Size)
+		}
+	}
+	return h.Sum64()
+}
+
+// LayoutMismatchError lists every field that differs between the go and rust descriptors
+type LayoutMismatchError struct {
+	Diffs []string
+}
+
+func (e *LayoutMismatchError) Error() string {
+	return fmt.Sprintf("shm layout mismatch with engine (%d differences):\n  %s",
+		len(e.Diffs), strings.Join(e.Diffs, "\n  "))
+}
+
+// DiffLayouts compares the go descriptor against the one emitted by the engine
+// returns nil when they match and a *LayoutMismatchError otherwise
+func DiffLayouts(local, remote LayoutDescriptor) error {
+	diffs := []string{}
+	remoteByName := make(map[string]StructLayout)
+	for _, s := range remote.Structs {
+		remoteByName[s.Name] = s
+	}
+
+	for _, ls := range local.Structs {
+		rs, ok := remoteByName[ls.Name]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: missing from engine descriptor", ls.Name))
+			continue
+		}
+		if ls.Size != rs.Size {
+			diffs = append(diffs, fmt.Sprintf("%s: size go=%d rust=%d", ls.Name, ls.Size, rs.Size))
+		}
+		if ls.Align != rs.Align {
+			diffs = append(diffs, fmt.Sprintf("%s: align go=%d rust=%d", ls.Name, ls.Align, rs.Align))
+		}
+
+		remoteFields := make(map[string]FieldLayout)
+		for _, f := range rs.Fields {
+			remoteFields[normalizeFieldName(f.Name)] = f
+		}
+		for _, lf := range ls.Fields {
+			key := normalizeFieldName(lf.Name)
+			rf, ok := remoteFields[key]
+			if !ok {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing from engine descriptor", ls.Name, lf.Name))
+				continue
+			}
+			delete(remoteFields, key)
+			if lf.Offset != rf.Offset {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: offset go=%d rust=%d", ls.Name, lf.Name, lf.Offset, rf.Offset))
+			}
+			if lf.Size != rf.Size {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: size go=%d rust=%d", ls.Name, lf.Name, lf.Size, rf.Size))
+			}
+		}
+		for _, rf := range rs.Fields {
+			if _, extra := remoteFields[normalizeFieldName(rf.Name)]; extra {
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing from go type", ls.Name, rf.Name))
+			}
+		}
+	}
+
+	if len(diffs) == 0 {
+		return nil
+	}
+	return &LayoutMismatchError{Diffs: diffs}
+}
+
+// VerifyLayoutFile loads the descriptor the engine writes at startup and diffs it against the go types
+func VerifyLayoutFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read engine layout descriptor: %w", err)
+	}
+	var remote LayoutDescriptor
+	if err := json.Unmarshal(data, &remote); err != nil {
+		return fmt.Errorf("failed to parse engine layout descriptor: %w", err)
+	}
+	return DiffLayouts(Layouts(), remote)
+}
+
+// WriteLayoutFile dumps the go side descriptor , useful to diff by hand or to seed the rust tests
+func WriteLayoutFile(path string) error {
+	data, err := json.MarshalIndent(Layouts(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o666)
+}
+
+func checkLayoutHash(got, want uint64) error {
+	if got != want {
+		return fmt.Errorf("layout hash mismatch: file=%#x code=%#x (run VerifyLayoutFile against the engine descriptor for a field diff)", got, want)
+	}
+	return nil
+}
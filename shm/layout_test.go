@@ -0,0 +1,102 @@
+package shm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// the engine checks the same numbers , a change here means the rust side has to change with it
+func TestLayoutHashesPinned(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		got, want uint64
+	}{
+		{"orders", OrderLayoutHash, 0xc87ba1b459923148},
+		{"cancels", CancelOrderLayoutHash, 0x03329ac886d8a951},
+		{"queries", QueryLayoutHash, 0x8afbab2a7644bcb7},
+		{"order events", OrderEventLayoutHash, 0x8a578eb30747d990},
+		{"balances", BalanceResponseLayoutHash, 0x2d827c84155a9076},
+		{"holdings", HoldingResponseLayoutHash, 0xd6b3ddc3a63a0bbf},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s layout hash %#x , pinned %#x", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+// a header that drifts from the others changes only its own ring's hash
+func TestLayoutHashCoversRingHeader(t *testing.T) {
+	type widerHeader struct {
+		OrderEventQueueHeader
+		Extra uint64
+	}
+	r := ringLayouts[3]
+	r.header = DescribeLayout(LayoutOrderEventQueueHeader, widerHeader{})
+	if layoutHash(r) == OrderEventLayoutHash {
+		t.Fatal("order events hash did not change with its header")
+	}
+}
+
+func TestLayoutsDescribeEveryRingHeader(t *testing.T) {
+	names := map[string]bool{}
+	for _, s := range Layouts().Structs {
+		names[s.Name] = true
+	}
+	for _, name := range []string{
+		LayoutQueueHeader, LayoutCancelOrderQueueHeader, LayoutQueryQueueHeader,
+		LayoutOrderEventQueueHeader, LayoutBalanceResponseHeader, LayoutHoldingResponseQueueHeader,
+	} {
+		if !names[name] {
+			t.Errorf("%s missing from the descriptor", name)
+		}
+	}
+}
+
+// a ring that fails the magic or layout check is unmapped and its file closed again
+func TestOpenRefusedRingReleasesIt(t *testing.T) {
+	if _, err := os.ReadDir("/proc/self/fd"); err != nil {
+		t.Skip("no /proc/self/fd to count open files")
+	}
+	openFiles := func() int {
+		fds, _ := os.ReadDir("/proc/self/fd")
+		return len(fds)
+	}
+	opens := map[RingKind]func(path string) error{
+		RingOrders:   func(p string) error { _, err := OpenQueue(p); return err },
+		RingCancels:  func(p string) error { _, err := OpenCancelOrderQueue(p); return err },
+		RingQueries:  func(p string) error { _, err := OpenQueryQueue(p); return err },
+		RingEvents:   func(p string) error { _, err := OpenOrderEventQueue(p); return err },
+		RingBalances: func(p string) error { _, err := OpenBalanceResponseQueue(p); return err },
+		RingHoldings: func(p string) error { _, err := OpenHoldingResponseQueue(p); return err },
+	}
+	for _, kind := range RingKinds() {
+		for _, field := range []struct {
+			name   string
+			offset int64
+		}{{"magic", 128}, {"layout hash", 136}} {
+			t.Run(string(kind)+"/"+field.name, func(t *testing.T) {
+				path := filepath.Join(t.TempDir(), string(kind))
+				if err := CreateRing(kind, path); err != nil {
+					t.Fatal(err)
+				}
+				f, err := os.OpenFile(path, os.O_RDWR, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, err = f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, field.offset)
+				f.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				before := openFiles()
+				if err := opens[kind](path); err == nil {
+					t.Fatalf("opened a ring with a bad %s", field.name)
+				}
+				if after := openFiles(); after != before {
+					t.Fatalf("%d files open after the refused open , %d before", after, before)
+				}
+			})
+		}
+	}
+}
@@ -1,12 +1,21 @@
 package shm
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
 
 
 type  BrodCaster interface{
 	BrodCast(event OrderEvent)
+	BrodCastBatch(events []OrderEvent)
 }
 
+// how many events the poller takes off the ring per head/tail update
+const OrderEventsBatchSize = 512
+
 type ShmManager struct{
 	Balance_Response_queue 	*BalanceResponseQueue
 	CancelOrderQueue 	   	*CancelOrderQueue
@@ -15,6 +24,8 @@ type ShmManager struct{
 	Post_Order_queue		*Queue
 	Query_queue				*QueryQueue
 	BrodCaster				BrodCaster
+	OrderEventsWait			WaitStrategy // what the order events poller does while the ring is empty , nil means DefaultWaitStrategy
+	Log						*slog.Logger // nil means slog.Default
 }
 
 func GetShmManager(Balance_Response_queue *BalanceResponseQueue , 
@@ -36,23 +47,65 @@ func GetShmManager(Balance_Response_queue *BalanceResponseQueue ,
 
 // function to launch go routines to poll the order events and the query response queue 
 
-func(m*ShmManager)PollOrderEvents(){
-	fmt.Println("startigng poller")
+// PollOrderEvents runs until ctx is cancelled , the batch in hand is always handed over and committed first
+func(m*ShmManager)PollOrderEvents(ctx context.Context){
+	wait := m.OrderEventsWait
+	if wait == nil {
+		wait = DefaultWaitStrategy
+	}
+	log := m.Log
+	if log == nil {
+		log = slog.Default()
+	}
+	log = log.With("component", "shm_poller", "ring", "order_events")
+	log.Info("poller started", "wait_strategy", fmt.Sprintf("%T", wait))
+	bell := m.Order_Events_queue.Doorbell()
+	empty := func() bool { return m.Order_Events_queue.Depth() == 0 }
+	idle := 0
+	buf := make([]OrderEvent, OrderEventsBatchSize)
+	done := ctx.Done()
 	for {
-		
-		event , err := m.Order_Events_queue.Dequeue()
-		fmt.Println("got event")
-		
-		if err != nil{
-			return 
+		select {
+		case <-done:
+			log.Info("poller stopped", "depth", m.Order_Events_queue.Depth())
+			return
+		default:
 		}
-		if event == nil {
+		// peek -> hand to the hub -> commit , a crash in between replays the batch on restart
+		n := m.Order_Events_queue.PeekBatch(buf)
+		if n == 0 {
+			wait.Wait(idle, bell, empty)
+			idle++
 			continue
 		}
-		fmt.Println(event)
-		m.BrodCaster.BrodCast(*event)
+		idle = 0
+		// buf is reused on the next poll , the hub gets its own copy
+		batch := make([]OrderEvent, n)
+		copy(batch, buf[:n])
+		m.BrodCaster.BrodCastBatch(batch)
+		if err := m.Order_Events_queue.Commit(n); err != nil {
+			// only a second consumer on the ring gets here , the batch went out already
+			log.Error("order events commit failed", "err", err)
+		}
 	}
 }
 func(m*ShmManager)PollQueryResponse(){
 	// impl
-}
\ No newline at end of file
+}
+// Close unmaps every ring the manager holds , call it after the pollers have returned
+func (m *ShmManager) Close() error {
+	errs := []error{}
+	for _, q := range []interface{ Close() error }{
+		m.Balance_Response_queue,
+		m.CancelOrderQueue,
+		m.Holding_Response_queue,
+		m.Order_Events_queue,
+		m.Post_Order_queue,
+		m.Query_queue,
+	} {
+		if err := q.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
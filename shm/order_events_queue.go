@@ -28,6 +28,10 @@ type OrderEventQueueHeader struct {
 	_pad2        [56]byte
 	Magic        uint32
 	Capacity     uint32
+	LayoutHash   uint64   // Offset 136
+	Doorbell     uint32   // Offset 144
+	Waiters      uint32   // Offset 148
+	ConsumerReserved uint64 // Offset 152 , read but not yet committed (see recovery.go)
 }
 
 
@@ -80,6 +84,7 @@ func CreateOrderEventQueue(path string) (*OrderEventQueue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, OrderEventQueueMagic)
 	atomic.StoreUint32(&header.Capacity, OrderEventQueueCapacity)
+	atomic.StoreUint64(&header.LayoutHash, OrderEventLayoutHash)
 
 	data := m[OrderEventHeaderSize:OrderEventTotalSize]
 	events := unsafe.Slice(
@@ -122,8 +127,17 @@ func OpenOrderEventQueue(path string) (*OrderEventQueue, error) {
 
 	header := (*OrderEventQueueHeader)(unsafe.Pointer(&m[0]))
 	if atomic.LoadUint32(&header.Magic) != OrderEventQueueMagic {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
 		return nil, fmt.Errorf("invalid order event queue magic")
 	}
+	if err := checkLayoutHash(atomic.LoadUint64(&header.LayoutHash), OrderEventLayoutHash); err != nil {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
 
 	data := m[OrderEventHeaderSize:OrderEventTotalSize]
 	events := unsafe.Slice(
@@ -151,6 +165,7 @@ func (q *OrderEventQueue) Enqueue(ev OrderEvent) error {
 	q.events[pos] = ev
 
 	atomic.StoreUint64(&q.header.ProducerHead, producer+1)
+	q.Doorbell().Ring()
 	return nil
 }
 
@@ -169,11 +184,116 @@ func (q *OrderEventQueue) Dequeue() (*OrderEvent, error) {
 	return &ev, nil
 }
 
+// EnqueueBatch writes as many entries as fit and publishes them with a single head store
+// returns how many were written , with an error when the ring could not take all of them
+func (q *OrderEventQueue) EnqueueBatch(evs []OrderEvent) (int, error) {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+
+	n := uint64(len(evs))
+	if free := OrderEventQueueCapacity - (producer - consumer); n > free {
+		n = free
+	}
+	if n > 0 {
+		pos := producer % OrderEventQueueCapacity
+		first := copy(q.events[pos:], evs[:n])
+		copy(q.events, evs[first:n])
+
+		atomic.StoreUint64(&q.header.ProducerHead, producer+n)
+		q.Doorbell().Ring()
+	}
+	if n < uint64(len(evs)) {
+		return int(n), fmt.Errorf("order event queue full")
+	}
+	return int(n), nil
+}
+
+// DequeueBatch copies up to len(dst) entries into dst and releases them with a single tail store
+func (q *OrderEventQueue) DequeueBatch(dst []OrderEvent) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % OrderEventQueueCapacity
+	first := copy(dst[:n], q.events[pos:])
+	copy(dst[first:n], q.events)
+
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+n)
+	return int(n)
+}
+
+// PeekBatch copies up to len(dst) entries starting at the committed tail without releasing them
+// the slots stay in flight until Commit , a crash before that delivers them again after restart
+func (q *OrderEventQueue) PeekBatch(dst []OrderEvent) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % OrderEventQueueCapacity
+	first := copy(dst[:n], q.events[pos:])
+	copy(dst[first:n], q.events)
+
+	atomic.StoreUint64(&q.header.ConsumerReserved, consumer+n)
+	return int(n)
+}
+
+// Commit releases the first n entries returned by the last PeekBatch , more than are in flight is refused
+func (q *OrderEventQueue) Commit(n int) error {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	if err := checkCommit(consumer, atomic.LoadUint64(&q.header.ConsumerReserved), n); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+uint64(n))
+	return nil
+}
+
+// Recover reports what the previous consumer left behind , call it once right after Open
+func (q *OrderEventQueue) Recover(mode RecoveryMode) (RecoveryReport, error) {
+	report, tail, err := recoverPositions(
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail),
+		atomic.LoadUint64(&q.header.ConsumerReserved),
+		OrderEventQueueCapacity, mode)
+	if err != nil {
+		return report, err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	atomic.StoreUint64(&q.header.ConsumerReserved, tail)
+	return report, nil
+}
+
 func (q *OrderEventQueue) Depth() uint64 {
 	return atomic.LoadUint64(&q.header.ProducerHead) -
 		atomic.LoadUint64(&q.header.ConsumerTail)
 }
 
+// doorbell in the header , rung by Enqueue and waited on by pollers
+func (q *OrderEventQueue) Doorbell() Doorbell {
+	return Doorbell{seq: &q.header.Doorbell, waiters: &q.header.Waiters}
+}
+
+// Status snapshots the header for readiness checks , see health.go
+func (q *OrderEventQueue) Status() RingStatus {
+	headerOK := atomic.LoadUint32(&q.header.Magic) == OrderEventQueueMagic &&
+		atomic.LoadUint32(&q.header.Capacity) == OrderEventQueueCapacity &&
+		atomic.LoadUint64(&q.header.LayoutHash) == OrderEventLayoutHash
+	return ringStatus(q.file, headerOK,
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail))
+}
+
 func (q *OrderEventQueue) Flush() error {
 	return q.mmap.Flush()
 }
@@ -32,6 +32,10 @@ type QueueHeader struct {
 	_pad2        [56]byte // Padding
 	Magic        uint32   // Offset 128
 	Capacity     uint32   // Offset 132
+	LayoutHash   uint64   // Offset 136
+	Doorbell     uint32   // Offset 144
+	Waiters      uint32   // Offset 148
+	ConsumerReserved uint64 // Offset 152 , read but not yet committed (see recovery.go)
 }
 
 const (
@@ -87,6 +91,7 @@ func CreateQueue(filePath string) (*Queue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, QueueMagic)
 	atomic.StoreUint32(&header.Capacity, QueueCapacity)
+	atomic.StoreUint64(&header.LayoutHash, OrderLayoutHash)
 
 	// flush to disk
 	if err := m.Flush(); err != nil {
@@ -156,6 +161,12 @@ func OpenQueue(filePath string) (*Queue, error) {
 		file.Close()
 		return nil, fmt.Errorf("capacity mismatch: file=%d code=%d", header.Capacity, QueueCapacity)
 	}
+	if err := checkLayoutHash(atomic.LoadUint64(&header.LayoutHash), OrderLayoutHash); err != nil {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
 
 	ordersData := m[int(HeaderSize):int(TotalSize)]
 	if len(ordersData) == 0 {
@@ -189,6 +200,7 @@ func (q *Queue) Enqueue(order Order) error {
 
 	// Publish after write; seq-cst store is sufficient
 	atomic.StoreUint64(&q.header.ProducerHead, nextHead)
+	q.Doorbell().Ring()
 	return nil
 }
 
@@ -208,12 +220,118 @@ func (q *Queue) Dequeue() (*Order, error) {
 	return &order, nil
 }
 
+// EnqueueBatch writes as many entries as fit and publishes them with a single head store
+// returns how many were written , with an error when the ring could not take all of them
+func (q *Queue) EnqueueBatch(orders []Order) (int, error) {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+
+	n := uint64(len(orders))
+	if free := QueueCapacity - (producer - consumer); n > free {
+		n = free
+	}
+	if n > 0 {
+		pos := producer % QueueCapacity
+		first := copy(q.orders[pos:], orders[:n])
+		copy(q.orders, orders[first:n])
+
+		atomic.StoreUint64(&q.header.ProducerHead, producer+n)
+		q.Doorbell().Ring()
+	}
+	if n < uint64(len(orders)) {
+		return int(n), fmt.Errorf("queue full - consumer too slow, backpressure at depth %d/%d",
+			producer+uint64(len(orders))-consumer, QueueCapacity)
+	}
+	return int(n), nil
+}
+
+// DequeueBatch copies up to len(dst) entries into dst and releases them with a single tail store
+func (q *Queue) DequeueBatch(dst []Order) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % QueueCapacity
+	first := copy(dst[:n], q.orders[pos:])
+	copy(dst[first:n], q.orders)
+
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+n)
+	return int(n)
+}
+
+// PeekBatch copies up to len(dst) entries starting at the committed tail without releasing them
+// the slots stay in flight until Commit , a crash before that delivers them again after restart
+func (q *Queue) PeekBatch(dst []Order) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % QueueCapacity
+	first := copy(dst[:n], q.orders[pos:])
+	copy(dst[first:n], q.orders)
+
+	atomic.StoreUint64(&q.header.ConsumerReserved, consumer+n)
+	return int(n)
+}
+
+// Commit releases the first n entries returned by the last PeekBatch , more than are in flight is refused
+func (q *Queue) Commit(n int) error {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	if err := checkCommit(consumer, atomic.LoadUint64(&q.header.ConsumerReserved), n); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+uint64(n))
+	return nil
+}
+
+// Recover reports what the previous consumer left behind , call it once right after Open
+func (q *Queue) Recover(mode RecoveryMode) (RecoveryReport, error) {
+	report, tail, err := recoverPositions(
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail),
+		atomic.LoadUint64(&q.header.ConsumerReserved),
+		QueueCapacity, mode)
+	if err != nil {
+		return report, err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	atomic.StoreUint64(&q.header.ConsumerReserved, tail)
+	return report, nil
+}
+
 func (q *Queue) Depth() uint64 {
 	producerHead := atomic.LoadUint64(&q.header.ProducerHead)
 	consumerTail := atomic.LoadUint64(&q.header.ConsumerTail)
 	return producerHead - consumerTail
 }
 
+// doorbell in the header , rung by Enqueue and waited on by pollers
+func (q *Queue) Doorbell() Doorbell {
+	return Doorbell{seq: &q.header.Doorbell, waiters: &q.header.Waiters}
+}
+
+// Status snapshots the header for readiness checks , see health.go
+func (q *Queue) Status() RingStatus {
+	headerOK := atomic.LoadUint32(&q.header.Magic) == QueueMagic &&
+		atomic.LoadUint32(&q.header.Capacity) == QueueCapacity &&
+		atomic.LoadUint64(&q.header.LayoutHash) == OrderLayoutHash
+	return ringStatus(q.file, headerOK,
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail))
+}
+
 func (q *Queue) Capacity() uint64 {
 	return QueueCapacity
 }
@@ -22,6 +22,10 @@ type QueryQueueHeader struct {
 	_      [56]byte // Padding
 	Magic        uint32   // Offset 128
 	Capacity     uint32   // Offset 132
+	LayoutHash   uint64   // Offset 136
+	Doorbell     uint32   // Offset 144
+	Waiters      uint32   // Offset 148
+	ConsumerReserved uint64 // Offset 152 , read but not yet committed (see recovery.go)
 }
 
 const (
@@ -71,6 +75,7 @@ func CreateQueryQueue(path string) (*QueryQueue, error) {
 	atomic.StoreUint64(&header.ConsumerTail, 0)
 	atomic.StoreUint32(&header.Magic, QueryQueueMagic)
 	atomic.StoreUint32(&header.Capacity, QueryQueueCapacity)
+	atomic.StoreUint64(&header.LayoutHash, QueryLayoutHash)
 
 	data := m[QueryHeaderSize:QueryTotalSize]
 	queries := unsafe.Slice(
@@ -114,8 +119,17 @@ func OpenQueryQueue(path string) (*QueryQueue, error) {
 
 	header := (*QueryQueueHeader)(unsafe.Pointer(&m[0]))
 	if atomic.LoadUint32(&header.Magic) != QueryQueueMagic {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
 		return nil, fmt.Errorf("invalid query queue magic")
 	}
+	if err := checkLayoutHash(atomic.LoadUint64(&header.LayoutHash), QueryLayoutHash); err != nil {
+		m.Unlock()
+		m.Unmap()
+		file.Close()
+		return nil, err
+	}
 
 	data := m[QueryHeaderSize:QueryTotalSize]
 	queries := unsafe.Slice(
@@ -144,6 +158,7 @@ func (q *QueryQueue) Enqueue(query Query) error {
 	q.queries[pos] = query
 
 	atomic.StoreUint64(&q.header.ProducerHead, producer+1)
+	q.Doorbell().Ring()
 	return nil
 }
 
@@ -164,11 +179,116 @@ func (q *QueryQueue) Dequeue() (*Query, error) {
 }
 
 
+// EnqueueBatch writes as many entries as fit and publishes them with a single head store
+// returns how many were written , with an error when the ring could not take all of them
+func (q *QueryQueue) EnqueueBatch(queries []Query) (int, error) {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+
+	n := uint64(len(queries))
+	if free := QueryQueueCapacity - (producer - consumer); n > free {
+		n = free
+	}
+	if n > 0 {
+		pos := producer % QueryQueueCapacity
+		first := copy(q.queries[pos:], queries[:n])
+		copy(q.queries, queries[first:n])
+
+		atomic.StoreUint64(&q.header.ProducerHead, producer+n)
+		q.Doorbell().Ring()
+	}
+	if n < uint64(len(queries)) {
+		return int(n), fmt.Errorf("query queue full")
+	}
+	return int(n), nil
+}
+
+// DequeueBatch copies up to len(dst) entries into dst and releases them with a single tail store
+func (q *QueryQueue) DequeueBatch(dst []Query) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % QueryQueueCapacity
+	first := copy(dst[:n], q.queries[pos:])
+	copy(dst[first:n], q.queries)
+
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+n)
+	return int(n)
+}
+
+// PeekBatch copies up to len(dst) entries starting at the committed tail without releasing them
+// the slots stay in flight until Commit , a crash before that delivers them again after restart
+func (q *QueryQueue) PeekBatch(dst []Query) int {
+	producer := atomic.LoadUint64(&q.header.ProducerHead)
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+
+	n := producer - consumer
+	if n > uint64(len(dst)) {
+		n = uint64(len(dst))
+	}
+	if n == 0 {
+		return 0
+	}
+	pos := consumer % QueryQueueCapacity
+	first := copy(dst[:n], q.queries[pos:])
+	copy(dst[first:n], q.queries)
+
+	atomic.StoreUint64(&q.header.ConsumerReserved, consumer+n)
+	return int(n)
+}
+
+// Commit releases the first n entries returned by the last PeekBatch , more than are in flight is refused
+func (q *QueryQueue) Commit(n int) error {
+	consumer := atomic.LoadUint64(&q.header.ConsumerTail)
+	if err := checkCommit(consumer, atomic.LoadUint64(&q.header.ConsumerReserved), n); err != nil {
+		return err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, consumer+uint64(n))
+	return nil
+}
+
+// Recover reports what the previous consumer left behind , call it once right after Open
+func (q *QueryQueue) Recover(mode RecoveryMode) (RecoveryReport, error) {
+	report, tail, err := recoverPositions(
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail),
+		atomic.LoadUint64(&q.header.ConsumerReserved),
+		QueryQueueCapacity, mode)
+	if err != nil {
+		return report, err
+	}
+	atomic.StoreUint64(&q.header.ConsumerTail, tail)
+	atomic.StoreUint64(&q.header.ConsumerReserved, tail)
+	return report, nil
+}
+
 func (q *QueryQueue) Depth() uint64 {
 	return atomic.LoadUint64(&q.header.ProducerHead) -
 		atomic.LoadUint64(&q.header.ConsumerTail)
 }
 
+// doorbell in the header , rung by Enqueue and waited on by pollers
+func (q *QueryQueue) Doorbell() Doorbell {
+	return Doorbell{seq: &q.header.Doorbell, waiters: &q.header.Waiters}
+}
+
+// Status snapshots the header for readiness checks , see health.go
+func (q *QueryQueue) Status() RingStatus {
+	headerOK := atomic.LoadUint32(&q.header.Magic) == QueryQueueMagic &&
+		atomic.LoadUint32(&q.header.Capacity) == QueryQueueCapacity &&
+		atomic.LoadUint64(&q.header.LayoutHash) == QueryLayoutHash
+	return ringStatus(q.file, headerOK,
+		atomic.LoadUint64(&q.header.ProducerHead),
+		atomic.LoadUint64(&q.header.ConsumerTail))
+}
+
 func (q *QueryQueue) Capacity() uint64 {
 	return QueryQueueCapacity
 }
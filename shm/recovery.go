@@ -0,0 +1,80 @@
+package shm
+
+import "fmt"
+
+// Restart behaviour
+//
+// Create* always starts from an empty ring : the file is removed and both heads are reset to 0.
+// Only the side that owns the ring lifetime (the engine , or shmctl for local testing) should call it.
+//
+// Open* keeps whatever positions are in the file. ConsumerTail is the committed consumer position and
+// survives a gateway crash because it lives in the mapped file , not in process memory.
+//
+// Consumers that must not lose entries use PeekBatch -> process -> Commit. PeekBatch records how far
+// the consumer has read in ConsumerReserved without moving ConsumerTail , Commit then moves the tail.
+// If the process dies between the two , the slots in [ConsumerTail, ConsumerReserved) are in flight :
+// they were read but never committed. Recover reports them on the next start and either leaves them
+// to be delivered again (RecoverReplay , at least once) or drops them (RecoverSkip , at most once).
+//
+// Dequeue / DequeueBatch commit immediately and never leave anything in flight.
+
+type RecoveryMode int
+
+const (
+	RecoverReplay RecoveryMode = iota // in flight slots are handed out again by the next PeekBatch
+	RecoverSkip                       // in flight slots are committed without being processed again
+)
+
+type RecoveryReport struct {
+	ProducerHead     uint64
+	ConsumerTail     uint64
+	ConsumerReserved uint64
+	InFlight         uint64 // slots read but not committed when the previous consumer stopped
+	Pending          uint64 // slots never read by the previous consumer
+	Skipped          bool
+}
+
+func (r RecoveryReport) String() string {
+	action := "replaying"
+	if r.Skipped {
+		action = "skipped"
+	}
+	return fmt.Sprintf("head=%d tail=%d reserved=%d in_flight=%d (%s) pending=%d",
+		r.ProducerHead, r.ConsumerTail, r.ConsumerReserved, r.InFlight, action, r.Pending)
+}
+
+// shared by every ring , positions are validated before anything is moved
+func recoverPositions(head, tail, reserved, capacity uint64, mode RecoveryMode) (RecoveryReport, uint64, error) {
+	if tail > head || head-tail > capacity {
+		return RecoveryReport{}, 0, fmt.Errorf("corrupt ring positions: head=%d tail=%d capacity=%d", head, tail, capacity)
+	}
+	// reserved behind the tail just means the last consumer used Dequeue , clamp anything past the head
+	if reserved < tail {
+		reserved = tail
+	}
+	if reserved > head {
+		reserved = head
+	}
+
+	report := RecoveryReport{
+		ProducerHead:     head,
+		ConsumerTail:     tail,
+		ConsumerReserved: reserved,
+		InFlight:         reserved - tail,
+		Pending:          head - reserved,
+	}
+	newTail := tail
+	if mode == RecoverSkip && report.InFlight > 0 {
+		newTail = reserved
+		report.Skipped = true
+	}
+	return report, newTail, nil
+}
+
+// checkCommit refuses to move the tail past what PeekBatch reserved , that would release slots nobody read
+func checkCommit(tail, reserved uint64, n int) error {
+	if n < 0 || reserved < tail || uint64(n) > reserved-tail {
+		return fmt.Errorf("commit of %d entries with tail=%d reserved=%d , only peeked entries can be committed", n, tail, reserved)
+	}
+	return nil
+}
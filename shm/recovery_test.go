@@ -0,0 +1,197 @@
+package shm
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// the order events ring stands in for every ring , they share recoverPositions and checkCommit
+
+func createRing(t *testing.T) (*OrderEventQueue, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "order_events")
+	q, err := CreateOrderEventQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q, path
+}
+
+// reopen is the gateway coming back after a crash , the old mapping is dropped without a commit
+func reopen(t *testing.T, q *OrderEventQueue, path string, mode RecoveryMode) (*OrderEventQueue, RecoveryReport) {
+	t.Helper()
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	q, err := OpenOrderEventQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	report, err := q.Recover(mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, report
+}
+
+func enqueue(t *testing.T, q *OrderEventQueue, from, n int) {
+	t.Helper()
+	evs := make([]OrderEvent, n)
+	for i := range evs {
+		evs[i] = OrderEvent{OrderId: uint64(from + i)}
+	}
+	if _, err := q.EnqueueBatch(evs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expectPeek peeks everything there is and checks the order ids
+func expectPeek(t *testing.T, q *OrderEventQueue, want ...uint64) {
+	t.Helper()
+	dst := make([]OrderEvent, len(want)+1)
+	n := q.PeekBatch(dst)
+	if n != len(want) {
+		t.Fatalf("peeked %d entries , want %d", n, len(want))
+	}
+	for i, id := range want {
+		if dst[i].OrderId != id {
+			t.Fatalf("entry %d is order %d , want %d", i, dst[i].OrderId, id)
+		}
+	}
+}
+
+func TestRecoverReplayRedeliversPeeked(t *testing.T) {
+	q, path := createRing(t)
+	enqueue(t, q, 1, 5)
+	if n := q.PeekBatch(make([]OrderEvent, 3)); n != 3 {
+		t.Fatalf("peeked %d , want 3", n)
+	}
+
+	q, report := reopen(t, q, path, RecoverReplay)
+	want := RecoveryReport{ProducerHead: 5, ConsumerTail: 0, ConsumerReserved: 3, InFlight: 3, Pending: 2}
+	if report != want {
+		t.Fatalf("report %v , want %v", report, want)
+	}
+	expectPeek(t, q, 1, 2, 3, 4, 5)
+}
+
+func TestRecoverSkipDropsPeeked(t *testing.T) {
+	q, path := createRing(t)
+	enqueue(t, q, 1, 5)
+	q.PeekBatch(make([]OrderEvent, 3))
+
+	q, report := reopen(t, q, path, RecoverSkip)
+	if !report.Skipped || report.InFlight != 3 || report.Pending != 2 {
+		t.Fatalf("report %v , want 3 in flight skipped and 2 pending", report)
+	}
+	if depth := q.Depth(); depth != 2 {
+		t.Fatalf("depth %d after skipping , want 2", depth)
+	}
+	expectPeek(t, q, 4, 5)
+}
+
+func TestRecoverNothingInFlight(t *testing.T) {
+	q, path := createRing(t)
+	enqueue(t, q, 1, 4)
+	dst := make([]OrderEvent, 2)
+	q.PeekBatch(dst)
+	if err := q.Commit(2); err != nil {
+		t.Fatal(err)
+	}
+
+	q, report := reopen(t, q, path, RecoverSkip)
+	if report.Skipped || report.InFlight != 0 || report.Pending != 2 {
+		t.Fatalf("report %v , want nothing in flight and 2 pending", report)
+	}
+	expectPeek(t, q, 3, 4)
+}
+
+func TestCommitPastReserved(t *testing.T) {
+	q, _ := createRing(t)
+	enqueue(t, q, 1, 5)
+	if err := q.Commit(1); err == nil {
+		t.Fatal("commit without a peek was accepted")
+	}
+	q.PeekBatch(make([]OrderEvent, 3))
+	for _, n := range []int{4, 5, -1} {
+		if err := q.Commit(n); err == nil {
+			t.Fatalf("commit of %d after peeking 3 was accepted", n)
+		}
+	}
+	if depth := q.Depth(); depth != 5 {
+		t.Fatalf("refused commits moved the tail , depth %d , want 5", depth)
+	}
+	if err := q.Commit(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Commit(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Commit(1); err == nil {
+		t.Fatal("commit past the peeked entries was accepted")
+	}
+	expectPeek(t, q, 4, 5)
+}
+
+// positions keep counting past the capacity , the in flight slots straddle the end of the buffer
+func TestRecoverWrapAround(t *testing.T) {
+	q, path := createRing(t)
+	const before = OrderEventQueueCapacity - 2
+	enqueue(t, q, 1, before)
+	if n := q.DequeueBatch(make([]OrderEvent, before)); n != before {
+		t.Fatalf("dequeued %d , want %d", n, before)
+	}
+	enqueue(t, q, before+1, 5)
+	q.PeekBatch(make([]OrderEvent, 4))
+
+	q, report := reopen(t, q, path, RecoverReplay)
+	want := RecoveryReport{ProducerHead: before + 5, ConsumerTail: before, ConsumerReserved: before + 4, InFlight: 4, Pending: 1}
+	if report != want {
+		t.Fatalf("report %v , want %v", report, want)
+	}
+	expectPeek(t, q, before+1, before+2, before+3, before+4, before+5)
+	if err := q.Commit(5); err != nil {
+		t.Fatal(err)
+	}
+
+	q, report = reopen(t, q, path, RecoverReplay)
+	if report.InFlight != 0 || report.Pending != 0 || report.ConsumerTail != before+5 {
+		t.Fatalf("report %v after committing everything", report)
+	}
+}
+
+func TestRecoverPositions(t *testing.T) {
+	for _, tc := range []struct {
+		name                 string
+		head, tail, reserved uint64
+		mode                 RecoveryMode
+		tailAfter            uint64
+		inFlight, pending    uint64
+		corrupt              bool
+	}{
+		{name: "clean", head: 10, tail: 10, reserved: 10, tailAfter: 10},
+		{name: "dequeue consumer", head: 10, tail: 6, reserved: 2, tailAfter: 6, pending: 4},
+		{name: "reserved past head", head: 10, tail: 6, reserved: 12, tailAfter: 6, inFlight: 4},
+		{name: "skip", head: 10, tail: 6, reserved: 8, mode: RecoverSkip, tailAfter: 8, inFlight: 2, pending: 2},
+		{name: "tail past head", head: 5, tail: 6, corrupt: true},
+		{name: "more than capacity", head: 20, tail: 3, corrupt: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report, tail, err := recoverPositions(tc.head, tc.tail, tc.reserved, 16, tc.mode)
+			if tc.corrupt {
+				if err == nil {
+					t.Fatalf("accepted corrupt positions , report %v", report)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tail != tc.tailAfter || report.InFlight != tc.inFlight || report.Pending != tc.pending {
+				t.Fatalf("tail %d report %v , want tail %d in flight %d pending %d", tail, report, tc.tailAfter, tc.inFlight, tc.pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package shm
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// how a poller behaves when its ring is empty
+// idle is the number of consecutive empty polls , it resets to 0 as soon as something is dequeued
+type WaitStrategy interface {
+	Wait(idle int, bell Doorbell, empty func() bool)
+}
+
+// BusySpin never gives up the core , lowest latency and 100% cpu
+type BusySpin struct{}
+
+func (BusySpin) Wait(idle int, bell Doorbell, empty func() bool) {}
+
+// SpinYield spins for Spins empty polls and then yields the processor on every poll
+type SpinYield struct {
+	Spins int
+}
+
+func (s SpinYield) Wait(idle int, bell Doorbell, empty func() bool) {
+	if idle < s.Spins {
+		return
+	}
+	runtime.Gosched()
+}
+
+// SpinSleep spins for Spins empty polls and then sleeps , doubling from MinSleep up to MaxSleep
+type SpinSleep struct {
+	Spins    int
+	MinSleep time.Duration
+	MaxSleep time.Duration
+}
+
+func (s SpinSleep) Wait(idle int, bell Doorbell, empty func() bool) {
+	if idle < s.Spins {
+		return
+	}
+	sleep := s.MinSleep
+	for i := s.Spins; i < idle && sleep < s.MaxSleep; i++ {
+		sleep *= 2
+	}
+	if sleep > s.MaxSleep {
+		sleep = s.MaxSleep
+	}
+	time.Sleep(sleep)
+}
+
+// DoorbellWait spins for Spins empty polls and then parks on the doorbell in the shared header
+// Timeout bounds the park so a producer that never rings (older engine) still gets picked up
+type DoorbellWait struct {
+	Spins   int
+	Timeout time.Duration
+}
+
+func (s DoorbellWait) Wait(idle int, bell Doorbell, empty func() bool) {
+	if idle < s.Spins {
+		return
+	}
+	bell.Wait(empty, s.Timeout)
+}
+
+// default for pollers that were not given a strategy
+var DefaultWaitStrategy WaitStrategy = SpinSleep{
+	Spins:    1000,
+	MinSleep: 10 * time.Microsecond,
+	MaxSleep: time.Millisecond,
+}
+
+// Doorbell points at the Doorbell / Waiters words of a ring header
+// the producer rings after publishing , the consumer parks on it while the ring is empty
+type Doorbell struct {
+	seq     *uint32
+	waiters *uint32
+}
+
+// Ring wakes a parked consumer , the futex syscall is skipped when nobody is waiting
+func (d Doorbell) Ring() {
+	atomic.AddUint32(d.seq, 1)
+	if atomic.LoadUint32(d.waiters) > 0 {
+		futexWake(d.seq)
+	}
+}
+
+// Wait parks until the producer rings , the timeout expires or empty() turns false
+// waiters is raised before re-checking the ring so a publish in between is never missed
+func (d Doorbell) Wait(empty func() bool, timeout time.Duration) {
+	atomic.AddUint32(d.waiters, 1)
+	defer atomic.AddUint32(d.waiters, ^uint32(0))
+
+	seen := atomic.LoadUint32(d.seq)
+	if !empty() {
+		return
+	}
+	futexWait(d.seq, seen, timeout)
+}
+
+// ParseWaitStrategy maps a name from flags / config to a strategy with the default tuning
+func ParseWaitStrategy(name string) (WaitStrategy, error) {
+	switch name {
+	case "spin":
+		return BusySpin{}, nil
+	case "yield":
+		return SpinYield{Spins: 1000}, nil
+	case "sleep":
+		return DefaultWaitStrategy, nil
+	case "doorbell":
+		return DoorbellWait{Spins: 1000, Timeout: 10 * time.Millisecond}, nil
+	}
+	return nil, fmt.Errorf("unknown wait strategy %q (want spin, yield, sleep or doorbell)", name)
+}
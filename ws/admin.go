@@ -0,0 +1,120 @@
+package ws
+
+import (
+	"crypto/subtle"
+	logging "exchange/Logging"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// admin api for support staff , every route needs "Authorization: Bearer <server.admin_token>"
+// without a token configured none of these routes exist
+//
+//   GET    /admin/sessions                    every session , ?user_id= and ?endpoint= filter
+//   GET    /admin/sessions/:id                one session
+//   DELETE /admin/sessions/:id                close one session
+//   DELETE /admin/users/:user_id/sessions     drop every order event connection of a user
+//   GET    /admin/streams                     subscriber count per market data stream
+//   POST   /admin/system-status               push a notice to every connection , see notice.go
+//   GET    /admin/log-level , PUT /admin/log-level
+
+func (s *Server) mountAdmin(e *echo.Echo, logLevel *slog.LevelVar) {
+	if s.cfg.AdminToken == "" {
+		s.log.Warn("server.admin_token not set , admin api disabled")
+		return
+	}
+	g := e.Group("/admin", s.requireAdmin)
+	g.GET("/sessions", s.adminListSessions)
+	g.GET("/sessions/:id", s.adminGetSession)
+	g.DELETE("/sessions/:id", s.adminDisconnectSession)
+	g.DELETE("/users/:user_id/sessions", s.adminDisconnectUser)
+	g.GET("/streams", s.adminStreams)
+	g.POST("/system-status", s.adminSystemStatus)
+	if logLevel != nil {
+		g.Match([]string{http.MethodGet, http.MethodPut, http.MethodPost}, "/log-level", echo.WrapHandler(logging.LevelHandler(logLevel, s.log)))
+	}
+}
+
+func (s *Server) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	want := []byte("Bearer " + s.cfg.AdminToken)
+	return func(c echo.Context) error {
+		got := []byte(c.Request().Header.Get(echo.HeaderAuthorization))
+		if subtle.ConstantTimeCompare(got, want) != 1 {
+			s.log.Warn("admin auth failed", "remote", c.Request().RemoteAddr, "path", c.Path())
+			return echo.NewHTTPError(http.StatusUnauthorized, "admin token required")
+		}
+		return next(c)
+	}
+}
+
+func (s *Server) adminListSessions(c echo.Context) error {
+	endpoint := c.QueryParam("endpoint")
+	var userID uint64
+	if raw := c.QueryParam("user_id"); raw != "" {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "user_id must be a number")
+		}
+		userID = id
+	}
+
+	sessions := []SessionInfo{}
+	for _, info := range s.Sessions() {
+		if endpoint != "" && !strings.EqualFold(info.Endpoint, endpoint) {
+			continue
+		}
+		if userID != 0 && info.UserID != userID {
+			continue
+		}
+		sessions = append(sessions, info)
+	}
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func (s *Server) adminGetSession(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "session id must be a number")
+	}
+	ss, ok := s.session(id)
+	if !ok {
+		return echo.NewHTTPError(http.StatusNotFound, "no such session")
+	}
+	return c.JSON(http.StatusOK, ss.info())
+}
+
+func (s *Server) adminDisconnectSession(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "session id must be a number")
+	}
+	if !s.Disconnect(id, "disconnected by admin") {
+		return echo.NewHTTPError(http.StatusNotFound, "no such session")
+	}
+	s.log.Info("session disconnected by admin", "conn_id", id, "remote", c.Request().RemoteAddr)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (s *Server) adminDisconnectUser(c echo.Context) error {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 64)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "user_id must be a number")
+	}
+	n, err := s.order_events_hub_ptr.DisconnectUser(c.Request().Context(), userID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	return c.JSON(http.StatusOK, map[string]any{"user_id": userID, "disconnected": n})
+}
+
+func (s *Server) adminStreams(c echo.Context) error {
+	stats, err := s.symbol_manager_ptr.StreamSubscribers(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+	}
+	return c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,65 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// order events authentication
+// the client certificate is asked first , see tls.go , then every authenticator from WithAuthenticator in order
+// the first one that recognises the request decides , nobody recognising it is refused with 401
+// only a development box with server.dev_user set and neither client certificates nor authenticators
+// lets such a request through , as that user
+
+// Authenticator resolves the order events user of an upgrade request
+// ok is false when the request carries nothing this authenticator understands , an error refuses it with 403
+// user 0 is never valid , the hub would route nothing to it
+type Authenticator func(r *http.Request) (userID uint64, ok bool, err error)
+
+var errNoUser = errors.New("authenticator accepted the request without a user id")
+
+func (s *Server) authenticate(r *http.Request) (uint64, bool, error) {
+	// institutional clients authenticate with a client certificate
+	if userID, ok, err := s.clientCertUser(r); ok || err != nil {
+		return userID, ok, err
+	}
+	for _, auth := range s.authenticators {
+		userID, ok, err := auth(r)
+		if err != nil {
+			return 0, false, err
+		}
+		if ok && userID == 0 {
+			return 0, false, errNoUser
+		}
+		if ok {
+			return userID, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// devUser is the user of connections nobody authenticated , never when something could have authenticated them
+func (s *Server) devUser() (uint64, bool) {
+	if s.cfg.DevUser == 0 || s.cfg.TLS.ClientCAFile != "" || len(s.authenticators) > 0 {
+		return 0, false
+	}
+	return s.cfg.DevUser, true
+}
+
+// HeaderAuthenticator trusts the user id in header , for an authenticating proxy in front of the gateway that sets it
+// and for the dev tools , a gateway reachable without that proxy lets anyone pick their user
+func HeaderAuthenticator(header string) Authenticator {
+	return func(r *http.Request) (uint64, bool, error) {
+		v := r.Header.Get(header)
+		if v == "" {
+			return 0, false, nil
+		}
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("bad %s header: %w", header, err)
+		}
+		return id, true, nil
+	}
+}
@@ -0,0 +1,46 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHeaderAuthenticator(t *testing.T) {
+	auth := HeaderAuthenticator("X-User")
+	for _, tc := range []struct {
+		name   string
+		header string
+		user   uint64
+		ok     bool
+		err    bool
+	}{
+		{name: "no header"},
+		{name: "user", header: "1001", user: 1001, ok: true},
+		{name: "not a number", header: "nobody", err: true},
+		{name: "negative", header: "-1", err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/ws/OrderEvents", nil)
+			if tc.header != "" {
+				r.Header.Set("X-User", tc.header)
+			}
+			user, ok, err := auth(r)
+			if (err != nil) != tc.err || ok != tc.ok || user != tc.user {
+				t.Fatalf("got user %d ok %v err %v , want user %d ok %v err %v", user, ok, err, tc.user, tc.ok, tc.err)
+			}
+		})
+	}
+}
+
+// user 0 in the header is refused by the server , not routed to nobody
+func TestHeaderAuthenticatorUserZero(t *testing.T) {
+	s := &Server{authenticators: []Authenticator{HeaderAuthenticator("X-User")}}
+	r := httptest.NewRequest("GET", "/ws/OrderEvents", nil)
+	r.Header.Set("X-User", "0")
+	if _, _, err := s.authenticate(r); err != errNoUser {
+		t.Fatalf("err %v , want %v", err, errNoUser)
+	}
+	if _, ok := s.devUser(); ok {
+		t.Fatal("dev user used next to an authenticator")
+	}
+}
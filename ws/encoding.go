@@ -0,0 +1,37 @@
+package ws
+
+import (
+	contracts "exchange/Contracts"
+	wire "exchange/Wire"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// every connection picks its wire encoding with ?encoding=json|msgpack|protobuf|sbe , json when missing
+// client requests stay json text , everything the server sends follows the encoding , see Wire
+
+func encodingOf(c echo.Context) (contracts.Encoding, error) {
+	enc, err := contracts.ParseEncoding(c.QueryParam("encoding"))
+	if err != nil {
+		return enc, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return enc, nil
+}
+
+// encode renders a reply in the session encoding , nil when it cannot be encoded
+func (s *Server) encode(sess *session, v any) []byte {
+	data, err := wire.Message(sess.enc, v)
+	if err != nil {
+		s.log.Error("reply encode failed", "conn_id", sess.id, "encoding", sess.enc.String(), "err", err)
+		return nil
+	}
+	return data
+}
+
+// reply sends a message on a market data conn , written by the symbol manager like every other frame
+func (s *Server) reply(sess *session, v any) {
+	if data := s.encode(sess, v); data != nil {
+		s.symbol_manager_ptr.Reply(sess.conn, sess.enc, data)
+	}
+}
@@ -0,0 +1,77 @@
+package ws
+
+import (
+	contracts "exchange/Contracts"
+	"log/slog"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepalive for both endpoints
+// the read loop owns the read deadline : it starts at pong_timeout and every pong or message pushes it out ,
+// so a half open conn fails its read and runs the normal cleanup , which also empties its subscriptions
+// a keepalive goroutine next to the read loop sends the pings and enforces max_lifetime ,
+// WriteControl is safe next to the symbol manager or a write pump so it needs no coordination
+
+// armReadDeadline must be called from the read loop goroutine before the first read
+func (s *Server) armReadDeadline(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(s.cfg.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(s.cfg.PongTimeout))
+	})
+}
+
+// extendReadDeadline is called by the read loop after every message , any traffic proves the peer is there
+func (s *Server) extendReadDeadline(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(s.cfg.PongTimeout))
+}
+
+// keepalive returns once done is closed , notify encodes a message and sends it through the single writer of the conn
+func (s *Server) keepalive(conn *websocket.Conn, done <-chan struct{}, notify func(any), log *slog.Logger) {
+	ping := time.NewTicker(s.cfg.PingInterval)
+	defer ping.Stop()
+
+	var warn, expire <-chan time.Time
+	var closeAt time.Time
+	if s.cfg.MaxLifetime > 0 {
+		closeAt = time.Now().Add(s.cfg.MaxLifetime)
+		warnTimer := time.NewTimer(s.cfg.MaxLifetime - s.cfg.LifetimeWarning)
+		expireTimer := time.NewTimer(s.cfg.MaxLifetime)
+		defer warnTimer.Stop()
+		defer expireTimer.Stop()
+		warn, expire = warnTimer.C, expireTimer.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(s.cfg.WriteTimeout)); err != nil {
+				// the read loop sees the closed conn and cleans up
+				log.Debug("ping failed , closing", "err", err)
+				conn.Close()
+				return
+			}
+		case <-warn:
+			notify(contracts.ConnectionExpiringData{
+				Event:     "connectionExpiring",
+				EventTime: time.Now().UnixMilli(),
+				CloseAt:   closeAt.UnixMilli(),
+			})
+		case <-expire:
+			log.Info("max lifetime reached , closing")
+			s.closeWith(conn, websocket.CloseGoingAway, "max connection lifetime reached, reconnect")
+			return
+		}
+	}
+}
+
+func pong(id int) contracts.PongMessage {
+	return contracts.PongMessage{
+		ID:     id,
+		Result: "pong",
+		Time:   time.Now().UnixMilli(),
+	}
+}
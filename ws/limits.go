@@ -0,0 +1,43 @@
+package ws
+
+import (
+	contracts "exchange/Contracts"
+	limits "exchange/Limits"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// inbound limits , see Limits/limits.go for the buckets
+// connection limits are checked before the upgrade and refused with 429 ,
+// message and stream limits answer with an error frame , a client that keeps going gets 1008
+
+// the api key picks the limits tier , browsers cannot set headers on a websocket so the query works too
+func apiKeyOf(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("api_key")
+}
+
+func (s *Server) acquireLimits(c echo.Context, kind connKind, userID uint64) (*limits.Conn, error) {
+	lim, err := s.limiter.Acquire(c.RealIP(), userID, apiKeyOf(c.Request()))
+	if err == nil {
+		return lim, nil
+	}
+	limit := "conns_per_ip"
+	if err == limits.ErrTooManyConnsPerUser {
+		limit = "conns_per_user"
+	}
+	s.metrics.LimitRejected(kind.endpoint(), limit)
+	s.log.Warn("connection refused", "endpoint", kind.endpoint(), "remote", c.Request().RemoteAddr, "user_id", userID, "reason", err)
+	return nil, echo.NewHTTPError(http.StatusTooManyRequests, err.Error())
+}
+
+// replyError sends an error frame on a market data conn
+func (s *Server) replyError(sess *session, id int, code, msg string) {
+	s.reply(sess, contracts.ErrorMessage{
+		ID:    id,
+		Error: contracts.ErrorBody{Code: code, Msg: msg},
+	})
+}
@@ -0,0 +1,51 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	contracts "exchange/Contracts"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// system notices , e.g. a trading halt or a restart window
+// market data conns get them as {"stream":"!system","data":{...}} like any other stream message ,
+// order event conns get the bare systemStatus object next to their order events , binary encodings alike
+// anything but a normal status is retained , market data conns that join later get the last one right away
+
+// PublishSystemStatus fills in the event fields and pushes the notice to every connection
+func (s *Server) PublishSystemStatus(st contracts.SystemStatusData) (contracts.SystemStatusData, error) {
+	if !st.Status.Valid() {
+		return st, fmt.Errorf("unknown status %q", st.Status)
+	}
+	if st.StartsAt != 0 && st.EndsAt != 0 && st.EndsAt < st.StartsAt {
+		return st, errors.New("endsAt is before startsAt")
+	}
+	st.Event = "systemStatus"
+	st.EventTime = time.Now().UnixMilli()
+
+	data, err := json.Marshal(st)
+	if err != nil {
+		return st, err
+	}
+
+	s.symbol_manager_ptr.BroadcastSystemStatus(data, st.Status != contracts.SystemNormal)
+	s.order_events_hub_ptr.BroadcastAll(st)
+	s.log.Info("system status published", "status", st.Status, "symbols", st.Symbols, "message", st.Message)
+	return st, nil
+}
+
+func (s *Server) adminSystemStatus(c echo.Context) error {
+	var st contracts.SystemStatusData
+	if err := json.NewDecoder(http.MaxBytesReader(c.Response(), c.Request().Body, 64<<10)).Decode(&st); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid body: "+err.Error())
+	}
+	sent, err := s.PublishSystemStatus(st)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusAccepted, sent)
+}
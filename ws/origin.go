@@ -0,0 +1,48 @@
+package ws
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// origin policy for the upgrade , only browsers send Origin so api clients are never affected
+// without server.allowed_origins gorilla's same origin check applies ,
+// entries are "*" , an exact origin like https://app.example.com or a subdomain wildcard like https://*.example.com
+
+// compress offers permessage-deflate , it is only used for market data
+func (s *Server) newUpgrader(compress bool) websocket.Upgrader {
+	u := websocket.Upgrader{EnableCompression: compress}
+	if len(s.cfg.AllowedOrigins) > 0 {
+		u.CheckOrigin = s.checkOrigin
+	}
+	return u
+}
+
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.cfg.AllowedOrigins {
+		if originAllowed(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func originAllowed(allowed, origin string) bool {
+	if allowed == "*" || strings.EqualFold(allowed, origin) {
+		return true
+	}
+	scheme, host, ok := strings.Cut(allowed, "://*.")
+	if !ok {
+		return false
+	}
+	// https://*.example.com matches https://app.example.com but not https://example.com
+	prefix := strings.ToLower(scheme + "://")
+	origin = strings.ToLower(origin)
+	return strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, "."+strings.ToLower(host))
+}
@@ -0,0 +1,27 @@
+package ws
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// order events connections resume with ?since=<seq>&epoch=<epoch> , both from the session frame and the events
+// before the disconnect , the hub replays what it still has after since , see Hub/resume.go
+
+func resumeOf(c echo.Context) (since, epoch uint64, err error) {
+	e := c.QueryParam("epoch")
+	if e == "" {
+		return 0, 0, nil
+	}
+	if epoch, err = strconv.ParseUint(e, 10, 64); err != nil || epoch == 0 {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "epoch must be a positive integer")
+	}
+	if s := c.QueryParam("since"); s != "" {
+		if since, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "since must be a non negative integer")
+		}
+	}
+	return since, epoch, nil
+}
@@ -2,16 +2,26 @@ package ws
 
 import (
 	"encoding/json"
+	config "exchange/Config"
 	contracts "exchange/Contracts"
+	health "exchange/Health"
 	hub "exchange/Hub"
+	limits "exchange/Limits"
+	logging "exchange/Logging"
+	metrics "exchange/Metrics"
 	symbolmanager "exchange/SymbolManager"
-	"fmt"
+	wire "exchange/Wire"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
 )
 
-var upgrader = websocket.Upgrader{}
-
 type ClientMessage struct {
 	Socket  *websocket.Conn // connection objexct needs to be sent along with the message
 	Payload contracts.MessageFromUser
@@ -21,55 +31,194 @@ type Server struct {
 	// no need of the interface
 	symbol_manager_ptr *symbolmanager.SymbolManager
 	order_events_hub_ptr 	*hub.OrderEventsHub
+	cfg 					config.ServerConfig
+	echo 					*echo.Echo
+	metrics 				*metrics.Metrics
+	log 					*slog.Logger
+	nextConnID 				atomic.Uint64 // session ids , conn_id on every log line of a connection
+	readSample 				*logging.Sampler // market data reads are a hot path
+	limiter 				*limits.Limiter // nil means no inbound limits
+	authenticators 			[]Authenticator // asked in order after the client certificate , see auth.go
+	mdUpgrader 				websocket.Upgrader // origin policy , see origin.go , and compression
+	oeUpgrader 				websocket.Upgrader
+
+	// lifecycle , see shutdown.go
+	shuttingDown 			atomic.Bool
+	connsMu 				sync.Mutex
+	conns 					map[*websocket.Conn]*session
+	pumps 					sync.WaitGroup // order event write pumps still flushing
+}
+
+type Option func(*Server)
+
+// WithLogger replaces slog.Default , the server adds its component
+func WithLogger(l *slog.Logger) Option {
+	return func(s *Server) { s.log = l.With("component", "ws") }
+}
+
+// WithAuthenticator adds an order events authenticator , see auth.go
+func WithAuthenticator(a Authenticator) Option {
+	return func(s *Server) { s.authenticators = append(s.authenticators, a) }
+}
+
+// WithSampleInterval is how often the market data read line gets through , 0 logs every one
+func WithSampleInterval(d time.Duration) Option {
+	return func(s *Server) { s.readSample = logging.NewSampler(d) }
 }
 
 func NewServer(
 	symbo_manager_ptr *symbolmanager.SymbolManager,
 	order_events_hub_ptr 	*hub.OrderEventsHub, // for subscirbing unsibsicribing 
+	cfg 					config.ServerConfig,
+	m 						*metrics.Metrics, // nil disables /metrics
+	logLevel 				*slog.LevelVar, // nil disables /admin/log-level , see admin.go
+	checker 				*health.Checker, // nil disables /healthz and /readyz
+	limiter 				*limits.Limiter, // nil disables connection and message limits , see limits.go
+	opts 					...Option,
 ) *Server {
-	return &Server{
+	s := &Server{
 		symbol_manager_ptr: symbo_manager_ptr,
 		order_events_hub_ptr: order_events_hub_ptr,
+		cfg: cfg,
+		metrics: m,
+		log: slog.With("component", "ws"),
+		readSample: logging.NewSampler(logging.DefaultSampleInterval),
+		limiter: limiter,
+		conns: make(map[*websocket.Conn]*session),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mdUpgrader = s.newUpgrader(cfg.Compression)
+	s.oeUpgrader = s.newUpgrader(false)
+
+	e := echo.New()
+	e.HideBanner = true
+	e.Server.ReadHeaderTimeout = cfg.ReadHeaderTimeout
+	// per ip limits key on c.RealIP , only believe forwarded headers when told to
+	if cfg.TrustForwardedFor {
+		e.IPExtractor = echo.ExtractIPFromXFFHeader()
+	} else {
+		e.IPExtractor = echo.ExtractIPDirect()
+	}
+	e.GET("/ws/marketData", s.wsHandlerMd)
+	e.GET("/ws/OrderEvents", s.wsHandlerOrderEvents)
+	if m != nil {
+		e.GET("/metrics", echo.WrapHandler(m.Handler()))
+	}
+	if checker != nil {
+		e.GET("/healthz", echo.WrapHandler(checker.LivenessHandler()))
+		e.GET("/readyz", echo.WrapHandler(checker.ReadinessHandler()))
 	}
+	s.mountAdmin(e, logLevel)
+	s.echo = e
+	return s
 }
 
 func (s *Server) wsHandlerMd(c echo.Context) error {
+	if s.shuttingDown.Load() {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "server shutting down")
+	}
 
-	ws, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	enc, err := encodingOf(c)
+	if err != nil {
+		return err
+	}
+	lim, err := s.acquireLimits(c, connMarketData, 0)
+	if err != nil {
+		return err
+	}
+	ws, err := s.mdUpgrader.Upgrade(c.Response(), c.Request(), nil)
 
 	if err != nil {
-		fmt.Println("UPGRADE ERROR:", err)
+		lim.Release()
+		s.log.Warn("upgrade failed", "endpoint", metrics.EndpointMarketData, "remote", c.Request().RemoteAddr, "origin", c.Request().Header.Get("Origin"), "err", err)
 		return err
 	}
+	ws.SetReadLimit(s.cfg.MdReadLimit)
+	ws.SetCompressionLevel(s.cfg.CompressionLevel) // validated by config , when to compress is up to the symbol manager
+	sess := s.newSession(connMarketData, ws, c.Request().RemoteAddr, enc)
+	sess.tier = lim.Tier()
+	log := s.log.With("conn_id", sess.id, "endpoint", metrics.EndpointMarketData, "remote", sess.remote, "tier", sess.tier, "encoding", enc.String())
+	if !s.track(sess) {
+		lim.Release()
+		s.goAway(ws)
+		ws.Close()
+		return nil
+	}
+	s.metrics.ClientConnected(metrics.EndpointMarketData)
+	log.Info("connected")
 	defer func() {
+		lim.Release()
+		s.metrics.ClientDisconnected(metrics.EndpointMarketData)
+		s.untrack(ws)
 		ws.Close()
 		s.symbol_manager_ptr.CleanupConnection(ws)
 	}()
 
+	// system notices reach every market data conn through the system stream , see notice.go
+	sess.subscribed(contracts.SystemStream)
+	s.symbol_manager_ptr.Subscribe(contracts.SystemStream, ws, &sess.bytesSent, enc)
+
+	done := make(chan struct{})
+	defer close(done)
+	s.armReadDeadline(ws)
+	go s.keepalive(ws, done, func(msg any) { s.reply(sess, msg) }, log)
+
 	var mess contracts.MessageFromUser
-	//fmt.Println("WebSocket connection established!")
+	violations := 0 // rejected messages in a row
 
 	for {
 		_, p, err := ws.ReadMessage()
 		if err != nil {
-			fmt.Println("READ ERROR:", err)
+			log.Info("disconnected", "reason", err)
 			return nil
 		}
+		s.extendReadDeadline(ws)
+		s.metrics.MessagesIn(metrics.SourceWebsocket, 1)
+		if !lim.Allow() {
+			violations++
+			s.metrics.LimitRejected(metrics.EndpointMarketData, "messages")
+			if lim.TooManyViolations(violations) {
+				log.Warn("rate limit exceeded , closing", "violations", violations)
+				s.closeWith(ws, websocket.ClosePolicyViolation, "rate limit exceeded")
+				return nil
+			}
+			// one error per run of rejections , a flood must not turn into a flood of replies
+			if violations == 1 {
+				s.replyError(sess, 0, contracts.ErrCodeRateLimited, "too many messages , slow down")
+			}
+			continue
+		}
+		violations = 0
 		if err := json.Unmarshal(p, &mess); err != nil {
-			fmt.Println("json error:", err)
+			if ok, skipped := s.readSample.Allow(); ok {
+				log.Warn("invalid client message", "err", err, "skipped", skipped)
+			}
 			continue
 		}
-		fmt.Println("Recived message")
 		switch mess.Method {
 		case contracts.SUBSCRIBE:
 			if len(mess.Params) > 0 {
-				s.symbol_manager_ptr.Subscribe(mess.Params[0], ws)
+				if !sess.hasStream(mess.Params[0]) && !lim.CanSubscribe(sess.streamCount()) {
+					s.metrics.LimitRejected(metrics.EndpointMarketData, "streams")
+					s.replyError(sess, mess.ID, contracts.ErrCodeTooManyStreams, "stream limit reached , unsubscribe first")
+					continue
+				}
+				log.Debug("subscribe", "stream", mess.Params[0])
+				sess.subscribed(mess.Params[0])
+				s.symbol_manager_ptr.Subscribe(mess.Params[0], ws, &sess.bytesSent, enc)
 			}
 
 		case contracts.UNSUBSCRIBE:
 			if len(mess.Params) > 0 {
+				log.Debug("unsubscribe", "stream", mess.Params[0])
+				sess.unsubscribed(mess.Params[0])
 				s.symbol_manager_ptr.UnSubscribe(mess.Params[0], ws)
 			}
+
+		case contracts.PING:
+			s.reply(sess, pong(mess.ID))
 		}
 
 	}
@@ -78,7 +227,13 @@ func (s *Server) wsHandlerMd(c echo.Context) error {
 type ClientForOrderEvents struct {
 	UserId 	uint64
 	Conn 	*websocket.Conn
-	SendCh	chan []byte
+	SendCh	chan hub.Outbound
+	ctrl 	chan []byte // pongs and notices , encoded , the pump is the only writer
+	server 	*Server
+	session *session
+	log 	*slog.Logger
+	resumeSince uint64
+	resumeEpoch uint64
 }
 
 // interface functions for hub 
@@ -88,59 +243,167 @@ func (cl *ClientForOrderEvents)GetUserId()uint64{
 func (cl *ClientForOrderEvents)GetConnObj()*websocket.Conn{
 	return cl.Conn
 }
-func (cl *ClientForOrderEvents)GetSendCh()chan []byte{
+func (cl *ClientForOrderEvents)GetSendCh()chan hub.Outbound{
 	return cl.SendCh
 }
+func (cl *ClientForOrderEvents)GetEncoding()contracts.Encoding{
+	return cl.session.enc
+}
+func (cl *ClientForOrderEvents)GetResume()(uint64, uint64){
+	return cl.resumeSince, cl.resumeEpoch
+}
 
 
 
+// the hub closes SendCh on unregister , eviction and shutdown , everything queued before that is still written
 func (coe *ClientForOrderEvents) WritePumpForOrderEv() {
+	defer coe.server.pumps.Done()
     for {
 
-        message, ok := <-coe.SendCh  
-		fmt.Println("wrtie routine got message")
-		fmt.Println(string(message))
+		var message hub.Outbound
+		var ok bool
+		select {
+		case message, ok = <-coe.SendCh:
+		case data := <-coe.ctrl:
+			coe.Conn.SetWriteDeadline(time.Now().Add(coe.server.cfg.WriteTimeout))
+			if err := coe.Conn.WriteMessage(wire.FrameType(coe.session.enc), data); err != nil {
+				coe.log.Info("write failed , pump exiting", "err", err)
+				return
+			}
+			continue
+		}
         if !ok {
            // chnnel closed
+			if coe.server.shuttingDown.Load() {
+				coe.server.goAway(coe.Conn)
+				return
+			}
+			// evicted or kicked by the hub , closing the conn ends the read loop too
+			coe.server.closeWith(coe.Conn, websocket.ClosePolicyViolation, "session closed by server")
             return
         }
-        if err := coe.Conn.WriteMessage(websocket.BinaryMessage, message); err != nil {
+		coe.Conn.SetWriteDeadline(time.Now().Add(coe.server.cfg.WriteTimeout))
+        if err := coe.Conn.WriteMessage(wire.FrameType(coe.session.enc), message.Data); err != nil {
+			coe.server.metrics.Dropped(metrics.EndpointOrderEvents, "write_error")
+			coe.log.Info("write failed , pump exiting", "err", err)
             return
         }
+		coe.session.bytesSent.Add(uint64(len(message.Data)))
+		coe.server.metrics.MessageOut(metrics.EndpointOrderEvents)
+		coe.server.metrics.ObserveOrderEventLatency(message.PolledAt)
     }
 }
 
 
+// control encodes a message and hands it to the pump , dropped when the pump is behind or gone
+func (coe *ClientForOrderEvents) control(msg any) {
+	data := coe.server.encode(coe.session, msg)
+	if data == nil {
+		return
+	}
+	select {
+	case coe.ctrl <- data:
+	default:
+	}
+}
+
 func (s*Server)wsHandlerOrderEvents(c echo.Context)error{
-	// authenticate thishandler , give me the exracted userId 
-	fmt.Println("inside handler ")
-	user_id := uint64(20) // give this from auth 
-	fmt.Println(user_id)
-	conn , err := upgrader.Upgrade(c.Response() , c.Request() , nil)
+	if s.shuttingDown.Load() {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "server shutting down")
+	}
+	user_id, ok, err := s.authenticate(c.Request())
+	if err != nil {
+		s.log.Warn("authentication refused", "remote", c.Request().RemoteAddr, "err", err)
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	if !ok {
+		if user_id, ok = s.devUser(); !ok {
+			return echo.NewHTTPError(http.StatusUnauthorized, "order events need credentials")
+		}
+	}
+	enc, err := encodingOf(c)
+	if err != nil {
+		return err
+	}
+	since, epoch, err := resumeOf(c)
+	if err != nil {
+		return err
+	}
+	lim, err := s.acquireLimits(c, connOrderEvents, user_id)
+	if err != nil {
+		return err
+	}
+	conn , err := s.oeUpgrader.Upgrade(c.Response() , c.Request() , nil)
 	if err!=nil{
-		fmt.Println("error upgrading connection")
+		lim.Release()
+		s.log.Warn("upgrade failed", "endpoint", metrics.EndpointOrderEvents, "user_id", user_id, "remote", c.Request().RemoteAddr, "origin", c.Request().Header.Get("Origin"), "err", err)
 		return err
 	}
+	conn.SetReadLimit(s.cfg.OeReadLimit)
+	sess := s.newSession(connOrderEvents, conn, c.Request().RemoteAddr, enc)
+	sess.userID = user_id
+	sess.tier = lim.Tier()
+	sess.sendCh = make(chan hub.Outbound , s.cfg.SendBufferSize)
+	log := s.log.With("conn_id", sess.id, "endpoint", metrics.EndpointOrderEvents, "user_id", user_id, "remote", sess.remote, "tier", sess.tier, "encoding", enc.String())
+	if !s.track(sess) {
+		lim.Release()
+		s.goAway(conn)
+		conn.Close()
+		return nil
+	}
 
 	client := &ClientForOrderEvents{
 		UserId: user_id,
 		Conn: conn,
-		SendCh: make(chan []byte , 256),
+		SendCh: sess.sendCh,
+		ctrl: make(chan []byte, 4),
+		server: s,
+		session: sess,
+		log: log,
+		resumeSince: since,
+		resumeEpoch: epoch,
 	}
 	s.order_events_hub_ptr.Register(client)
 	go client.WritePumpForOrderEv()
+	s.metrics.ClientConnected(metrics.EndpointOrderEvents)
+	log.Info("connected")
 	defer func(){
-		
+		lim.Release()
+		s.metrics.ClientDisconnected(metrics.EndpointOrderEvents)
+		s.untrack(conn)
 		s.order_events_hub_ptr.UnRegister(client)
 		conn.Close()
 		// or
 		//
 		//client.hub_ptr.UnRegister(conn)
 	}()
+	done := make(chan struct{})
+	defer close(done)
+	s.armReadDeadline(conn)
+	go s.keepalive(conn, done, client.control, log)
+
+	violations := 0
+	var mess contracts.MessageFromUser
 	for {
-		_ , _ , err:= client.Conn.ReadMessage()
+		_ , p , err:= client.Conn.ReadMessage()
 		if err!=nil{
-			fmt.Println("read error")
+			log.Info("disconnected", "reason", err)
+			return nil
+		}
+		s.extendReadDeadline(conn)
+		// only PING is expected from the client , and it must not flood us
+		if lim.Allow() {
+			violations = 0
+			if json.Unmarshal(p, &mess) == nil && mess.Method == contracts.PING {
+				client.control(pong(mess.ID))
+			}
+			continue
+		}
+		violations++
+		s.metrics.LimitRejected(metrics.EndpointOrderEvents, "messages")
+		if lim.TooManyViolations(violations) {
+			log.Warn("rate limit exceeded , closing", "violations", violations)
+			s.closeWith(conn, websocket.ClosePolicyViolation, "rate limit exceeded")
 			return nil
 		}
 	}
@@ -149,15 +412,61 @@ func (s*Server)wsHandlerOrderEvents(c echo.Context)error{
 	
 }
 
-func (s *Server) CreateServer() {
-	fmt.Println("BOOTING SERVER...")
+// ConfigureTLS loads the certificates , call it before CreateServer , without server.tls.cert_file it does nothing
+func (s *Server) ConfigureTLS() error {
+	conf, err := s.tlsConfig()
+	if err != nil || conf == nil {
+		return err
+	}
+	s.echo.TLSServer.Addr = s.cfg.Addr
+	s.echo.TLSServer.ReadHeaderTimeout = s.cfg.ReadHeaderTimeout
+	s.echo.TLSServer.TLSConfig = conf
+	return nil
+}
 
-	e := echo.New()
-	e.GET("/ws/marketData", s.wsHandlerMd)
-	e.GET("/ws/OrderEvents", s.wsHandlerOrderEvents)
+// Listen binds server.addr , call it after ConfigureTLS , CreateServer then serves on it
+// without it CreateServer binds on its own and a busy port only shows up in the log
+func (s *Server) Listen() error {
+	l, err := net.Listen("tcp", s.cfg.Addr)
+	if err != nil {
+		return err
+	}
+	if conf := s.echo.TLSServer.TLSConfig; conf != nil {
+		s.echo.TLSListener = tls.NewListener(l, conf)
+	} else {
+		s.echo.Listener = l
+	}
+	return nil
+}
+
+// Addr is the bound address after Listen , useful with server.addr ":0"
+func (s *Server) Addr() net.Addr {
+	if s.echo.TLSListener != nil {
+		return s.echo.TLSListener.Addr()
+	}
+	if s.echo.Listener != nil {
+		return s.echo.Listener.Addr()
+	}
+	return nil
+}
 
-	fmt.Println("LISTENING on :8080 ...")
+// Echo is the http router , routes added before CreateServer are served next to the websocket endpoints
+func (s *Server) Echo() *echo.Echo {
+	return s.echo
+}
 
-	err := e.Start(":8080")
-	fmt.Println("SERVER EXITED:", err)
+func (s *Server) CreateServer() {
+	var err error
+	if s.echo.TLSServer.TLSConfig != nil {
+		s.log.Info("listening", "addr", s.cfg.Addr, "tls", true, "client_certs", s.cfg.TLS.ClientCAFile != "")
+		err = s.echo.StartServer(s.echo.TLSServer)
+	} else {
+		s.log.Info("listening", "addr", s.cfg.Addr, "tls", false)
+		err = s.echo.Start(s.cfg.Addr)
+	}
+	if err != nil && err != http.ErrServerClosed {
+		s.log.Error("server exited", "err", err)
+		return
+	}
+	s.log.Info("server exited")
 }
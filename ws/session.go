@@ -0,0 +1,167 @@
+package ws
+
+import (
+	contracts "exchange/Contracts"
+	hub "exchange/Hub"
+	metrics "exchange/Metrics"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// one session per upgraded websocket , kept in Server.conns from track to untrack
+// this is what the admin api lists and what shutdown walks over
+
+type connKind int
+
+const (
+	connMarketData connKind = iota
+	connOrderEvents
+)
+
+func (k connKind) endpoint() string {
+	if k == connOrderEvents {
+		return metrics.EndpointOrderEvents
+	}
+	return metrics.EndpointMarketData
+}
+
+type session struct {
+	id          uint64
+	kind        connKind
+	conn        *websocket.Conn
+	remote      string
+	userID      uint64 // order events only , market data is anonymous
+	connectedAt time.Time
+	tier        string // limits tier from the api key
+	enc         contracts.Encoding
+	bytesSent   atomic.Uint64     // market data writes are counted by the symbol manager through this pointer
+	sendCh      chan hub.Outbound // order events only
+
+	mu      sync.Mutex
+	streams map[string]struct{} // market data subscriptions as requested by the client
+}
+
+func (s *Server) newSession(kind connKind, conn *websocket.Conn, remote string, enc contracts.Encoding) *session {
+	return &session{
+		id:          s.nextConnID.Add(1),
+		kind:        kind,
+		conn:        conn,
+		remote:      remote,
+		enc:         enc,
+		connectedAt: time.Now(),
+		streams:     make(map[string]struct{}),
+	}
+}
+
+func (ss *session) subscribed(stream string) {
+	ss.mu.Lock()
+	ss.streams[stream] = struct{}{}
+	ss.mu.Unlock()
+}
+
+func (ss *session) unsubscribed(stream string) {
+	ss.mu.Lock()
+	delete(ss.streams, stream)
+	ss.mu.Unlock()
+}
+
+// hasStream and streamCount back the max streams limit , gateway streams like !system do not count
+func (ss *session) hasStream(stream string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	_, ok := ss.streams[stream]
+	return ok
+}
+
+func (ss *session) streamCount() int {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	n := 0
+	for stream := range ss.streams {
+		if !strings.HasPrefix(stream, "!") {
+			n++
+		}
+	}
+	return n
+}
+
+type SessionInfo struct {
+	ID            uint64    `json:"id"`
+	Endpoint      string    `json:"endpoint"`
+	RemoteIP      string    `json:"remote_ip"`
+	UserID        uint64    `json:"user_id,omitempty"`
+	Tier          string    `json:"tier,omitempty"`
+	Encoding      string    `json:"encoding"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	Subscriptions []string  `json:"subscriptions,omitempty"`
+	SendQueue     int       `json:"send_queue"`
+	SendQueueCap  int       `json:"send_queue_cap"`
+	BytesSent     uint64    `json:"bytes_sent"`
+}
+
+func (ss *session) info() SessionInfo {
+	ip := ss.remote
+	if host, _, err := net.SplitHostPort(ss.remote); err == nil {
+		ip = host
+	}
+	ss.mu.Lock()
+	streams := make([]string, 0, len(ss.streams))
+	for stream := range ss.streams {
+		streams = append(streams, stream)
+	}
+	ss.mu.Unlock()
+	sort.Strings(streams)
+
+	return SessionInfo{
+		ID:            ss.id,
+		Endpoint:      ss.kind.endpoint(),
+		RemoteIP:      ip,
+		UserID:        ss.userID,
+		Tier:          ss.tier,
+		Encoding:      ss.enc.String(),
+		ConnectedAt:   ss.connectedAt,
+		Subscriptions: streams,
+		SendQueue:     len(ss.sendCh),
+		SendQueueCap:  cap(ss.sendCh),
+		BytesSent:     ss.bytesSent.Load(),
+	}
+}
+
+// Sessions snapshots every open session ordered by id
+func (s *Server) Sessions() []SessionInfo {
+	s.connsMu.Lock()
+	infos := make([]SessionInfo, 0, len(s.conns))
+	for _, ss := range s.conns {
+		infos = append(infos, ss.info())
+	}
+	s.connsMu.Unlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+func (s *Server) session(id uint64) (*session, bool) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for _, ss := range s.conns {
+		if ss.id == id {
+			return ss, true
+		}
+	}
+	return nil, false
+}
+
+// Disconnect closes one session with a policy violation close frame , its read loop runs the usual cleanup
+func (s *Server) Disconnect(id uint64, reason string) bool {
+	ss, ok := s.session(id)
+	if !ok {
+		return false
+	}
+	s.closeWith(ss.conn, websocket.ClosePolicyViolation, reason)
+	return true
+}
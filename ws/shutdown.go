@@ -0,0 +1,93 @@
+package ws
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// shutdown order driven by main :
+//   BeginShutdown    -> no new upgrades , listener closed , open websockets untouched
+//   (shm poller and hub stop , the hub closes every order event SendCh)
+//   CloseConnections -> market data clients get 1001 , order event pumps flush then send 1001 themselves ,
+//                       anything still open at the deadline is closed hard
+
+// track returns false once shutdown started , the caller closes the connection it just upgraded
+// order event conns also reserve their write pump here so CloseConnections never waits on a late Add
+func (s *Server) track(ss *session) bool {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if s.shuttingDown.Load() {
+		return false
+	}
+	s.conns[ss.conn] = ss
+	if ss.kind == connOrderEvents {
+		s.pumps.Add(1)
+	}
+	return true
+}
+
+func (s *Server) untrack(conn *websocket.Conn) {
+	s.connsMu.Lock()
+	delete(s.conns, conn)
+	s.connsMu.Unlock()
+}
+
+// goAway sends 1001 with the reconnect hint as the reason
+// WriteControl is safe to call next to the symbol manager or a write pump writing on the same conn
+func (s *Server) goAway(conn *websocket.Conn) {
+	reason := fmt.Sprintf("server shutting down, reconnect after %s", s.cfg.ReconnectAfter)
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+// closeWith sends a close frame and drops the connection without waiting for the client to answer
+func (s *Server) closeWith(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	conn.Close()
+}
+
+// BeginShutdown stops accepting upgrades and closes the http listener
+func (s *Server) BeginShutdown(ctx context.Context) error {
+	s.connsMu.Lock()
+	s.shuttingDown.Store(true)
+	s.connsMu.Unlock()
+	// hijacked websocket conns are not tracked by net/http so they survive this
+	return s.echo.Shutdown(ctx)
+}
+
+// CloseConnections says goodbye to every client , call it after the hub has stopped
+func (s *Server) CloseConnections(ctx context.Context) {
+	s.connsMu.Lock()
+	conns := make(map[*websocket.Conn]connKind, len(s.conns))
+	for conn, ss := range s.conns {
+		conns[conn] = ss.kind
+	}
+	s.connsMu.Unlock()
+	s.log.Info("closing connections", "count", len(conns))
+
+	for conn, kind := range conns {
+		if kind == connMarketData {
+			s.goAway(conn)
+		}
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		s.pumps.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		s.log.Warn("shutdown deadline hit before every order event client was flushed")
+	}
+
+	// the read loops exit on the close and run their usual cleanup
+	for conn := range conns {
+		conn.Close()
+	}
+}
@@ -0,0 +1,141 @@
+package ws
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tls for the websocket listener , off while server.tls.cert_file is empty
+// cert and key are read again when they change on disk so a renewed certificate needs no restart ,
+// the check runs on a handshake at most once per reload_interval and a bad pair keeps the old one
+// with client_ca_file set clients may present a certificate , institutional order event clients are
+// mapped to their user id by the certificate common name , see clientCertUser
+
+var ErrUnknownClientCert = errors.New("client certificate is not mapped to a user")
+
+type certReloader struct {
+	certFile, keyFile string
+	interval          time.Duration
+	log               *slog.Logger
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time // newest of the two files when cert was loaded
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile string, interval time.Duration, log *slog.Logger) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, interval: interval, log: log}
+	modTime, err := r.modified()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) modified() (time.Time, error) {
+	var newest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		st, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if st.ModTime().After(newest) {
+			newest = st.ModTime()
+		}
+	}
+	return newest, nil
+}
+
+// load must be called with mu held or before the reloader is shared
+func (r *certReloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load tls key pair: %w", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.checkedAt) < r.interval {
+		return r.cert, nil
+	}
+	r.checkedAt = time.Now()
+	modTime, err := r.modified()
+	if err != nil {
+		r.log.Warn("tls cert check failed , keeping the loaded one", "err", err)
+		return r.cert, nil
+	}
+	if !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+	if err := r.load(modTime); err != nil {
+		// cert and key are often replaced one after the other , the next check picks up the pair
+		r.log.Warn("tls cert reload failed , keeping the loaded one", "err", err)
+		return r.cert, nil
+	}
+	r.log.Info("tls cert reloaded", "cert_file", r.certFile)
+	return r.cert, nil
+}
+
+// tlsConfig is nil when tls is off
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	cfg := s.cfg.TLS
+	if cfg.CertFile == "" {
+		return nil, nil
+	}
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile, cfg.ReloadInterval, s.log)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client ca file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client ca file %s", cfg.ClientCAFile)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return conf, nil
+}
+
+// clientCertUser maps a verified client certificate to its order events user
+// ok is false when the client sent no certificate , a certificate nobody mapped is an error
+func (s *Server) clientCertUser(r *http.Request) (userID uint64, ok bool, err error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return 0, false, nil
+	}
+	cn := strings.TrimSpace(r.TLS.PeerCertificates[0].Subject.CommonName)
+	userID, ok = s.cfg.TLS.ClientCertUsers[cn]
+	if !ok || userID == 0 {
+		return 0, false, fmt.Errorf("%w: %q", ErrUnknownClientCert, cn)
+	}
+	return userID, true, nil
+}